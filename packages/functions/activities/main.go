@@ -0,0 +1,214 @@
+// Package main implements the activities endpoint.
+//
+// GET /activities returns the "atividade" desafios saved by the consumer
+// (AtividadeItem), which are kept apart from the readings and do not count in
+// country progress. Optional filters: user and mes (month number 1-12).
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/calendar"
+	"github.com/mundotalendo/functions/types"
+)
+
+var (
+	dynamoClient *dynamodb.Client
+	tableName    string
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("SST_Resource_DataTable_name")
+}
+
+func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	log.Printf("Activities request: %v", request.QueryStringParameters)
+
+	// Validate API key
+	apiKey := request.Headers["x-api-key"]
+	if apiKey == "" {
+		apiKey = request.Headers["X-API-Key"]
+	}
+	if !auth.ValidateAPIKey(ctx, dynamoClient, apiKey) {
+		log.Printf("Unauthorized: invalid API key")
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"UNAUTHORIZED","message":"Invalid or missing API key"}`,
+		}, nil
+	}
+
+	user := strings.TrimSpace(request.QueryStringParameters["user"])
+	month := 0
+	if mes := strings.TrimSpace(request.QueryStringParameters["mes"]); mes != "" {
+		n, err := strconv.Atoi(mes)
+		if _, ok := calendar.ByNumber(n); err != nil || !ok {
+			return errorResponse(400, "Invalid mes, expected a month number from 1 to 12"), nil
+		}
+		month = n
+	}
+
+	activities, err := queryActivities(ctx, activitiesQuery(user))
+	if err != nil {
+		log.Printf("Error querying activities: %v", err)
+		return errorResponse(500, "Error fetching data"), nil
+	}
+
+	activities = filterByMonth(activities, month)
+	sortActivities(activities)
+
+	response := types.ActivitiesResponse{
+		Activities: activities,
+		Total:      len(activities),
+	}
+
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return errorResponse(500, "Error building response"), nil
+	}
+
+	log.Printf("Returning %d activities", response.Total)
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(responseBody),
+	}, nil
+}
+
+// activitiesQuery reads the activity partition, or a single user's activities
+// through the GSI UserIndex.
+func activitiesQuery(user string) *dynamodb.QueryInput {
+	if user == "" {
+		return &dynamodb.QueryInput{
+			TableName:              &tableName,
+			KeyConditionExpression: aws.String("PK = :pk"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk": &ddbTypes.AttributeValueMemberS{Value: types.ActivityPartition},
+			},
+		}
+	}
+
+	return &dynamodb.QueryInput{
+		TableName:              &tableName,
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("#user = :user AND PK = :pk"),
+		ExpressionAttributeNames: map[string]string{
+			"#user": "user",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":user": &ddbTypes.AttributeValueMemberS{Value: user},
+			":pk":   &ddbTypes.AttributeValueMemberS{Value: types.ActivityPartition},
+		},
+	}
+}
+
+// queryActivities runs the query to the end (all pages).
+func queryActivities(ctx context.Context, input *dynamodb.QueryInput) ([]types.AtividadeItem, error) {
+	activities := []types.AtividadeItem{}
+
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []types.AtividadeItem
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, err
+		}
+		activities = append(activities, page...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return activities, nil
+}
+
+// filterByMonth keeps the activities of the month (0 keeps all).
+func filterByMonth(activities []types.AtividadeItem, month int) []types.AtividadeItem {
+	if month == 0 {
+		return activities
+	}
+
+	filtered := []types.AtividadeItem{}
+	for _, activity := range activities {
+		if activity.Mes == month {
+			filtered = append(filtered, activity)
+		}
+	}
+	return filtered
+}
+
+// sortActivities orders activities by month, then user and description.
+// Activities whose category is not a month come last.
+func sortActivities(activities []types.AtividadeItem) {
+	sort.SliceStable(activities, func(i, j int) bool {
+		a, b := activities[i], activities[j]
+		if a.Mes != b.Mes {
+			return b.Mes == 0 || (a.Mes != 0 && a.Mes < b.Mes)
+		}
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		return a.Descricao < b.Descricao
+	})
+}
+
+func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	body, err := json.Marshal(map[string]string{
+		"error": message,
+	})
+	if err != nil {
+		log.Printf("ERROR marshaling error response: %v", err)
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 500,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"INTERNAL_ERROR"}`,
+		}
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(body),
+	}
+}
+
+func main() {
+	lambda.Start(handler)
+}
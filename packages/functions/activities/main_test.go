@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mundotalendo/functions/types"
+)
+
+func TestFilterAndSortActivities(t *testing.T) {
+	activities := []types.AtividadeItem{
+		{User: "Maria", Descricao: "Bônus", Mes: 0},
+		{User: "Maria", Descricao: "Portugal", Mes: 3},
+		{User: "Ana", Descricao: "Ler um clássico", Mes: 3},
+		{User: "Ana", Descricao: "Chile", Mes: 1},
+	}
+
+	sortActivities(activities)
+	want := []string{"Chile", "Ler um clássico", "Portugal", "Bônus"}
+	for i, descricao := range want {
+		if activities[i].Descricao != descricao {
+			t.Errorf("position %d: expected %s, got %s", i, descricao, activities[i].Descricao)
+		}
+	}
+
+	if march := filterByMonth(activities, 3); len(march) != 2 {
+		t.Errorf("expected 2 activities in March, got %d", len(march))
+	}
+	if all := filterByMonth(activities, 0); len(all) != 4 {
+		t.Errorf("expected no filter for month 0, got %d", len(all))
+	}
+}
+
+func TestActivitiesQuery(t *testing.T) {
+	if input := activitiesQuery(""); input.IndexName != nil {
+		t.Errorf("expected a partition query without user, got index %s", aws.ToString(input.IndexName))
+	}
+	if input := activitiesQuery("Maria"); aws.ToString(input.IndexName) != "UserIndex" {
+		t.Errorf("expected UserIndex for a user, got %s", aws.ToString(input.IndexName))
+	}
+}
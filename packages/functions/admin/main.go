@@ -0,0 +1,466 @@
+// Package main implements read-only admin endpoints.
+//
+// GET /admin/errors lists the FalhaItem records written by the consumer
+// (permanent failures and unmapped countries), newest first, with optional
+// filters: type, user, from, to (YYYY-MM-DD or RFC3339) and limit.
+//
+// GET /admin/unmapped lists quarantined country names (most frequent first)
+// and GET /admin/aliases the aliases registered through POST /admin/aliases.
+//
+// GET /admin/month-mismatches lists live readings whose country does not
+// belong to the month declared in the desafio category, according to the
+// official calendar (package calendar), sorted by user.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/calendar"
+	"github.com/mundotalendo/functions/types"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+var (
+	dynamoClient *dynamodb.Client
+	tableName    string
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("SST_Resource_DataTable_name")
+}
+
+// MonthMismatch is a reading whose country belongs to another month.
+type MonthMismatch struct {
+	User           string `json:"user"`
+	ISO3           string `json:"iso3"`
+	Pais           string `json:"pais"`
+	Livro          string `json:"livro,omitempty"`
+	Categoria      string `json:"categoria"`
+	Mes            int    `json:"mes"`                      // Month declared in the category
+	MesOficial     int    `json:"mesOficial,omitempty"`     // Month of the country in the calendar (0 if not assigned)
+	MesOficialNome string `json:"mesOficialNome,omitempty"` // Name of the official month
+	WebhookUUID    string `json:"webhookUUID"`
+}
+
+// errorFilters holds the parsed query string of GET /admin/errors.
+// From/To are inclusive createdAt bounds; empty means unbounded.
+type errorFilters struct {
+	ErrorType string
+	User      string
+	From      string
+	To        string
+	Limit     int
+}
+
+func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	log.Printf("Admin request: %s %v", request.RouteKey, request.QueryStringParameters)
+
+	// Validate admin key (the public API keys are not accepted here)
+	adminKey := request.Headers["x-admin-key"]
+	if adminKey == "" {
+		adminKey = request.Headers["X-Admin-Key"]
+	}
+	if !auth.ValidateAdminKey(ctx, dynamoClient, adminKey) {
+		log.Printf("Unauthorized: invalid admin key")
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"UNAUTHORIZED","message":"Invalid or missing admin key"}`,
+		}, nil
+	}
+
+	var body map[string]interface{}
+	switch request.RouteKey {
+	case "GET /admin/unmapped":
+		var unmapped []types.UnmappedCountryItem
+		if err := queryPartition(ctx, types.UnmappedCountryPartition, &unmapped); err != nil {
+			log.Printf("Error querying DynamoDB: %v", err)
+			return errorResponse(500, "Error fetching data"), nil
+		}
+		unmapped = mostFrequentFirst(unmapped)
+		body = map[string]interface{}{"unmapped": unmapped, "count": len(unmapped)}
+
+	case "GET /admin/aliases":
+		var aliases []types.CountryAliasItem
+		if err := queryPartition(ctx, types.CountryAliasPartition, &aliases); err != nil {
+			log.Printf("Error querying DynamoDB: %v", err)
+			return errorResponse(500, "Error fetching data"), nil
+		}
+		if aliases == nil {
+			aliases = []types.CountryAliasItem{}
+		}
+		body = map[string]interface{}{"aliases": aliases, "count": len(aliases)}
+
+	case "GET /admin/month-mismatches":
+		var readings []types.LeituraItem
+		if err := queryPartition(ctx, "EVENT#LEITURA", &readings); err != nil {
+			log.Printf("Error querying DynamoDB: %v", err)
+			return errorResponse(500, "Error fetching data"), nil
+		}
+		mismatches := monthMismatches(readings)
+		body = map[string]interface{}{"mismatches": mismatches, "count": len(mismatches)}
+
+	case "GET /admin/errors":
+		filters, err := parseErrorFilters(request.QueryStringParameters)
+		if err != nil {
+			return errorResponse(400, err.Error()), nil
+		}
+
+		falhas, err := queryFailures(ctx, filters)
+		if err != nil {
+			log.Printf("Error querying DynamoDB: %v", err)
+			return errorResponse(500, "Error fetching data"), nil
+		}
+		body = map[string]interface{}{"errors": falhas, "count": len(falhas)}
+
+	default:
+		return errorResponse(404, "Route not found"), nil
+	}
+
+	responseBody, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return errorResponse(500, "Error building response"), nil
+	}
+
+	log.Printf("Returning %d item(s)", body["count"])
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(responseBody),
+	}, nil
+}
+
+// parseErrorFilters validates the query string parameters.
+func parseErrorFilters(params map[string]string) (errorFilters, error) {
+	filters := errorFilters{
+		User:  strings.TrimSpace(params["user"]),
+		Limit: defaultLimit,
+	}
+
+	if errorType := strings.ToUpper(strings.TrimSpace(params["type"])); errorType != "" {
+		if !isKnownErrorType(errorType) {
+			return filters, fmt.Errorf("Invalid type, expected one of: %s", strings.Join(types.ErrorTypes, ", "))
+		}
+		filters.ErrorType = errorType
+	}
+
+	if from := strings.TrimSpace(params["from"]); from != "" {
+		if !isValidDate(from) {
+			return filters, fmt.Errorf("Invalid from, expected YYYY-MM-DD or RFC3339")
+		}
+		filters.From = from
+	}
+
+	if to := strings.TrimSpace(params["to"]); to != "" {
+		if !isValidDate(to) {
+			return filters, fmt.Errorf("Invalid to, expected YYYY-MM-DD or RFC3339")
+		}
+		// "~" sorts after every timestamp character, making the bound inclusive
+		filters.To = to + "~"
+	}
+
+	if filters.From != "" && filters.To != "" && filters.From > filters.To {
+		return filters, fmt.Errorf("Invalid range, from must not be after to")
+	}
+
+	if limit := strings.TrimSpace(params["limit"]); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return filters, fmt.Errorf("Invalid limit, expected a positive integer")
+		}
+		if n > maxLimit {
+			n = maxLimit
+		}
+		filters.Limit = n
+	}
+
+	return filters, nil
+}
+
+// queryFailures runs the cheapest query for the filters:
+//   - type: one ERROR#<type> partition (user as SK prefix)
+//   - user: GSI UserIndex restricted to ERROR# partitions
+//   - none: every ERROR# partition in types.ErrorTypes
+//
+// Failures are keyed by user and country, not by date, so the date range is
+// always a filter on createdAt.
+func queryFailures(ctx context.Context, filters errorFilters) ([]types.FalhaItem, error) {
+	var inputs []*dynamodb.QueryInput
+
+	switch {
+	case filters.ErrorType != "":
+		inputs = append(inputs, partitionQuery(filters.ErrorType, filters))
+	case filters.User != "":
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(tableName),
+			IndexName:              aws.String("UserIndex"),
+			KeyConditionExpression: aws.String("#user = :user AND begins_with(PK, :pk)"),
+			ExpressionAttributeNames: map[string]string{
+				"#user": "user",
+			},
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":user": &ddbTypes.AttributeValueMemberS{Value: filters.User},
+				":pk":   &ddbTypes.AttributeValueMemberS{Value: "ERROR#"},
+			},
+		}
+		addDateFilter(input, filters)
+		inputs = append(inputs, input)
+	default:
+		for _, errorType := range types.ErrorTypes {
+			inputs = append(inputs, partitionQuery(errorType, filters))
+		}
+	}
+
+	var falhas []types.FalhaItem
+	for _, input := range inputs {
+		items, err := queryAll(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		falhas = append(falhas, items...)
+	}
+
+	return newestFirst(falhas, filters.Limit), nil
+}
+
+// partitionQuery builds the query for a single ERROR#<type> partition.
+func partitionQuery(errorType string, filters errorFilters) *dynamodb.QueryInput {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":pk": &ddbTypes.AttributeValueMemberS{Value: "ERROR#" + errorType},
+		},
+	}
+
+	if filters.User != "" {
+		input.KeyConditionExpression = aws.String("PK = :pk AND begins_with(SK, :user)")
+		input.ExpressionAttributeValues[":user"] = &ddbTypes.AttributeValueMemberS{Value: types.FalhaUserPrefix(filters.User)}
+	}
+
+	addDateFilter(input, filters)
+	return input
+}
+
+// addDateFilter restricts a query to failures whose createdAt is within the
+// filters' date range.
+func addDateFilter(input *dynamodb.QueryInput, filters errorFilters) {
+	var conditions []string
+	if filters.From != "" {
+		conditions = append(conditions, "createdAt >= :from")
+		input.ExpressionAttributeValues[":from"] = &ddbTypes.AttributeValueMemberS{Value: filters.From}
+	}
+	if filters.To != "" {
+		conditions = append(conditions, "createdAt <= :to")
+		input.ExpressionAttributeValues[":to"] = &ddbTypes.AttributeValueMemberS{Value: filters.To}
+	}
+	if len(conditions) > 0 {
+		input.FilterExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+}
+
+// queryAll follows pagination to the end. Results are not ordered by date, so
+// the limit is applied after sorting (see newestFirst).
+func queryAll(ctx context.Context, input *dynamodb.QueryInput) ([]types.FalhaItem, error) {
+	var falhas []types.FalhaItem
+
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			var falha types.FalhaItem
+			if err := attributevalue.UnmarshalMap(item, &falha); err != nil {
+				log.Printf("Error unmarshaling item: %v", err)
+				continue
+			}
+			falhas = append(falhas, falha)
+		}
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return falhas, nil
+}
+
+// newestFirst sorts failures by createdAt descending and applies the limit.
+func newestFirst(falhas []types.FalhaItem, limit int) []types.FalhaItem {
+	sort.SliceStable(falhas, func(i, j int) bool {
+		return falhas[i].CreatedAt > falhas[j].CreatedAt
+	})
+
+	if len(falhas) > limit {
+		falhas = falhas[:limit]
+	}
+	if falhas == nil {
+		falhas = []types.FalhaItem{}
+	}
+	return falhas
+}
+
+// queryPartition reads every item of a partition into out (a pointer to a slice).
+func queryPartition(ctx context.Context, pk string, out interface{}) error {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":pk": &ddbTypes.AttributeValueMemberS{Value: pk},
+		},
+	}
+
+	var items []map[string]ddbTypes.AttributeValue
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return err
+		}
+		items = append(items, result.Items...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return attributevalue.UnmarshalListOfMaps(items, out)
+}
+
+// monthMismatches returns the readings whose country does not belong to the
+// declared month, sorted by user and country. Readings saved before the month
+// was stored are checked from their category.
+func monthMismatches(readings []types.LeituraItem) []MonthMismatch {
+	mismatches := []MonthMismatch{}
+	for _, r := range readings {
+		month := r.Mes
+		if month == 0 {
+			month = calendar.ParseCategory(r.Categoria)
+		}
+		if month == 0 || calendar.BelongsTo(r.ISO3, month) {
+			continue
+		}
+
+		mismatch := MonthMismatch{
+			User:        r.User,
+			ISO3:        r.ISO3,
+			Pais:        r.Pais,
+			Livro:       r.Livro,
+			Categoria:   r.Categoria,
+			Mes:         month,
+			WebhookUUID: r.WebhookUUID,
+		}
+		if official, ok := calendar.ForCountry(r.ISO3); ok {
+			mismatch.MesOficial = official.Number
+			mismatch.MesOficialNome = official.Name
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+
+	sort.SliceStable(mismatches, func(i, j int) bool {
+		if mismatches[i].User != mismatches[j].User {
+			return mismatches[i].User < mismatches[j].User
+		}
+		return mismatches[i].ISO3 < mismatches[j].ISO3
+	})
+	return mismatches
+}
+
+// mostFrequentFirst sorts unmapped countries by occurrences descending, then name.
+func mostFrequentFirst(unmapped []types.UnmappedCountryItem) []types.UnmappedCountryItem {
+	sort.SliceStable(unmapped, func(i, j int) bool {
+		if unmapped[i].Occurrences != unmapped[j].Occurrences {
+			return unmapped[i].Occurrences > unmapped[j].Occurrences
+		}
+		return unmapped[i].Name < unmapped[j].Name
+	})
+
+	if unmapped == nil {
+		unmapped = []types.UnmappedCountryItem{}
+	}
+	return unmapped
+}
+
+func isKnownErrorType(errorType string) bool {
+	for _, known := range types.ErrorTypes {
+		if errorType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidDate accepts YYYY-MM-DD or RFC3339.
+func isValidDate(s string) bool {
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	body, err := json.Marshal(map[string]string{
+		"error": message,
+	})
+	if err != nil {
+		log.Printf("ERROR marshaling error response: %v", err)
+		// Fallback to hardcoded JSON if marshal fails
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 500,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"INTERNAL_ERROR"}`,
+		}
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(body),
+	}
+}
+
+func main() {
+	lambda.Start(handler)
+}
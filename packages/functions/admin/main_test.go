@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+func TestParseErrorFilters(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		filters, err := parseErrorFilters(map[string]string{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if filters.ErrorType != "" || filters.User != "" {
+			t.Errorf("expected no type/user filter, got %+v", filters)
+		}
+		if filters.From != "" || filters.To != "" {
+			t.Errorf("expected open date range, got %s..%s", filters.From, filters.To)
+		}
+		if filters.Limit != defaultLimit {
+			t.Errorf("expected limit %d, got %d", defaultLimit, filters.Limit)
+		}
+	})
+
+	t.Run("all filters", func(t *testing.T) {
+		filters, err := parseErrorFilters(map[string]string{
+			"type":  "country_not_found",
+			"user":  " Test User ",
+			"from":  "2026-01-01",
+			"to":    "2026-01-31",
+			"limit": "1000",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if filters.ErrorType != types.ErrorTypeCountryNotFound {
+			t.Errorf("expected type COUNTRY_NOT_FOUND, got %q", filters.ErrorType)
+		}
+		if filters.User != "Test User" {
+			t.Errorf("expected trimmed user, got %q", filters.User)
+		}
+		if filters.From != "2026-01-01" || filters.To != "2026-01-31~" {
+			t.Errorf("unexpected range %s..%s", filters.From, filters.To)
+		}
+		if filters.Limit != maxLimit {
+			t.Errorf("expected limit capped at %d, got %d", maxLimit, filters.Limit)
+		}
+	})
+
+	invalid := []map[string]string{
+		{"type": "NOT_A_TYPE"},
+		{"from": "14/01/2026"},
+		{"to": "yesterday"},
+		{"from": "2026-02-01", "to": "2026-01-01"},
+		{"limit": "0"},
+		{"limit": "abc"},
+	}
+	for _, params := range invalid {
+		if _, err := parseErrorFilters(params); err == nil {
+			t.Errorf("expected error for %v", params)
+		}
+	}
+}
+
+func TestDateRangeIsInclusive(t *testing.T) {
+	filters, _ := parseErrorFilters(map[string]string{"from": "2026-01-14", "to": "2026-01-14"})
+
+	createdAt := "2026-01-14T23:59:59Z"
+	if createdAt < filters.From || createdAt > filters.To {
+		t.Errorf("expected %s within %s..%s", createdAt, filters.From, filters.To)
+	}
+}
+
+func TestPartitionQuery(t *testing.T) {
+	filters, _ := parseErrorFilters(map[string]string{"user": "Test User", "from": "2026-01-14"})
+
+	input := partitionQuery(types.ErrorTypeCountryNotFound, filters)
+
+	_, sk := types.FalhaKey(types.ErrorTypeCountryNotFound, "Test User", "Atlântida")
+	prefix := input.ExpressionAttributeValues[":user"].(*ddbTypes.AttributeValueMemberS).Value
+	if !strings.HasPrefix(sk, prefix) {
+		t.Errorf("expected SK %s to match user prefix %s", sk, prefix)
+	}
+	if _, sk := types.FalhaKey(types.ErrorTypeCountryNotFound, "Test User 2", ""); strings.HasPrefix(sk, prefix) {
+		t.Errorf("expected another user's SK %s not to match %s", sk, prefix)
+	}
+	if input.FilterExpression == nil || *input.FilterExpression != "createdAt >= :from" {
+		t.Errorf("expected a createdAt lower bound, got %v", input.FilterExpression)
+	}
+}
+
+func TestNewestFirst(t *testing.T) {
+	falhas := []types.FalhaItem{
+		{SK: "USER#a#", CreatedAt: "2026-01-10T00:00:00Z"},
+		{SK: "USER#b#", CreatedAt: "2026-01-12T00:00:00Z"},
+		{SK: "USER#c#", CreatedAt: "2026-01-11T00:00:00Z"},
+	}
+
+	result := newestFirst(falhas, 2)
+
+	if len(result) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(result))
+	}
+	if result[0].SK != "USER#b#" || result[1].SK != "USER#c#" {
+		t.Errorf("unexpected order: %v", result)
+	}
+
+	if empty := newestFirst(nil, 10); empty == nil || len(empty) != 0 {
+		t.Errorf("expected empty non-nil slice, got %v", empty)
+	}
+}
+
+func TestMostFrequentFirst(t *testing.T) {
+	unmapped := []types.UnmappedCountryItem{
+		{Name: "Brasiu", Occurrences: 2},
+		{Name: "Atlântida", Occurrences: 5},
+		{Name: "Alemanhã", Occurrences: 2},
+	}
+
+	result := mostFrequentFirst(unmapped)
+
+	if result[0].Name != "Atlântida" || result[1].Name != "Alemanhã" || result[2].Name != "Brasiu" {
+		t.Errorf("unexpected order: %v", result)
+	}
+
+	if empty := mostFrequentFirst(nil); empty == nil || len(empty) != 0 {
+		t.Errorf("expected empty non-nil slice, got %v", empty)
+	}
+}
+
+func TestMonthMismatches(t *testing.T) {
+	readings := []types.LeituraItem{
+		{User: "Maria", ISO3: "JPN", Categoria: "Novembro", Mes: 11, MesDivergente: true},
+		{User: "Ana", ISO3: "CHL", Categoria: "Janeiro", Mes: 1},
+		{User: "Ana", ISO3: "PER", Categoria: "Março"}, // saved before the month was stored
+		{User: "Ana", ISO3: "BRA", Categoria: "Bônus"}, // not a month
+	}
+
+	got := monthMismatches(readings)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 mismatches, got %+v", got)
+	}
+	if got[0].User != "Ana" || got[0].ISO3 != "PER" || got[0].Mes != 3 || got[0].MesOficial != 1 {
+		t.Errorf("unexpected first mismatch: %+v", got[0])
+	}
+	if got[1].User != "Maria" || got[1].MesOficialNome != "Fevereiro" {
+		t.Errorf("unexpected second mismatch: %+v", got[1])
+	}
+}
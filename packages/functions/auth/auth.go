@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -18,8 +19,19 @@ type APIKeyItem struct {
 	Key       string `dynamodbav:"key"`
 	CreatedAt string `dynamodbav:"createdAt"`
 	Active    bool   `dynamodbav:"active"`
+
+	// SigningSecret enables HMAC signature verification for this key (optional).
+	// Keys without a secret are accepted with the API key alone.
+	SigningSecret string `dynamodbav:"signingSecret,omitempty"`
 }
 
+// Key partitions. Admin keys live apart from API keys, so a key shipped to the
+// frontend (NEXT_PUBLIC_API_KEY) can never unlock the /admin endpoints.
+const (
+	APIKeyPrefix   = "APIKEY#"
+	AdminKeyPrefix = "ADMINKEY#"
+)
+
 // DynamoDBScanAPI defines the interface for DynamoDB Scan operation
 type DynamoDBScanAPI interface {
 	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
@@ -27,15 +39,36 @@ type DynamoDBScanAPI interface {
 
 // ValidateAPIKey checks if the provided API key is valid and active
 func ValidateAPIKey(ctx context.Context, client DynamoDBScanAPI, apiKey string) bool {
+	_, ok := LookupAPIKey(ctx, client, apiKey)
+	return ok
+}
+
+// LookupAPIKey returns the stored item for a valid and active API key.
+// Callers that need per-key settings (e.g. the signing secret) should use this
+// instead of ValidateAPIKey.
+func LookupAPIKey(ctx context.Context, client DynamoDBScanAPI, apiKey string) (*APIKeyItem, bool) {
+	return lookupKey(ctx, client, APIKeyPrefix, apiKey)
+}
+
+// ValidateAdminKey checks if the provided key is a valid and active admin key
+// (ADMINKEY#*). Regular API keys are rejected.
+func ValidateAdminKey(ctx context.Context, client DynamoDBScanAPI, adminKey string) bool {
+	_, ok := lookupKey(ctx, client, AdminKeyPrefix, adminKey)
+	return ok
+}
+
+// lookupKey returns the stored item for a valid and active key in the
+// partitions starting with prefix.
+func lookupKey(ctx context.Context, client DynamoDBScanAPI, prefix, apiKey string) (*APIKeyItem, bool) {
 	if apiKey == "" {
 		log.Printf("API key validation failed: empty key")
-		return false
+		return nil, false
 	}
 
 	tableName := os.Getenv("SST_Resource_DataTable_name")
 	if tableName == "" {
 		log.Printf("ERROR: SST_Resource_DataTable_name is empty")
-		return false
+		return nil, false
 	}
 
 	// Scan DynamoDB for all active API keys (filter expression has issues, so we validate in code)
@@ -46,14 +79,14 @@ func ValidateAPIKey(ctx context.Context, client DynamoDBScanAPI, apiKey string)
 			"#active": "active",
 		},
 		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
-			":pk":     &ddbTypes.AttributeValueMemberS{Value: "APIKEY#"},
+			":pk":     &ddbTypes.AttributeValueMemberS{Value: prefix},
 			":active": &ddbTypes.AttributeValueMemberBOOL{Value: true},
 		},
 	})
 
 	if err != nil {
 		log.Printf("ERROR validating API key: %v", err)
-		return false
+		return nil, false
 	}
 
 	// Iterate through results and match the key in code
@@ -65,12 +98,12 @@ func ValidateAPIKey(ctx context.Context, client DynamoDBScanAPI, apiKey string)
 		}
 
 		// Check if this key matches and is active
-		if apiKeyItem.Key == apiKey && apiKeyItem.Active {
+		if apiKeyItem.Key == apiKey && apiKeyItem.Active && strings.HasPrefix(apiKeyItem.PK, prefix) {
 			log.Printf("API key validated successfully: %s", apiKeyItem.Name)
-			return true
+			return &apiKeyItem, true
 		}
 	}
 
 	log.Printf("API key validation failed: invalid or inactive key")
-	return false
+	return nil, false
 }
@@ -360,3 +360,82 @@ func BenchmarkValidateAPIKey_ValidKey(b *testing.B) {
 		ValidateAPIKey(ctx, mockClient, validAPIKey)
 	}
 }
+
+func TestLookupAPIKey_ReturnsSigningSecret(t *testing.T) {
+	os.Setenv("SST_Resource_DataTable_name", "test-table")
+	defer os.Unsetenv("SST_Resource_DataTable_name")
+
+	mockClient := &MockDynamoDBClient{
+		ScanFunc: func(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			item := APIKeyItem{
+				PK:            "APIKEY#maratona",
+				SK:            "KEY#1",
+				Name:          "maratona",
+				Key:           "signed-key",
+				Active:        true,
+				SigningSecret: "s3cr3t",
+			}
+
+			itemMap, err := attributevalue.MarshalMap(item)
+			if err != nil {
+				t.Fatalf("Failed to marshal item: %v", err)
+			}
+
+			return &dynamodb.ScanOutput{
+				Items: []map[string]ddbTypes.AttributeValue{itemMap},
+			}, nil
+		},
+	}
+
+	item, ok := LookupAPIKey(context.Background(), mockClient, "signed-key")
+	if !ok {
+		t.Fatal("Expected key to be found")
+	}
+
+	if item.SigningSecret != "s3cr3t" {
+		t.Errorf("Expected signing secret 's3cr3t', got '%s'", item.SigningSecret)
+	}
+
+	if _, ok := LookupAPIKey(context.Background(), mockClient, "other-key"); ok {
+		t.Error("Expected unknown key to be rejected")
+	}
+}
+
+func TestValidateAdminKey_RejectsAPIKeys(t *testing.T) {
+	os.Setenv("SST_Resource_DataTable_name", "test-table")
+	defer os.Unsetenv("SST_Resource_DataTable_name")
+
+	var scannedPrefix string
+	mockClient := &MockDynamoDBClient{
+		ScanFunc: func(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			scannedPrefix = params.ExpressionAttributeValues[":pk"].(*ddbTypes.AttributeValueMemberS).Value
+
+			// Returned regardless of the filter, as if it were not applied
+			var items []map[string]ddbTypes.AttributeValue
+			for _, item := range []APIKeyItem{
+				{PK: "APIKEY#frontend", SK: "KEY#1", Key: "public-key", Active: true},
+				{PK: "ADMINKEY#ops", SK: "KEY#2", Key: "admin-key", Active: true},
+			} {
+				itemMap, err := attributevalue.MarshalMap(item)
+				if err != nil {
+					t.Fatalf("Failed to marshal item: %v", err)
+				}
+				items = append(items, itemMap)
+			}
+			return &dynamodb.ScanOutput{Items: items}, nil
+		},
+	}
+
+	if !ValidateAdminKey(context.Background(), mockClient, "admin-key") {
+		t.Error("Expected admin key to be accepted")
+	}
+	if scannedPrefix != AdminKeyPrefix {
+		t.Errorf("Expected scan of %q, got %q", AdminKeyPrefix, scannedPrefix)
+	}
+	if ValidateAdminKey(context.Background(), mockClient, "public-key") {
+		t.Error("Expected the frontend API key to be rejected for admin")
+	}
+	if ValidateAPIKey(context.Background(), mockClient, "admin-key") {
+		t.Error("Expected admin key not to be a regular API key")
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature headers sent by clients whose API key has a signing secret.
+//
+// The signature is HMAC-SHA256(secret, "<timestamp>.<body>") encoded as hex,
+// optionally prefixed with "sha256=". The timestamp is Unix time in seconds.
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	signaturePrefix          = "sha256="
+)
+
+// DefaultSignatureTolerance is the maximum accepted clock skew between the
+// signature timestamp and the server time.
+const DefaultSignatureTolerance = 5 * time.Minute
+
+var (
+	// ErrMissingSignature indicates the signature or timestamp header is absent.
+	ErrMissingSignature = errors.New("missing signature headers")
+
+	// ErrInvalidSignatureTimestamp indicates the timestamp is not Unix seconds.
+	ErrInvalidSignatureTimestamp = errors.New("invalid signature timestamp")
+
+	// ErrSignatureExpired indicates the timestamp is outside the tolerance window.
+	ErrSignatureExpired = errors.New("signature timestamp outside tolerance window")
+
+	// ErrInvalidSignature indicates the signature does not match the body.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// ComputeSignature returns the hex-encoded HMAC-SHA256 of "<timestamp>.<body>".
+func ComputeSignature(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a request signature against the key's signing secret.
+// It returns the signing time on success so callers can size replay windows.
+func VerifySignature(secret, timestamp, body, signature string, now time.Time, tolerance time.Duration) (time.Time, error) {
+	if timestamp == "" || signature == "" {
+		return time.Time{}, ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidSignatureTimestamp
+	}
+	signedAt := time.Unix(seconds, 0)
+
+	skew := now.Sub(signedAt)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > tolerance {
+		return time.Time{}, ErrSignatureExpired
+	}
+
+	given, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(signature), signaturePrefix))
+	if err != nil {
+		return time.Time{}, ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(ComputeSignature(secret, timestamp, body))
+	if !hmac.Equal(given, expected) {
+		return time.Time{}, ErrInvalidSignature
+	}
+
+	return signedAt, nil
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestComputeSignature_Deterministic(t *testing.T) {
+	a := ComputeSignature("secret", "1768384800", `{"perfil":{}}`)
+	b := ComputeSignature("secret", "1768384800", `{"perfil":{}}`)
+
+	if a != b {
+		t.Errorf("Expected identical signatures, got %s and %s", a, b)
+	}
+
+	if len(a) != 64 {
+		t.Errorf("Expected 64 hex chars, got %d", len(a))
+	}
+
+	if c := ComputeSignature("other-secret", "1768384800", `{"perfil":{}}`); c == a {
+		t.Error("Expected different secrets to produce different signatures")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Unix(1768384800, 0)
+	secret := "test-secret"
+	body := `{"perfil":{"nome":"Test User"}}`
+	ts := strconv.FormatInt(now.Unix(), 10)
+	valid := ComputeSignature(secret, ts, body)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		body      string
+		signature string
+		now       time.Time
+		wantErr   error
+	}{
+		{
+			name:      "Valid signature",
+			timestamp: ts,
+			body:      body,
+			signature: valid,
+			now:       now,
+		},
+		{
+			name:      "Valid signature with sha256 prefix",
+			timestamp: ts,
+			body:      body,
+			signature: "sha256=" + valid,
+			now:       now,
+		},
+		{
+			name:      "Within tolerance",
+			timestamp: ts,
+			body:      body,
+			signature: valid,
+			now:       now.Add(4 * time.Minute),
+		},
+		{
+			name:      "Missing signature",
+			timestamp: ts,
+			body:      body,
+			now:       now,
+			wantErr:   ErrMissingSignature,
+		},
+		{
+			name:      "Missing timestamp",
+			body:      body,
+			signature: valid,
+			now:       now,
+			wantErr:   ErrMissingSignature,
+		},
+		{
+			name:      "Non-numeric timestamp",
+			timestamp: "2026-01-14T10:00:00Z",
+			body:      body,
+			signature: valid,
+			now:       now,
+			wantErr:   ErrInvalidSignatureTimestamp,
+		},
+		{
+			name:      "Expired timestamp",
+			timestamp: ts,
+			body:      body,
+			signature: valid,
+			now:       now.Add(10 * time.Minute),
+			wantErr:   ErrSignatureExpired,
+		},
+		{
+			name:      "Timestamp in the future",
+			timestamp: ts,
+			body:      body,
+			signature: valid,
+			now:       now.Add(-10 * time.Minute),
+			wantErr:   ErrSignatureExpired,
+		},
+		{
+			name:      "Tampered body",
+			timestamp: ts,
+			body:      `{"perfil":{"nome":"Attacker"}}`,
+			signature: valid,
+			now:       now,
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "Malformed signature",
+			timestamp: ts,
+			body:      body,
+			signature: "not-hex",
+			now:       now,
+			wantErr:   ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signedAt, err := VerifySignature(secret, tt.timestamp, tt.body, tt.signature, tt.now, DefaultSignatureTolerance)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !signedAt.Equal(now) {
+				t.Errorf("Expected signedAt %v, got %v", now, signedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package calendar holds the official marathon calendar: which countries are
+// read in each month of the Maratona.app challenge. It is the source of truth
+// for the month assignment; src/config/months.js mirrors it for the frontend.
+package calendar
+
+import (
+	"strings"
+
+	"github.com/mundotalendo/functions/utils"
+)
+
+// Month is a month of the marathon and the countries assigned to it.
+type Month struct {
+	Number    int      `json:"number"`    // 1-12
+	Name      string   `json:"name"`      // Nome do mês em português
+	Color     string   `json:"color"`     // Cor do mês no mapa (tier5 no frontend)
+	Countries []string `json:"countries"` // Códigos ISO3 dos países do mês
+}
+
+// Months lists the marathon months in calendar order.
+var Months = []Month{
+	{1, "Janeiro", "#FF1744", []string{"BRA", "GUF", "SUR", "GUY", "VEN", "COL", "ECU", "PER", "BOL", "CHL", "PRY", "ARG", "URY"}},
+	{2, "Fevereiro", "#00E5FF", []string{"CHN", "JPN", "KOR", "PRK", "PHL", "IDN", "BTN", "MNG", "LAO", "NPL", "VNM", "BRN", "MYS", "TLS", "KAZ", "KHM", "THA", "MMR", "SGP", "TWN"}},
+	{3, "Março", "#FFD600", []string{"PRT", "ESP", "FRA", "AND", "MCO", "ITA", "MLT", "VAT", "SMR"}},
+	{4, "Abril", "#00E676", []string{"GNQ", "GAB", "COG", "COD", "UGA", "KEN", "RWA", "BDI", "TZA", "AGO", "ZMB", "MWI", "MOZ", "ZWE", "BWA", "NAM", "ZAF", "LSO", "SWZ", "MDG", "STP", "MUS", "SYC", "COM"}},
+	{5, "Maio", "#FF6F00", []string{"GTM", "BLZ", "SLV", "HND", "NIC", "CRI", "PAN", "BHS", "CUB", "JAM", "HTI", "DOM", "PRI", "KNA", "ATG", "MSR", "DMA", "LCA", "BRB", "GRD", "TTO", "VCT"}},
+	{6, "Junho", "#D500F9", []string{"GBR", "IRL", "ISL", "NOR", "SWE", "FIN"}},
+	{7, "Julho", "#2979FF", []string{"USA", "CAN", "MEX", "GRL"}},
+	{8, "Agosto", "#FF4081", []string{"AUS", "PNG", "NZL", "FJI", "SLB", "VUT", "WSM", "KIR", "TON", "FSM", "PLW", "MHL", "NRU", "TUV"}},
+	{9, "Setembro", "#1DE9B6", []string{"CHE", "BEL", "LUX", "NLD", "DEU", "DNK", "POL", "CZE", "AUT", "LIE"}},
+	{10, "Outubro", "#FF9100", []string{"SVK", "HUN", "SVN", "HRV", "BIH", "MNE", "SRB", "ALB", "GRC", "MKD", "BGR", "ROU", "MDA", "UKR", "BLR", "LTU", "LVA", "EST", "RUS"}},
+	{11, "Novembro", "#651FFF", []string{"MAR", "DZA", "TUN", "ESH", "MRT", "SEN", "GMB", "GNB", "GIN", "SLE", "LBR", "CIV", "MLI", "BFA", "GHA", "TGO", "BEN", "NER", "NGA", "LBY", "TCD", "CMR", "CAF", "EGY", "SDN", "SSD", "ETH", "SOM", "ERI", "DJI", "CPV"}},
+	{12, "Dezembro", "#F50057", []string{"TUR", "CYP", "LBN", "ISR", "PSE", "JOR", "SYR", "IRQ", "IRN", "GEO", "ARM", "AZE", "TKM", "UZB", "AFG", "TJK", "KGZ", "PAK", "SAU", "KWT", "BHR", "QAT", "ARE", "OMN", "YEM", "IND", "LKA", "MDV", "BGD"}},
+}
+
+// ByNumber returns the month with the given number (1-12).
+func ByNumber(number int) (Month, bool) {
+	if number < 1 || number > len(Months) {
+		return Month{}, false
+	}
+	return Months[number-1], true
+}
+
+// ForCountry returns the month the country is assigned to.
+func ForCountry(iso3 string) (Month, bool) {
+	for _, month := range Months {
+		for _, country := range month.Countries {
+			if country == iso3 {
+				return month, true
+			}
+		}
+	}
+	return Month{}, false
+}
+
+// ParseCategory returns the month number of a desafio category, as sent by
+// Maratona.app ("🌈Novembro", "Março", "MARCO"), or 0 if it is not a month.
+func ParseCategory(categoria string) int {
+	name := foldName(utils.CleanEmojis(categoria))
+	for _, month := range Months {
+		if foldName(month.Name) == name {
+			return month.Number
+		}
+	}
+	return 0
+}
+
+// MonthComplete reports whether a month is fully completed, given the best
+// progress of each country read in it: every one of them must be at 100%.
+// GET /leaderboard and GET /users/{name} share this rule.
+func MonthComplete(countries map[string]int) bool {
+	if len(countries) == 0 {
+		return false
+	}
+	for _, progress := range countries {
+		if progress != 100 {
+			return false
+		}
+	}
+	return true
+}
+
+// BelongsTo reports whether the country is assigned to the month.
+func BelongsTo(iso3 string, number int) bool {
+	month, ok := ForCountry(iso3)
+	return ok && month.Number == number
+}
+
+// foldName lowercases a month name and drops the only accent used in month
+// names, so "Março" and "MARCO" compare equal.
+func foldName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "ç", "c")
+}
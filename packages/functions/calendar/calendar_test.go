@@ -0,0 +1,104 @@
+package calendar
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mundotalendo/functions/mapping"
+)
+
+func TestMonths_EveryCountryOnce(t *testing.T) {
+	seen := make(map[string]string)
+	for i, month := range Months {
+		if month.Number != i+1 {
+			t.Errorf("%s: expected number %d, got %d", month.Name, i+1, month.Number)
+		}
+		for _, iso3 := range month.Countries {
+			if other, dup := seen[iso3]; dup {
+				t.Errorf("%s assigned to both %s and %s", iso3, other, month.Name)
+			}
+			seen[iso3] = month.Name
+		}
+	}
+
+	for _, iso3 := range mapping.NameToIso {
+		if _, ok := seen[iso3]; !ok {
+			t.Errorf("%s is mapped but not assigned to any month", iso3)
+		}
+	}
+}
+
+// TestMonths_MatchFrontend keeps src/config/months.js in sync with the calendar.
+func TestMonths_MatchFrontend(t *testing.T) {
+	data, err := os.ReadFile("../../../src/config/months.js")
+	if err != nil {
+		t.Skipf("frontend calendar not available: %v", err)
+	}
+
+	re := regexp.MustCompile(`name: '([^']+)',\s*color: '([^']+)'[\s\S]*?countries: \[([^\]]*)\]`)
+	matches := re.FindAllStringSubmatch(string(data), -1)
+	if len(matches) != len(Months) {
+		t.Fatalf("expected %d months in months.js, found %d", len(Months), len(matches))
+	}
+
+	for i, m := range matches {
+		month := Months[i]
+		if m[1] != month.Name || m[2] != month.Color {
+			t.Errorf("month %d: months.js has %s %s, expected %s %s", month.Number, m[1], m[2], month.Name, month.Color)
+		}
+		countries := strings.Join(month.Countries, ",")
+		if js := strings.NewReplacer("'", "", " ", "").Replace(m[3]); js != countries {
+			t.Errorf("%s: months.js has %s, expected %s", month.Name, js, countries)
+		}
+	}
+}
+
+func TestParseCategory(t *testing.T) {
+	tests := []struct {
+		categoria string
+		want      int
+	}{
+		{"🌈Novembro", 11},
+		{"Janeiro", 1},
+		{" Março ", 3},
+		{"MARCO", 3},
+		{"dezembro", 12},
+		{"Bônus", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := ParseCategory(tt.categoria); got != tt.want {
+			t.Errorf("ParseCategory(%q) = %d, want %d", tt.categoria, got, tt.want)
+		}
+	}
+}
+
+func TestBelongsTo(t *testing.T) {
+	if !BelongsTo("CHL", 1) {
+		t.Error("expected Chile in Janeiro")
+	}
+	if BelongsTo("JPN", 1) {
+		t.Error("expected Japan not in Janeiro")
+	}
+	if BelongsTo("XXX", 1) {
+		t.Error("expected unknown country not to belong to any month")
+	}
+	if _, ok := ByNumber(13); ok {
+		t.Error("expected no month 13")
+	}
+}
+
+func TestMonthComplete(t *testing.T) {
+	if !MonthComplete(map[string]int{"CHL": 100, "ARG": 100}) {
+		t.Error("expected month with every country at 100% to be complete")
+	}
+	if MonthComplete(map[string]int{"CHL": 100, "ARG": 0}) {
+		t.Error("expected a country not started to block the month")
+	}
+	if MonthComplete(nil) {
+		t.Error("expected a month without countries not to be complete")
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/httpcache"
+	"github.com/mundotalendo/functions/types"
 )
 
 var (
@@ -69,6 +71,47 @@ func clearTable(ctx context.Context, tableName, pk string) (int, error) {
 	return count, nil
 }
 
+// clearPrefix deletes every item whose PK starts with prefix, for data kept in
+// one partition per user or country.
+func clearPrefix(ctx context.Context, tableName, prefix string) (int, error) {
+	count := 0
+	var startKey map[string]ddbTypes.AttributeValue
+	for {
+		result, err := dynamoClient.Scan(ctx, &dynamodb.ScanInput{
+			TableName:            &tableName,
+			FilterExpression:     aws.String("begins_with(PK, :prefix)"),
+			ProjectionExpression: aws.String("PK, SK"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":prefix": &ddbTypes.AttributeValueMemberS{Value: prefix},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return count, err
+		}
+
+		for _, item := range result.Items {
+			_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: &tableName,
+				Key: map[string]ddbTypes.AttributeValue{
+					"PK": item["PK"],
+					"SK": item["SK"],
+				},
+			})
+			if err != nil {
+				log.Printf("Error deleting item: %v", err)
+				continue
+			}
+			count++
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return count, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
 func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	log.Println("Clearing all data from table")
 
@@ -93,18 +136,61 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 		log.Printf("Error clearing events: %v", err)
 	}
 
+	activitiesDeleted, err := clearTable(ctx, tableName, types.ActivityPartition)
+	if err != nil {
+		log.Printf("Error clearing activities: %v", err)
+	}
+
+	aggregatesDeleted, err := clearTable(ctx, tableName, types.CountryAggregatePartition)
+	if err != nil {
+		log.Printf("Error clearing aggregates: %v", err)
+	}
+
+	// Derived data: per-country history, first readers and per-user ordering
+	// state would otherwise outlive the readings they were built from
+	historyDeleted, err := clearPrefix(ctx, tableName, types.HistoryPartitionPrefix)
+	if err != nil {
+		log.Printf("Error clearing history: %v", err)
+	}
+
+	communityDeleted, err := clearTable(ctx, tableName, types.CommunityCountryPartition)
+	if err != nil {
+		log.Printf("Error clearing community countries: %v", err)
+	}
+
+	userStatesDeleted, err := clearPrefix(ctx, tableName, "USERSTATE#")
+	if err != nil {
+		log.Printf("Error clearing user states: %v", err)
+	}
+
 	errorsDeleted := 0
-	errorTypes := []string{"COUNTRY_NOT_FOUND", "METADATA_MARSHAL_ERROR", "DYNAMODB_MARSHAL_ERROR", "DYNAMODB_PUT_ERROR"}
-	for _, errorType := range errorTypes {
+	for _, errorType := range types.ErrorTypes {
 		count, _ := clearTable(ctx, tableName, "ERROR#"+errorType)
 		errorsDeleted += count
 	}
 
+	// Forget payload hashes so resending after a clear is not a duplicate
+	idempotencyDeleted, err := clearPrefix(ctx, tableName, "IDEMPOTENCY#")
+	if err != nil {
+		log.Printf("Error clearing idempotency keys: %v", err)
+	}
+
+	if err := httpcache.Bump(ctx, dynamoClient, tableName); err != nil {
+		log.Printf("WARN: Failed to bump data version: %v", err)
+	}
+
 	response := map[string]interface{}{
-		"success":        true,
-		"eventsDeleted":  eventsDeleted,
-		"errorsDeleted":  errorsDeleted,
-		"totalDeleted":   eventsDeleted + errorsDeleted,
+		"success":            true,
+		"eventsDeleted":      eventsDeleted,
+		"activitiesDeleted":  activitiesDeleted,
+		"aggregatesDeleted":  aggregatesDeleted,
+		"historyDeleted":     historyDeleted,
+		"communityDeleted":   communityDeleted,
+		"userStatesDeleted":  userStatesDeleted,
+		"errorsDeleted":      errorsDeleted,
+		"idempotencyDeleted": idempotencyDeleted,
+		"totalDeleted": eventsDeleted + activitiesDeleted + aggregatesDeleted + historyDeleted +
+			communityDeleted + userStatesDeleted + errorsDeleted + idempotencyDeleted,
 	}
 
 	responseBody, err := json.Marshal(response)
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/calendar"
+	"github.com/mundotalendo/functions/mapping"
+	"github.com/mundotalendo/functions/types"
+	"github.com/mundotalendo/functions/utils"
+)
+
+// DesafioTypeActivity is the desafio type of activities, which are not books
+// and are stored apart from the readings (EVENT#ATIVIDADE).
+const DesafioTypeActivity = "atividade"
+
+// ActivityStore handles DynamoDB operations for activity data.
+// Activities are replaced per user the same way readings are.
+type ActivityStore struct {
+	items *LeituraStore // replacement logic, on the activity partition
+}
+
+// NewActivityStore creates a new ActivityStore with the given DynamoDB client and table name.
+func NewActivityStore(client DynamoDBClient, tableName string) *ActivityStore {
+	return &ActivityStore{
+		items: NewLeituraStore(client, tableName).WithPartition(types.ActivityPartition),
+	}
+}
+
+// UserActivities returns all activities of a user.
+//
+// Returns:
+//   - error: ErrDynamoDBRead if the query fails
+func (s *ActivityStore) UserActivities(ctx context.Context, user string) ([]types.AtividadeItem, error) {
+	avs, err := s.items.queryUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var activities []types.AtividadeItem
+	for _, av := range avs {
+		var activity types.AtividadeItem
+		if err := attributevalue.UnmarshalMap(av, &activity); err != nil || activity.PK == "" || activity.SK == "" {
+			log.Printf("WARN: Invalid item structure, skipping")
+			continue
+		}
+		activities = append(activities, activity)
+	}
+
+	return activities, nil
+}
+
+// ReplaceUserActivities replaces all activities of a user with items, with the
+// same transaction, guard and unchanged-item semantics as
+// LeituraStore.ReplaceUserReadings. The data version is only bumped when
+// something was written.
+//
+// Returns:
+//   - error: ErrDynamoDBRead if existing activities cannot be listed,
+//     ErrSuperseded if a guard condition fails,
+//     ErrTooManyChanges if the change does not fit in one transaction,
+//     ErrDynamoDBWrite if the write fails
+func (s *ActivityStore) ReplaceUserActivities(ctx context.Context, user string, items []types.AtividadeItem, guards ...ddbtypes.TransactWriteItem) error {
+	previous, err := s.UserActivities(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[readingKey]types.AtividadeItem, len(previous))
+	for _, activity := range previous {
+		stored[readingKey{PK: activity.PK, SK: activity.SK}] = activity
+	}
+
+	unchanged := make(map[readingKey]bool)
+	avs := make([]map[string]ddbtypes.AttributeValue, 0, len(items))
+	for _, item := range items {
+		item.PK = types.ActivityPartition
+		key := readingKey{PK: item.PK, SK: item.SK}
+		if current, exists := stored[key]; exists && sameActivity(current, item) {
+			unchanged[key] = true
+			continue
+		}
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return fmt.Errorf("marshal error: %w", err)
+		}
+		avs = append(avs, av)
+	}
+
+	previousKeys := make([]readingKey, 0, len(previous))
+	for _, activity := range previous {
+		key := readingKey{PK: activity.PK, SK: activity.SK}
+		if !unchanged[key] {
+			previousKeys = append(previousKeys, key)
+		}
+	}
+
+	wrote, err := s.items.replaceUserItems(ctx, user, avs, previousKeys, nil, guards)
+	if err != nil {
+		return err
+	}
+	if wrote {
+		s.items.bumpDataVersion(ctx)
+	}
+	return nil
+}
+
+// sameActivity reports whether an activity would be stored unchanged, ignoring
+// the UUID of the webhook that sent it and its update date, as sameReading.
+func sameActivity(stored, item types.AtividadeItem) bool {
+	stored.WebhookUUID, item.WebhookUUID = "", ""
+	stored.UpdatedAt, item.UpdatedAt = "", ""
+	return stored == item
+}
+
+// buildActivity converts an "atividade" desafio into an AtividadeItem.
+// The description is kept as sent; when it names a known country the ISO3 is
+// recorded, but an unknown name is not an error. Progress is the highest
+// progress among the linked books (100 when the desafio is Concluido).
+func buildActivity(desafio types.Desafio, index int, desafioID string, meta ProcessingMeta, resolver *mapping.Resolver) (types.AtividadeItem, ProcessingResult) {
+	descricao := utils.CleanEmojis(desafio.Descricao)
+	categoria := utils.CleanEmojis(desafio.Categoria)
+	iso3 := resolver.GetISO(descricao)
+
+	progress := 0
+	var updatedAt time.Time
+	for _, book := range extractBooks(desafio, meta.Timestamp) {
+		progress = max(progress, book.Progress)
+		if book.UpdatedAt.After(updatedAt) {
+			updatedAt = book.UpdatedAt
+		}
+	}
+
+	activity := types.AtividadeItem{
+		PK:          types.ActivityPartition,
+		SK:          readingSK(meta.User, desafioID, "ATIVIDADE", index, ""),
+		User:        meta.User,
+		ImagemURL:   meta.AvatarURL,
+		Descricao:   descricao,
+		ISO3:        iso3,
+		Categoria:   categoria,
+		Mes:         calendar.ParseCategory(categoria),
+		Concluido:   desafio.Concluido,
+		Progresso:   progress,
+		Vinculados:  len(desafio.Vinculados),
+		WebhookUUID: meta.UUID,
+		UpdatedAt:   updatedAt.Format(time.RFC3339),
+	}
+
+	return activity, ProcessingResult{
+		ISO3:      iso3,
+		Country:   descricao,
+		Processed: true,
+		Activity:  true,
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+func TestProcessAll_StoresActivitiesApart(t *testing.T) {
+	payload := &types.WebhookPayload{
+		Desafios: []types.Desafio{
+			{ID: "d1", Descricao: "Chile", Categoria: "Janeiro", Tipo: "leitura", Vinculados: []types.Vinculado{{ID: "v1", Progresso: 40}}},
+			{ID: "d2", Descricao: "🇵🇹Portugal", Categoria: "Março", Tipo: "atividade", Concluido: true},
+			{ID: "d3", Descricao: "Ler um clássico", Categoria: "Março", Tipo: "atividade", Vinculados: []types.Vinculado{
+				{ID: "v2", Progresso: 30, UpdatedAt: "2026-03-02"},
+				{ID: "v3", Progresso: 60, UpdatedAt: "2026-03-05"},
+			}},
+		},
+	}
+	dynamoClient := &mockDynamoDBClient{}
+	processor := NewDesafioProcessor(NewLeituraStore(dynamoClient, "test-table"), nil, nil, nil, nil, NewActivityStore(dynamoClient, "test-table"))
+
+	processed, errCount, results := processor.ProcessAll(context.Background(), payload, ProcessingMeta{UUID: "test-uuid", User: "Ana"})
+
+	if processed != 3 || errCount != 0 {
+		t.Fatalf("expected 3 processed and no errors (activities are not countries), got %d/%d: %+v", processed, errCount, results)
+	}
+	if len(dynamoClient.transacts) != 2 {
+		t.Fatalf("expected readings and activities in separate transactions, got %d", len(dynamoClient.transacts))
+	}
+	if n := len(dynamoClient.transacts[0].TransactItems); n != 1 {
+		t.Errorf("expected only the leitura among the readings, got %d", n)
+	}
+
+	var activities []types.AtividadeItem
+	for _, item := range dynamoClient.transacts[1].TransactItems {
+		var activity types.AtividadeItem
+		attributevalue.UnmarshalMap(item.Put.Item, &activity)
+		activities = append(activities, activity)
+	}
+	if len(activities) != 2 {
+		t.Fatalf("expected 2 activities, got %d", len(activities))
+	}
+	if a := activities[0]; a.PK != types.ActivityPartition || a.SK != "Ana#d2" || a.ISO3 != "PRT" || a.Progresso != 100 || a.Mes != 3 {
+		t.Errorf("unexpected completed activity: %+v", a)
+	}
+	if a := activities[1]; a.ISO3 != "" || a.Progresso != 60 || a.Vinculados != 2 || a.UpdatedAt != "2026-03-05T00:00:00Z" {
+		t.Errorf("unexpected activity with books: %+v", a)
+	}
+}
+
+func TestProcessAll_IdenticalResendWritesNothing(t *testing.T) {
+	payload := &types.WebhookPayload{
+		Desafios: []types.Desafio{
+			{ID: "d1", Descricao: "Chile", Categoria: "Janeiro", Tipo: "leitura", Vinculados: []types.Vinculado{{ID: "v1", Progresso: 40}}},
+			{ID: "d2", Descricao: "Peru", Categoria: "Fevereiro", Tipo: "leitura"}, // no books yet
+			{ID: "d3", Descricao: "Ler um clássico", Categoria: "Março", Tipo: "atividade"},
+		},
+	}
+	dynamoClient := &mockDynamoDBClient{}
+	processor := NewDesafioProcessor(NewLeituraStore(dynamoClient, "test-table"), nil, nil, nil, nil, NewActivityStore(dynamoClient, "test-table"))
+
+	first := ProcessingMeta{UUID: "uuid-1", User: "Ana", Timestamp: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	if _, errCount, results := processor.ProcessAll(context.Background(), payload, first); errCount != 0 {
+		t.Fatalf("unexpected errors: %+v", results)
+	}
+
+	// Serve the stored items back, as the table would
+	dynamoClient.partitions = map[string][]map[string]ddbtypes.AttributeValue{
+		"EVENT#LEITURA":         dynamoClient.transactPutsWithPrefix("EVENT#LEITURA"),
+		types.ActivityPartition: dynamoClient.transactPutsWithPrefix(types.ActivityPartition),
+	}
+	transacts, bumps := len(dynamoClient.transacts), dynamoClient.bumps
+
+	second := ProcessingMeta{UUID: "uuid-2", User: "Ana", Timestamp: first.Timestamp.Add(time.Hour)}
+	if _, errCount, results := processor.ProcessAll(context.Background(), payload, second); errCount != 0 {
+		t.Fatalf("unexpected errors: %+v", results)
+	}
+
+	if n := len(dynamoClient.transacts) - transacts; n != 0 {
+		t.Errorf("expected the identical resend to write nothing, got %d transactions", n)
+	}
+	if n := dynamoClient.bumps - bumps; n != 0 {
+		t.Errorf("expected the identical resend to keep the data version, got %d bumps", n)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/utils"
+)
+
+// RedriveRequest is the body of POST /admin/dlq/redrive.
+// Either MessageIDs or All must be set.
+type RedriveRequest struct {
+	MessageIDs []string `json:"messageIds"`
+	All        bool     `json:"all"`
+}
+
+// AliasRequest is the body of POST /admin/aliases.
+type AliasRequest struct {
+	Name      string `json:"name"`
+	ISO3      string `json:"iso3"`
+	Reprocess bool   `json:"reprocess"` // Reprocess the latest payload of affected users
+}
+
+// adminHandler serves the admin endpoints routed to the consumer Lambda:
+//   - GET  /admin/dlq          lists dead-lettered messages
+//   - POST /admin/dlq/redrive  reprocesses selected (or all) messages
+//   - POST /admin/aliases      registers a country alias
+func (c *Consumer) adminHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	log.Printf("Admin request: %s", request.RouteKey)
+
+	// Validate admin key (the public API keys are not accepted here)
+	adminKey := request.Headers["x-admin-key"]
+	if adminKey == "" {
+		adminKey = request.Headers["X-Admin-Key"]
+	}
+	if !auth.ValidateAdminKey(ctx, c.apiKeys, adminKey) {
+		log.Printf("Unauthorized: invalid admin key")
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"UNAUTHORIZED","message":"Invalid or missing admin key"}`,
+		}, nil
+	}
+
+	switch request.RouteKey {
+	case "GET /admin/dlq":
+		if c.dlq == nil {
+			return errorResponse(503, "DLQ not configured"), nil
+		}
+		messages, err := c.ListDLQ(ctx)
+		if err != nil {
+			log.Printf("Error listing DLQ: %v", err)
+			return errorResponse(500, "Error reading DLQ"), nil
+		}
+		return jsonResponse(200, map[string]interface{}{
+			"messages": messages,
+			"count":    len(messages),
+		}), nil
+
+	case "POST /admin/dlq/redrive":
+		if c.dlq == nil {
+			return errorResponse(503, "DLQ not configured"), nil
+		}
+		var body RedriveRequest
+		if err := json.Unmarshal([]byte(request.Body), &body); err != nil {
+			return errorResponse(400, "Invalid JSON body"), nil
+		}
+		if !body.All && len(body.MessageIDs) == 0 {
+			return errorResponse(400, "Provide messageIds or set all to true"), nil
+		}
+		if body.All {
+			body.MessageIDs = nil
+		}
+
+		results, err := c.RedriveDLQ(ctx, body.MessageIDs)
+		if err != nil {
+			log.Printf("Error redriving DLQ: %v", err)
+			return errorResponse(500, "Error reading DLQ"), nil
+		}
+
+		redriven := 0
+		for _, r := range results {
+			if r.Outcome == RedriveProcessed {
+				redriven++
+			}
+		}
+		return jsonResponse(200, map[string]interface{}{
+			"results":  results,
+			"redriven": redriven,
+			"count":    len(results),
+		}), nil
+
+	case "POST /admin/aliases":
+		var body AliasRequest
+		if err := json.Unmarshal([]byte(request.Body), &body); err != nil {
+			return errorResponse(400, "Invalid JSON body"), nil
+		}
+		name := utils.CleanEmojis(body.Name)
+		iso3 := strings.ToUpper(strings.TrimSpace(body.ISO3))
+		if err := validateAlias(name, iso3); err != nil {
+			return errorResponse(400, err.Error()), nil
+		}
+
+		result, err := c.RegisterAlias(ctx, name, iso3, body.Reprocess)
+		if err != nil {
+			log.Printf("Error registering alias: %v", err)
+			return errorResponse(500, "Error saving alias"), nil
+		}
+		return jsonResponse(200, result), nil
+
+	default:
+		return errorResponse(404, "Route not found"), nil
+	}
+}
+
+func jsonResponse(statusCode int, body interface{}) events.APIGatewayV2HTTPResponse {
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return errorResponse(500, "Error building response")
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(data),
+	}
+}
+
+func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	body, err := json.Marshal(map[string]string{
+		"error": message,
+	})
+	if err != nil {
+		log.Printf("ERROR marshaling error response: %v", err)
+		// Fallback to hardcoded JSON if marshal fails
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 500,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"INTERNAL_ERROR"}`,
+		}
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(body),
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/calendar"
+	"github.com/mundotalendo/functions/httpcache"
+	"github.com/mundotalendo/functions/types"
+)
+
+// MaxAggregateAttempts bounds the optimistic write retries of a country
+// aggregate when other consumers update it concurrently.
+const MaxAggregateAttempts = 5
+
+// AggregateStore maintains the per-country aggregates (AGGREGATE#COUNTRY)
+// read by GET /stats, so the endpoint does not scan every reading.
+//
+// Each aggregate keeps the contribution of every user who read the country;
+// the totals are recomputed from them on every write, so applying the same
+// contribution twice is harmless.
+type AggregateStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewAggregateStore creates a new AggregateStore with the given DynamoDB client and table name.
+func NewAggregateStore(client DynamoDBClient, tableName string) *AggregateStore {
+	return &AggregateStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// UpdateUser applies the change of a user's live readings to the aggregates
+// of the countries whose contribution changed. Countries the user no longer
+// reads lose the user's contribution.
+//
+// Returns:
+//   - error: ErrDynamoDBRead or ErrDynamoDBWrite if an aggregate cannot be
+//     read or written (including too many concurrent writes)
+func (s *AggregateStore) UpdateUser(ctx context.Context, user string, previous, items []types.LeituraItem) error {
+	before := countryContributions(previous)
+	after := countryContributions(items)
+
+	countries := make([]string, 0, len(before)+len(after))
+	for iso3 := range before {
+		countries = append(countries, iso3)
+	}
+	for iso3 := range after {
+		if _, found := before[iso3]; !found {
+			countries = append(countries, iso3)
+		}
+	}
+	sort.Strings(countries)
+
+	updated := 0
+	for _, iso3 := range countries {
+		contribution, reads := after[iso3]
+		if old, found := before[iso3]; found && reads && reflect.DeepEqual(old, contribution) {
+			continue
+		}
+
+		var err error
+		if reads {
+			err = s.apply(ctx, iso3, user, &contribution)
+		} else {
+			err = s.apply(ctx, iso3, user, nil)
+		}
+		if err != nil {
+			return err
+		}
+		updated++
+	}
+
+	if updated > 0 {
+		log.Printf("Updated %d country aggregates for user %s", updated, user)
+	}
+	return nil
+}
+
+// apply sets (or removes, when contribution is nil) the user's contribution
+// to a country aggregate. The write is conditional on the version read, and
+// is retried on top of the newer aggregate when another consumer won.
+func (s *AggregateStore) apply(ctx context.Context, iso3, user string, contribution *types.CountryContribution) error {
+	key := map[string]ddbtypes.AttributeValue{
+		"PK": &ddbtypes.AttributeValueMemberS{Value: types.CountryAggregatePartition},
+		"SK": &ddbtypes.AttributeValueMemberS{Value: types.CountryAggregateKey(iso3)},
+	}
+
+	for attempt := 1; attempt <= MaxAggregateAttempts; attempt++ {
+		result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(s.tableName),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+		}
+
+		aggregate := newCountryAggregate(iso3)
+		if result.Item != nil {
+			if err := attributevalue.UnmarshalMap(result.Item, &aggregate); err != nil {
+				return fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+			}
+			if aggregate.Users == nil {
+				aggregate.Users = make(map[string]types.CountryContribution)
+			}
+		}
+
+		if contribution != nil {
+			aggregate.Users[user] = *contribution
+		} else {
+			delete(aggregate.Users, user)
+		}
+
+		err = s.put(ctx, aggregate, result.Item != nil)
+		if errors.Is(err, errAggregateConflict) {
+			continue
+		}
+		return err
+	}
+
+	return fmt.Errorf("%w: aggregate %s changed concurrently %d times", ErrDynamoDBWrite, iso3, MaxAggregateAttempts)
+}
+
+// errAggregateConflict reports that the aggregate changed since it was read.
+var errAggregateConflict = errors.New("aggregate changed concurrently")
+
+// put recomputes the totals and writes the aggregate with the next version.
+// existed tells whether the aggregate was read from the table, so the write
+// fails with errAggregateConflict if it was created or updated meanwhile.
+func (s *AggregateStore) put(ctx context.Context, aggregate types.CountryAggregateItem, existed bool) error {
+	condition := aws.String("attribute_not_exists(PK)")
+	var values map[string]ddbtypes.AttributeValue
+	if existed {
+		condition = aws.String("version = :version")
+		values = map[string]ddbtypes.AttributeValue{
+			":version": &ddbtypes.AttributeValueMemberN{Value: fmt.Sprint(aggregate.Version)},
+		}
+	}
+
+	summarizeAggregate(&aggregate)
+	aggregate.Version++
+
+	av, err := attributevalue.MarshalMap(aggregate)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(s.tableName),
+		Item:                      av,
+		ConditionExpression:       condition,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var conditionFailed *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return errAggregateConflict
+		}
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+	return nil
+}
+
+// Reconcile recomputes every country aggregate from the live readings and
+// overwrites the stored ones, repairing any drift (e.g. an aggregate write
+// that failed after its readings were saved). Aggregates of countries nobody
+// reads anymore are deleted. It returns the number of aggregates written.
+//
+// Returns:
+//   - error: ErrDynamoDBRead or ErrDynamoDBWrite if a read or write fails
+func (s *AggregateStore) Reconcile(ctx context.Context, readings []types.LeituraItem) (int, error) {
+	existing, err := s.queryAggregates(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	byUser := make(map[string][]types.LeituraItem)
+	for _, reading := range readings {
+		byUser[reading.User] = append(byUser[reading.User], reading)
+	}
+
+	aggregates := make(map[string]types.CountryAggregateItem)
+	for user, userReadings := range byUser {
+		for iso3, contribution := range countryContributions(userReadings) {
+			aggregate, found := aggregates[iso3]
+			if !found {
+				aggregate = newCountryAggregate(iso3)
+			}
+			aggregate.Users[user] = contribution
+			aggregates[iso3] = aggregate
+		}
+	}
+
+	for iso3, aggregate := range aggregates {
+		// Bumping past the stored version makes in-flight consumer writes
+		// retry on top of the reconciled aggregate.
+		aggregate.Version = existing[iso3].Version
+		summarizeAggregate(&aggregate)
+		aggregate.Version++
+
+		av, err := attributevalue.MarshalMap(aggregate)
+		if err != nil {
+			return 0, fmt.Errorf("marshal error: %w", err)
+		}
+		if _, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(s.tableName),
+			Item:      av,
+		}); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+		}
+	}
+
+	for iso3, stale := range existing {
+		if _, found := aggregates[iso3]; found {
+			continue
+		}
+		if _, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(s.tableName),
+			Key: map[string]ddbtypes.AttributeValue{
+				"PK": &ddbtypes.AttributeValueMemberS{Value: stale.PK},
+				"SK": &ddbtypes.AttributeValueMemberS{Value: stale.SK},
+			},
+		}); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+		}
+	}
+
+	if err := httpcache.Bump(ctx, s.client, s.tableName); err != nil {
+		log.Printf("WARN: Failed to bump data version: %v", err)
+	}
+
+	log.Printf("Reconciled %d country aggregates from %d readings", len(aggregates), len(readings))
+	return len(aggregates), nil
+}
+
+// queryAggregates returns the stored aggregates by ISO3.
+func (s *AggregateStore) queryAggregates(ctx context.Context) (map[string]types.CountryAggregateItem, error) {
+	aggregates := make(map[string]types.CountryAggregateItem)
+	var lastKey map[string]ddbtypes.AttributeValue
+
+	for {
+		result, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.tableName),
+			KeyConditionExpression: aws.String("PK = :pk"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":pk": &ddbtypes.AttributeValueMemberS{Value: types.CountryAggregatePartition},
+			},
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+		}
+
+		for _, av := range result.Items {
+			var aggregate types.CountryAggregateItem
+			if err := attributevalue.UnmarshalMap(av, &aggregate); err != nil || aggregate.ISO3 == "" {
+				log.Printf("WARN: Invalid item structure, skipping")
+				continue
+			}
+			aggregates[aggregate.ISO3] = aggregate
+		}
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+
+	return aggregates, nil
+}
+
+// newCountryAggregate returns an empty aggregate for the country.
+func newCountryAggregate(iso3 string) types.CountryAggregateItem {
+	return types.CountryAggregateItem{
+		PK:    types.CountryAggregatePartition,
+		SK:    types.CountryAggregateKey(iso3),
+		ISO3:  iso3,
+		Users: make(map[string]types.CountryContribution),
+	}
+}
+
+// countryContributions summarizes one user's readings per country: the
+// highest progress overall and per categoria, the latest update, the
+// distinct titles and the rated books.
+func countryContributions(readings []types.LeituraItem) map[string]types.CountryContribution {
+	contributions := make(map[string]types.CountryContribution)
+	for _, reading := range readings {
+		if reading.ISO3 == "" {
+			continue
+		}
+
+		c := contributions[reading.ISO3]
+		c.Progresso = max(c.Progresso, reading.Progresso)
+		if categoria := contributionCategory(reading); categoria != "" {
+			if c.Categorias == nil {
+				c.Categorias = make(map[string]int)
+			}
+			c.Categorias[categoria] = max(c.Categorias[categoria], reading.Progresso)
+		}
+		c.UpdatedAt = max(c.UpdatedAt, reading.UpdatedAt)
+		if reading.Livro != "" && !slices.Contains(c.Livros, reading.Livro) {
+			c.Livros = append(c.Livros, reading.Livro)
+		}
+		if reading.Avaliacao > 0 {
+			c.Avaliacoes = append(c.Avaliacoes, types.BookAvaliacao{
+				Livro:     reading.Livro,
+				Autor:     reading.Autor,
+				Avaliacao: reading.Avaliacao,
+			})
+		}
+		contributions[reading.ISO3] = c
+	}
+
+	// Readings come in payload or index order; sorting keeps equal
+	// contributions equal, so unchanged countries are not rewritten
+	for iso3, c := range contributions {
+		sort.Strings(c.Livros)
+		sort.Slice(c.Avaliacoes, func(i, j int) bool {
+			a, b := c.Avaliacoes[i], c.Avaliacoes[j]
+			if a.Livro != b.Livro {
+				return a.Livro < b.Livro
+			}
+			if a.Autor != b.Autor {
+				return a.Autor < b.Autor
+			}
+			return a.Avaliacao < b.Avaliacao
+		})
+		contributions[iso3] = c
+	}
+	return contributions
+}
+
+// contributionCategory returns the categoria a reading counts under: the
+// calendar month name when the categoria is a month, so "Marco" and "Março"
+// are the same key, or the categoria as sent otherwise.
+func contributionCategory(reading types.LeituraItem) string {
+	mes := reading.Mes
+	if mes == 0 {
+		mes = calendar.ParseCategory(reading.Categoria)
+	}
+	if month, ok := calendar.ByNumber(mes); ok {
+		return month.Name
+	}
+	return reading.Categoria
+}
+
+// summarizeAggregate recomputes the totals of an aggregate from its users.
+func summarizeAggregate(aggregate *types.CountryAggregateItem) {
+	aggregate.Progress = 0
+	aggregate.Readers = 0
+	aggregate.Completed = 0
+	aggregate.UpdatedAt = ""
+
+	for _, c := range aggregate.Users {
+		aggregate.Progress = max(aggregate.Progress, c.Progresso)
+		aggregate.UpdatedAt = max(aggregate.UpdatedAt, c.UpdatedAt)
+		if c.Progresso > 0 {
+			aggregate.Readers++
+		}
+		if c.Progresso == 100 {
+			aggregate.Completed++
+		}
+	}
+}
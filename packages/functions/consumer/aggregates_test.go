@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// putAggregates returns the aggregates written to AGGREGATE#COUNTRY, by ISO3.
+func putAggregates(t *testing.T, client *mockDynamoDBClient) map[string]types.CountryAggregateItem {
+	t.Helper()
+	aggregates := make(map[string]types.CountryAggregateItem)
+	for _, put := range client.putsWithPrefix(types.CountryAggregatePartition) {
+		var aggregate types.CountryAggregateItem
+		if err := attributevalue.UnmarshalMap(put.Item, &aggregate); err != nil {
+			t.Fatalf("unmarshal aggregate: %v", err)
+		}
+		aggregates[aggregate.ISO3] = aggregate
+	}
+	return aggregates
+}
+
+func TestAggregateStore_UpdateUser(t *testing.T) {
+	existing := newCountryAggregate("CHL")
+	existing.Users["Maria"] = types.CountryContribution{Progresso: 100, UpdatedAt: "2026-01-10T00:00:00Z"}
+	existing.Users["Ana"] = types.CountryContribution{Progresso: 20, UpdatedAt: "2026-01-05T00:00:00Z"}
+	existing.Version = 3
+
+	client := &mockDynamoDBClient{
+		getItems: map[string]map[string]ddbtypes.AttributeValue{
+			types.CountryAggregatePartition: mustMarshal(t, existing),
+		},
+	}
+	store := NewAggregateStore(client, "test-table")
+
+	previous := []types.LeituraItem{
+		{User: "Ana", ISO3: "CHL", VinculadoID: "v1", Progresso: 20, UpdatedAt: "2026-01-05T00:00:00Z"},
+	}
+	items := []types.LeituraItem{
+		{User: "Ana", ISO3: "CHL", VinculadoID: "v1", Progresso: 60, UpdatedAt: "2026-01-12T00:00:00Z", Livro: "Kokoro", Avaliacao: 4},
+	}
+
+	if err := store.UpdateUser(context.Background(), "Ana", previous, items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	aggregates := putAggregates(t, client)
+	chl, found := aggregates["CHL"]
+	if len(aggregates) != 1 || !found {
+		t.Fatalf("expected only CHL to be written, got %v", aggregates)
+	}
+	if chl.Progress != 100 || chl.Readers != 2 || chl.Completed != 1 || chl.UpdatedAt != "2026-01-12T00:00:00Z" {
+		t.Errorf("unexpected totals: %+v", chl)
+	}
+	if chl.Version != 4 || len(chl.Users["Ana"].Avaliacoes) != 1 {
+		t.Errorf("expected version 4 with Ana's rating, got %+v", chl)
+	}
+	if condition := aws.ToString(client.puts[0].ConditionExpression); condition != "version = :version" {
+		t.Errorf("expected a write conditional on the version read, got %q", condition)
+	}
+
+	if err := store.UpdateUser(context.Background(), "Ana", items, items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.puts) != 1 {
+		t.Errorf("expected no write for an unchanged resend, got %d puts", len(client.puts))
+	}
+}
+
+func TestAggregateStore_RetriesConcurrentWrites(t *testing.T) {
+	client := &mockDynamoDBClient{
+		conditionErr: &ddbtypes.ConditionalCheckFailedException{Message: aws.String("version changed")},
+	}
+	store := NewAggregateStore(client, "test-table")
+
+	err := store.UpdateUser(context.Background(), "Ana", nil, []types.LeituraItem{{User: "Ana", ISO3: "CHL", Progresso: 10}})
+
+	if !errors.Is(err, ErrDynamoDBWrite) {
+		t.Errorf("expected ErrDynamoDBWrite after exhausting retries, got %v", err)
+	}
+	if len(client.puts) != MaxAggregateAttempts {
+		t.Errorf("expected %d attempts, got %d", MaxAggregateAttempts, len(client.puts))
+	}
+}
+
+func TestRebuild_AggregatesReconcile(t *testing.T) {
+	stale := newCountryAggregate("JPN")
+	chl := newCountryAggregate("CHL")
+	chl.Version = 7
+	dynamoClient := &mockDynamoDBClient{
+		partitions: map[string][]map[string]ddbtypes.AttributeValue{
+			LivePartition: {
+				mustMarshal(t, types.LeituraItem{PK: LivePartition, SK: "Ana#d1", User: "Ana", ISO3: "CHL", Progresso: 40}),
+				mustMarshal(t, types.LeituraItem{PK: LivePartition, SK: "Bia#d1#v1", User: "Bia", ISO3: "CHL", Progresso: 100}),
+				mustMarshal(t, types.LeituraItem{PK: LivePartition, SK: "Bia#d1#v2", User: "Bia", ISO3: "CHL", Progresso: 30}),
+				mustMarshal(t, types.LeituraItem{PK: LivePartition, SK: "Bia#d2", User: "Bia", ISO3: "PER"}),
+			},
+			types.CountryAggregatePartition: {mustMarshal(t, stale), mustMarshal(t, chl)},
+		},
+	}
+	consumer := newTestConsumer(&mockS3Client{}, dynamoClient)
+	consumer.store = consumer.store.WithAggregates(NewAggregateStore(dynamoClient, "test-table"))
+
+	report, err := consumer.Rebuild(context.Background(), RebuildAggregates)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Users != 2 || report.Aggregates != 2 {
+		t.Errorf("expected 2 users and 2 aggregates, got %+v", report)
+	}
+
+	aggregates := putAggregates(t, dynamoClient)
+	if got := aggregates["CHL"]; got.Progress != 100 || got.Readers != 2 || got.Completed != 1 || got.Version != 8 {
+		t.Errorf("unexpected CHL aggregate: %+v", got)
+	}
+	if got := aggregates["PER"]; got.Progress != 0 || got.Readers != 0 {
+		t.Errorf("unexpected PER aggregate: %+v", got)
+	}
+	if len(dynamoClient.deletes) != 1 || dynamoClient.deletes[0].Key["SK"].(*ddbtypes.AttributeValueMemberS).Value != "ISO3#JPN" {
+		t.Errorf("expected the JPN aggregate to be deleted, got %d deletes", len(dynamoClient.deletes))
+	}
+}
+
+func TestCountryContributions_ByCategory(t *testing.T) {
+	readings := []types.LeituraItem{
+		{ISO3: "CHL", Categoria: "Janeiro", Mes: 1, Progresso: 40, Livro: "Poemas"},
+		{ISO3: "CHL", Categoria: "Janeiro", Mes: 1, Progresso: 90, Livro: "Casa dos Espíritos"},
+		{ISO3: "CHL", Categoria: "Janeiro", Mes: 1, Progresso: 90, Livro: "Poemas"},
+		{ISO3: "CHL", Categoria: "Marco", Progresso: 10},
+		{ISO3: "CHL", Categoria: "Bônus", Progresso: 100},
+	}
+
+	chl := countryContributions(readings)["CHL"]
+	want := map[string]int{"Janeiro": 90, "Março": 10, "Bônus": 100}
+	if !reflect.DeepEqual(chl.Categorias, want) {
+		t.Errorf("expected categorias %v, got %v", want, chl.Categorias)
+	}
+	if want := []string{"Casa dos Espíritos", "Poemas"}; !reflect.DeepEqual(chl.Livros, want) {
+		t.Errorf("expected distinct titles %v, got %v", want, chl.Livros)
+	}
+	if chl.Progresso != 100 {
+		t.Errorf("expected overall progress 100, got %d", chl.Progresso)
+	}
+}
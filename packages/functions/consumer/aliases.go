@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/mapping"
+	"github.com/mundotalendo/functions/types"
+)
+
+// aliasCacheTTL is how long a warm Lambda keeps the loaded aliases. Aliases
+// registered through another instance are picked up after at most this delay.
+const aliasCacheTTL = 5 * time.Minute
+
+// Reprocess outcomes reported per affected user.
+const (
+	ReprocessProcessed  = "REPROCESSED" // Latest payload reprocessed with the new alias
+	ReprocessSuperseded = "SUPERSEDED"  // A newer webhook was applied meanwhile
+	ReprocessFailed     = "FAILED"      // Payload fetch or readings write failed
+	ReprocessSkipped    = "SKIPPED"     // Not processed (time budget exhausted)
+	ReprocessNotFound   = "NOT_FOUND"   // No webhook was ever applied for the user
+)
+
+// AliasResult reports an alias registration.
+type AliasResult struct {
+	Name        string            `json:"name"`
+	ISO3        string            `json:"iso3"`
+	Users       []string          `json:"users"` // Users affected while the name was unmapped
+	Reprocessed []ReprocessResult `json:"reprocessed,omitempty"`
+	Pending     []string          `json:"pending,omitempty"` // Users not reprocessed (FAILED/SKIPPED), kept in quarantine
+}
+
+// ReprocessResult reports the outcome of reprocessing one user's latest payload.
+type ReprocessResult struct {
+	User      string `json:"user"`
+	UUID      string `json:"uuid,omitempty"`
+	Outcome   string `json:"outcome"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AliasStore handles country aliases (ALIAS#COUNTRY) registered at runtime.
+// Aliases are merged with mapping.NameToIso through a cached mapping.Resolver.
+type AliasStore struct {
+	client    DynamoDBClient
+	tableName string
+
+	mu       sync.Mutex
+	resolver *mapping.Resolver
+	loadedAt time.Time
+}
+
+// NewAliasStore creates a new AliasStore with the given DynamoDB client and table name.
+func NewAliasStore(client DynamoDBClient, tableName string) *AliasStore {
+	return &AliasStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Resolver returns the country resolver, reloading aliases after aliasCacheTTL.
+// If aliases cannot be loaded, the previous resolver (or the built-in mapping)
+// is used so processing is never blocked by the alias table.
+func (s *AliasStore) Resolver(ctx context.Context) *mapping.Resolver {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resolver != nil && time.Since(s.loadedAt) < aliasCacheTTL {
+		return s.resolver
+	}
+
+	aliases, err := s.load(ctx)
+	if err != nil {
+		log.Printf("WARN: Failed to load country aliases: %v", err)
+		if s.resolver == nil {
+			return mapping.NewResolver(nil)
+		}
+		return s.resolver
+	}
+
+	s.resolver = mapping.NewResolver(aliases)
+	s.loadedAt = time.Now()
+	return s.resolver
+}
+
+// load reads every alias from the ALIAS#COUNTRY partition.
+func (s *AliasStore) load(ctx context.Context) (map[string]string, error) {
+	aliases := make(map[string]string)
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":pk": &ddbtypes.AttributeValueMemberS{Value: types.CountryAliasPartition},
+		},
+	}
+
+	for {
+		result, err := s.client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+		}
+
+		for _, av := range result.Items {
+			var item types.CountryAliasItem
+			if err := attributevalue.UnmarshalMap(av, &item); err != nil {
+				log.Printf("WARN: Skipping invalid alias item: %v", err)
+				continue
+			}
+			aliases[item.Name] = item.ISO3
+		}
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return aliases, nil
+}
+
+// SaveAlias registers (or replaces) an alias and invalidates the cached resolver.
+//
+// Returns:
+//   - error: ErrDynamoDBWrite if the write fails
+func (s *AliasStore) SaveAlias(ctx context.Context, name, iso3 string) error {
+	av, err := attributevalue.MarshalMap(types.CountryAliasItem{
+		PK:        types.CountryAliasPartition,
+		SK:        types.CountryNameKey(name),
+		Name:      name,
+		ISO3:      iso3,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+
+	s.mu.Lock()
+	s.resolver = nil
+	s.mu.Unlock()
+
+	log.Printf("Saved country alias: %s -> %s", name, iso3)
+	return nil
+}
+
+// validateAlias checks an alias registration request. The name is matched
+// after emoji cleanup, exactly as the consumer sees it.
+func validateAlias(name, iso3 string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("Name is required")
+	}
+	if !mapping.IsKnownISO(iso3) {
+		return fmt.Errorf("Unknown iso3 %q", iso3)
+	}
+	if existing := mapping.GetISO(name); existing != "" {
+		return fmt.Errorf("%s is already mapped to %s", name, existing)
+	}
+	return nil
+}
+
+// RegisterAlias saves an alias, removes the name from quarantine and, when
+// reprocess is set, reprocesses the latest payload of every affected user.
+// Users whose reprocessing failed or was skipped stay in quarantine, so
+// registering the alias again retries them.
+func (c *Consumer) RegisterAlias(ctx context.Context, name, iso3 string, reprocess bool) (*AliasResult, error) {
+	unmapped, err := c.unmapped.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.aliases.SaveAlias(ctx, name, iso3); err != nil {
+		return nil, err
+	}
+
+	result := &AliasResult{Name: name, ISO3: iso3, Users: []string{}}
+	if unmapped != nil {
+		result.Users = unmapped.Users
+		sort.Strings(result.Users)
+	}
+
+	var done []string
+	if reprocess {
+		for _, user := range result.Users {
+			reprocessed := c.reprocessUser(ctx, user)
+			result.Reprocessed = append(result.Reprocessed, reprocessed)
+			if reprocessed.Outcome == ReprocessFailed || reprocessed.Outcome == ReprocessSkipped {
+				result.Pending = append(result.Pending, user)
+			} else {
+				done = append(done, user)
+			}
+		}
+	}
+
+	if len(result.Pending) == 0 {
+		err = c.unmapped.Delete(ctx, name)
+	} else {
+		err = c.unmapped.RemoveUsers(ctx, name, done)
+	}
+	if err != nil {
+		log.Printf("WARN: Failed to update quarantine of %s: %v", name, err)
+	}
+
+	return result, nil
+}
+
+// reprocessUser runs the latest webhook applied for the user through the
+// processor again. The write is guarded by the user state, so a webhook
+// received meanwhile is never overwritten.
+func (c *Consumer) reprocessUser(ctx context.Context, user string) ReprocessResult {
+	result := ReprocessResult{User: user}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < redriveTimeMargin {
+		result.Outcome = ReprocessSkipped
+		return result
+	}
+
+	fail := func(err error) ReprocessResult {
+		result.Outcome = ReprocessFailed
+		result.ErrorCode = ErrorCode(err)
+		result.Error = err.Error()
+		return result
+	}
+
+	state, err := c.state.Get(ctx, user)
+	if err != nil {
+		return fail(err)
+	}
+	if state == nil {
+		result.Outcome = ReprocessNotFound
+		return result
+	}
+	result.UUID = state.LastUUID
+
+	payload, err := c.fetcher.FetchPayload(ctx, state.LastUUID)
+	if err != nil {
+		return fail(err)
+	}
+
+	meta := ProcessingMeta{
+		UUID:       state.LastUUID,
+		User:       user,
+		AvatarURL:  payload.Perfil.Imagem,
+		ProfileURL: payload.Perfil.Link,
+		Timestamp:  time.Unix(0, state.LastApplied).UTC(),
+	}
+	_, _, results := c.processor.ProcessAll(ctx, payload, meta)
+
+	if isSuperseded(results) {
+		result.Outcome = ReprocessSuperseded
+	} else if err := replaceError(results); err != nil {
+		return fail(err)
+	} else {
+		result.Outcome = ReprocessProcessed
+	}
+
+	log.Printf("Reprocess: user=%s, UUID=%s, outcome=%s", user, result.UUID, result.Outcome)
+	return result
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+const unmappedPayload = `{"perfil": {"nome": "Test User"}, "desafios": [{"descricao": "Brasil", "tipo": "leitura"}, {"descricao": "Brasiu", "tipo": "leitura"}]}`
+
+func mustMarshal(t *testing.T, v interface{}) map[string]ddbtypes.AttributeValue {
+	t.Helper()
+	av, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	return av
+}
+
+// readingISOs returns the iso3 of every reading put in the transactions.
+func readingISOs(m *mockDynamoDBClient) []string {
+	var isos []string
+	for _, tx := range m.transacts {
+		for _, item := range tx.TransactItems {
+			if item.Put != nil {
+				isos = append(isos, item.Put.Item["iso3"].(*ddbtypes.AttributeValueMemberS).Value)
+			}
+		}
+	}
+	return isos
+}
+
+func TestProcessRecord_QuarantinesUnmappedCountry(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	c := newTestConsumer(&mockS3Client{payload: unmappedPayload}, dynamoClient)
+
+	record := events.SQSMessage{Body: `{"uuid":"test-uuid","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`}
+	if err := c.processRecord(context.Background(), record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(dynamoClient.updates) != 1 {
+		t.Fatalf("expected 1 quarantine update, got %d", len(dynamoClient.updates))
+	}
+	update := dynamoClient.updates[0]
+	if sk := update.Key["SK"].(*ddbtypes.AttributeValueMemberS).Value; sk != "NAME#Brasiu" {
+		t.Errorf("expected SK NAME#Brasiu, got %s", sk)
+	}
+	if !strings.Contains(*update.UpdateExpression, "ADD occurrences :one") {
+		t.Errorf("expected occurrences to be incremented, got %s", *update.UpdateExpression)
+	}
+	users := update.ExpressionAttributeValues[":user"].(*ddbtypes.AttributeValueMemberSS).Value
+	if len(users) != 1 || users[0] != "Test User" {
+		t.Errorf("expected affected user to be added, got %v", users)
+	}
+}
+
+func TestProcessAll_ResolvesRuntimeAlias(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		partitions: map[string][]map[string]ddbtypes.AttributeValue{
+			types.CountryAliasPartition: {mustMarshal(t, types.CountryAliasItem{Name: "Brasiu", ISO3: "BRA"})},
+		},
+	}
+	c := newTestConsumer(&mockS3Client{payload: unmappedPayload}, dynamoClient)
+
+	record := events.SQSMessage{Body: `{"uuid":"test-uuid","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`}
+	if err := c.processRecord(context.Background(), record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if isos := readingISOs(dynamoClient); len(isos) != 2 || isos[1] != "BRA" {
+		t.Errorf("expected both desafios saved as BRA, got %v", isos)
+	}
+	if len(dynamoClient.updates) != 0 {
+		t.Error("expected no quarantine update for an aliased country")
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	if err := validateAlias("Brasiu", "BRA"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []struct{ name, iso3 string }{
+		{"", "BRA"},
+		{"Brasiu", "XXX"},
+		{"Brasil", "PRT"}, // built-in names cannot be overridden
+	}
+	for _, tt := range invalid {
+		if err := validateAlias(tt.name, tt.iso3); err == nil {
+			t.Errorf("expected error for %q -> %q", tt.name, tt.iso3)
+		}
+	}
+}
+
+func TestRegisterAlias_ReprocessesAffectedUsers(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		partitions: map[string][]map[string]ddbtypes.AttributeValue{
+			types.CountryAliasPartition: {mustMarshal(t, types.CountryAliasItem{Name: "Brasiu", ISO3: "BRA"})},
+		},
+		getItems: map[string]map[string]ddbtypes.AttributeValue{
+			types.UnmappedCountryPartition: mustMarshal(t, types.UnmappedCountryItem{Name: "Brasiu", Users: []string{"Test User", "Ghost"}}),
+			"USERSTATE#Test User":          mustMarshal(t, UserStateItem{LastUUID: "uuid-1", LastApplied: 1}),
+		},
+	}
+	c := newTestConsumer(&mockS3Client{payload: unmappedPayload}, dynamoClient)
+
+	result, err := c.RegisterAlias(context.Background(), "Brasiu", "BRA", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(dynamoClient.putsWithPrefix(types.CountryAliasPartition)) != 1 {
+		t.Error("expected the alias to be saved")
+	}
+	if len(result.Reprocessed) != 2 {
+		t.Fatalf("expected 2 reprocess results, got %d", len(result.Reprocessed))
+	}
+	ghost, user := result.Reprocessed[0], result.Reprocessed[1]
+	if ghost.User != "Ghost" || ghost.Outcome != ReprocessNotFound {
+		t.Errorf("expected Ghost NOT_FOUND, got %+v", ghost)
+	}
+	if user.Outcome != ReprocessProcessed || user.UUID != "uuid-1" {
+		t.Errorf("expected Test User reprocessed from uuid-1, got %+v", user)
+	}
+
+	tx := dynamoClient.transacts[0].TransactItems
+	if tx[0].ConditionCheck == nil {
+		t.Error("expected reprocessing to be guarded by the user state")
+	}
+	if isos := readingISOs(dynamoClient); len(isos) != 2 {
+		t.Errorf("expected both desafios saved, got %v", isos)
+	}
+}
+
+func TestRegisterAlias_KeepsFailedUsersInQuarantine(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		getItems: map[string]map[string]ddbtypes.AttributeValue{
+			types.UnmappedCountryPartition: mustMarshal(t, types.UnmappedCountryItem{Name: "Brasiu", Users: []string{"Test User", "Broken"}}),
+			"USERSTATE#Test User":          mustMarshal(t, UserStateItem{LastUUID: "uuid-1", LastApplied: 1}),
+			"USERSTATE#Broken":             mustMarshal(t, UserStateItem{LastUUID: "uuid-2", LastApplied: 1}),
+		},
+	}
+	s3Client := &mockS3Client{payload: unmappedPayload, bodies: map[string]string{"payloads/uuid-2.json": `{not json`}}
+	c := newTestConsumer(s3Client, dynamoClient)
+
+	result, err := c.RegisterAlias(context.Background(), "Brasiu", "BRA", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Pending) != 1 || result.Pending[0] != "Broken" {
+		t.Errorf("expected Broken pending, got %v", result.Pending)
+	}
+	if len(dynamoClient.deletes) != 0 {
+		t.Error("expected the quarantine entry to be kept while a user is pending")
+	}
+
+	var removed []string
+	for _, update := range dynamoClient.updates {
+		if users, ok := update.ExpressionAttributeValues[":users"].(*ddbtypes.AttributeValueMemberSS); ok {
+			removed = append(removed, users.Value...)
+		}
+	}
+	if len(removed) != 1 || removed[0] != "Test User" {
+		t.Errorf("expected only the reprocessed user removed from quarantine, got %v", removed)
+	}
+}
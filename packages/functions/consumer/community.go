@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// CommunityStore records which countries the community has already read
+// (COMMUNITY#COUNTRY), so the first reader of a country can be detected
+// without scanning every reading.
+type CommunityStore struct {
+	client    DynamoDBClient
+	tableName string
+	store     *LeituraStore // checks readings saved before the markers existed
+}
+
+// NewCommunityStore creates a new CommunityStore with the given DynamoDB client and table name.
+func NewCommunityStore(client DynamoDBClient, tableName string, store *LeituraStore) *CommunityStore {
+	return &CommunityStore{
+		client:    client,
+		tableName: tableName,
+		store:     store,
+	}
+}
+
+// ClaimFirstReader reports whether the user is the first of the community to
+// read the country, and records the country as read either way.
+//
+// A missing marker is not enough: countries read before markers were written
+// have none, so the live readings are checked once for another reader. The
+// marker write is conditional, so only one of two concurrent users wins.
+//
+// Returns:
+//   - error: ErrDynamoDBRead or ErrDynamoDBWrite if a read or write fails
+func (s *CommunityStore) ClaimFirstReader(ctx context.Context, iso3, user, webhookUUID string) (bool, error) {
+	key := map[string]ddbtypes.AttributeValue{
+		"PK": &ddbtypes.AttributeValueMemberS{Value: types.CommunityCountryPartition},
+		"SK": &ddbtypes.AttributeValueMemberS{Value: types.CommunityCountryKey(iso3)},
+	}
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       key,
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+	}
+	if result.Item != nil {
+		return false, nil
+	}
+
+	item := types.CommunityCountryItem{
+		PK:          types.CommunityCountryPartition,
+		SK:          types.CommunityCountryKey(iso3),
+		ISO3:        iso3,
+		FirstUser:   user,
+		WebhookUUID: webhookUUID,
+		ReadAt:      time.Now().UTC().Format(time.RFC3339),
+	}
+
+	earlier, err := s.earlierReader(ctx, iso3, user)
+	if err != nil {
+		return false, err
+	}
+	if earlier != nil {
+		item.FirstUser = earlier.User
+		item.WebhookUUID = earlier.WebhookUUID
+		item.ReadAt = earlier.UpdatedAt
+	}
+
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return false, fmt.Errorf("marshal error: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+	if err != nil {
+		var conditionFailed *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+
+	if earlier != nil {
+		return false, nil
+	}
+	log.Printf("First reader of %s in the community: %s", iso3, user)
+	return true, nil
+}
+
+// earlierReader returns a live reading of the country by another user, or
+// nil if nobody else has read it. Only the country's readings are queried
+// (CountryIndex), not the whole live partition.
+func (s *CommunityStore) earlierReader(ctx context.Context, iso3, user string) (*types.LeituraItem, error) {
+	readings, err := s.store.CountryReadings(ctx, iso3)
+	if err != nil {
+		return nil, err
+	}
+
+	var earlier *types.LeituraItem
+	for i, r := range readings {
+		if r.User == user {
+			continue
+		}
+		if earlier == nil || r.UpdatedAt < earlier.UpdatedAt {
+			earlier = &readings[i]
+		}
+	}
+	return earlier, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// SQSClient defines the interface for SQS operations on the dead letter queue.
+// This interface enables mocking in unit tests.
+type SQSClient interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+const (
+	// MaxDLQMessages is the maximum number of DLQ messages read per request.
+	MaxDLQMessages = 100
+
+	// dlqVisibilityTimeout hides received messages while a request inspects them,
+	// so the same message is not received twice. Messages that are kept in the
+	// DLQ are made visible again before the request returns.
+	dlqVisibilityTimeout = 60
+
+	// redriveTimeMargin is the time left before the Lambda deadline at which
+	// redrive stops processing new messages.
+	redriveTimeMargin = 5 * time.Second
+)
+
+// Redrive outcomes reported per message.
+const (
+	RedriveProcessed  = "REDRIVEN"     // Processed and removed from the DLQ
+	RedriveSuperseded = "SUPERSEDED"   // Older than the user's last applied webhook, not applied and removed from the DLQ
+	RedriveFailed     = "FAILED"       // Permanent error, kept in the DLQ
+	RedriveRetryable  = "RETRY_FAILED" // Transient error, kept in the DLQ
+	RedriveSkipped    = "SKIPPED"      // Not processed (time budget exhausted), kept in the DLQ
+	RedriveNotFound   = "NOT_FOUND"    // Requested message ID is not in the DLQ
+)
+
+// DLQMessage describes a dead-lettered webhook message.
+type DLQMessage struct {
+	MessageID    string `json:"messageId"`
+	UUID         string `json:"uuid,omitempty"`
+	User         string `json:"user,omitempty"`
+	Timestamp    string `json:"timestamp,omitempty"`
+	ReceiveCount int    `json:"receiveCount"`
+	ErrorCode    string `json:"errorCode,omitempty"` // Parse or payload fetch error, empty if the payload is readable
+	Error        string `json:"error,omitempty"`
+}
+
+// RedriveResult reports the outcome of redriving one DLQ message.
+type RedriveResult struct {
+	MessageID string `json:"messageId"`
+	UUID      string `json:"uuid,omitempty"`
+	User      string `json:"user,omitempty"`
+	Outcome   string `json:"outcome"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DLQ handles SQS operations on the webhook dead letter queue.
+type DLQ struct {
+	client   SQSClient
+	queueURL string
+}
+
+// NewDLQ creates a new DLQ with the given SQS client and queue URL.
+func NewDLQ(client SQSClient, queueURL string) *DLQ {
+	return &DLQ{
+		client:   client,
+		queueURL: queueURL,
+	}
+}
+
+// receive reads up to max messages, hiding them for dlqVisibilityTimeout.
+func (d *DLQ) receive(ctx context.Context, max int) ([]sqstypes.Message, error) {
+	var messages []sqstypes.Message
+
+	for len(messages) < max {
+		batch := max - len(messages)
+		if batch > 10 {
+			batch = 10 // SQS limit per ReceiveMessage call
+		}
+
+		result, err := d.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(d.queueURL),
+			MaxNumberOfMessages: int32(batch),
+			VisibilityTimeout:   dlqVisibilityTimeout,
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{
+				sqstypes.MessageSystemAttributeNameApproximateReceiveCount,
+				sqstypes.MessageSystemAttributeNameSentTimestamp,
+			},
+		})
+		if err != nil {
+			return messages, fmt.Errorf("SQS ReceiveMessage failed: %w", err)
+		}
+		if len(result.Messages) == 0 {
+			break
+		}
+		messages = append(messages, result.Messages...)
+	}
+
+	return messages, nil
+}
+
+// release makes messages visible again. Failures are logged only - the
+// messages reappear anyway once the visibility timeout expires.
+func (d *DLQ) release(ctx context.Context, messages []sqstypes.Message) {
+	for _, m := range messages {
+		_, err := d.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(d.queueURL),
+			ReceiptHandle:     m.ReceiptHandle,
+			VisibilityTimeout: 0,
+		})
+		if err != nil {
+			log.Printf("WARN: Failed to release DLQ message %s: %v", aws.ToString(m.MessageId), err)
+		}
+	}
+}
+
+// delete removes a message from the DLQ.
+func (d *DLQ) delete(ctx context.Context, m sqstypes.Message) error {
+	_, err := d.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(d.queueURL),
+		ReceiptHandle: m.ReceiptHandle,
+	})
+	if err != nil {
+		return fmt.Errorf("SQS DeleteMessage failed: %w", err)
+	}
+	return nil
+}
+
+// ListDLQ inspects up to MaxDLQMessages DLQ messages without removing them.
+// Each message is parsed and its payload fetched to report why it cannot be processed.
+func (c *Consumer) ListDLQ(ctx context.Context) ([]DLQMessage, error) {
+	messages, err := c.dlq.receive(ctx, MaxDLQMessages)
+	defer c.dlq.release(context.WithoutCancel(ctx), messages)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]DLQMessage, 0, len(messages))
+	for _, m := range messages {
+		result = append(result, c.inspectDLQMessage(ctx, m))
+	}
+
+	log.Printf("Listed %d DLQ message(s)", len(result))
+	return result, nil
+}
+
+// inspectDLQMessage parses a DLQ message and checks that its payload can be fetched.
+func (c *Consumer) inspectDLQMessage(ctx context.Context, m sqstypes.Message) DLQMessage {
+	info := DLQMessage{MessageID: aws.ToString(m.MessageId)}
+	if count, err := strconv.Atoi(m.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)]); err == nil {
+		info.ReceiveCount = count
+	}
+
+	var msg types.SQSMessage
+	if err := json.Unmarshal([]byte(aws.ToString(m.Body)), &msg); err != nil {
+		info.ErrorCode = ErrorCode(ErrInvalidMessage)
+		info.Error = err.Error()
+		return info
+	}
+	info.UUID = msg.UUID
+	info.User = msg.User
+	info.Timestamp = msg.Timestamp
+
+	if _, err := c.fetcher.FetchPayload(ctx, msg.UUID); err != nil {
+		info.ErrorCode = ErrorCode(err)
+		info.Error = err.Error()
+	}
+
+	return info
+}
+
+// RedriveDLQ processes DLQ messages through processRecord.
+// With no messageIDs every received message is redriven (up to MaxDLQMessages).
+// Processed and superseded messages are deleted from the DLQ; all others are kept.
+func (c *Consumer) RedriveDLQ(ctx context.Context, messageIDs []string) ([]RedriveResult, error) {
+	messages, err := c.dlq.receive(ctx, MaxDLQMessages)
+	if err != nil {
+		c.dlq.release(context.WithoutCancel(ctx), messages)
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		wanted[id] = true
+	}
+
+	var results []RedriveResult
+	var kept []sqstypes.Message
+	found := make(map[string]bool, len(messageIDs))
+
+	for _, m := range messages {
+		id := aws.ToString(m.MessageId)
+		if len(wanted) > 0 && !wanted[id] {
+			kept = append(kept, m)
+			continue
+		}
+		found[id] = true
+
+		result := c.redriveMessage(ctx, m)
+		if result.Outcome == RedriveProcessed || result.Outcome == RedriveSuperseded {
+			if err := c.dlq.delete(ctx, m); err != nil {
+				log.Printf("WARN: Redriven message %s not deleted from DLQ: %v", id, err)
+			}
+		} else {
+			kept = append(kept, m)
+		}
+		results = append(results, result)
+	}
+
+	for _, id := range messageIDs {
+		if !found[id] {
+			results = append(results, RedriveResult{MessageID: id, Outcome: RedriveNotFound})
+		}
+	}
+
+	c.dlq.release(context.WithoutCancel(ctx), kept)
+
+	log.Printf("Redrive complete: %d message(s) handled", len(results))
+	return results, nil
+}
+
+// redriveMessage runs a single DLQ message through processRecord.
+func (c *Consumer) redriveMessage(ctx context.Context, m sqstypes.Message) RedriveResult {
+	result := RedriveResult{MessageID: aws.ToString(m.MessageId)}
+
+	var msg types.SQSMessage
+	if err := json.Unmarshal([]byte(aws.ToString(m.Body)), &msg); err == nil {
+		result.UUID = msg.UUID
+		result.User = msg.User
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < redriveTimeMargin {
+		result.Outcome = RedriveSkipped
+		return result
+	}
+
+	record := events.SQSMessage{
+		MessageId: result.MessageID,
+		Body:      aws.ToString(m.Body),
+		// SentTimestamp dates messages without a usable timestamp. The DLQ receive
+		// count is left out: a redrive attempt is final, never retried by SQS
+		Attributes: map[string]string{
+			"SentTimestamp": m.Attributes[string(sqstypes.MessageSystemAttributeNameSentTimestamp)],
+		},
+	}
+
+	err := c.processRecord(ctx, record)
+	switch {
+	case err == nil:
+		result.Outcome = RedriveProcessed
+	case errors.Is(err, ErrSuperseded):
+		result.Outcome = RedriveSuperseded
+	case IsRetryable(err):
+		result.Outcome = RedriveRetryable
+	default:
+		result.Outcome = RedriveFailed
+	}
+	if err != nil && result.Outcome != RedriveSuperseded {
+		result.ErrorCode = ErrorCode(err)
+		result.Error = err.Error()
+	}
+
+	log.Printf("Redrive: message=%s, UUID=%s, outcome=%s", result.MessageID, result.UUID, result.Outcome)
+	return result
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Mock SQS client for the dead letter queue.
+// ReceiveMessage hands out each message once, like a real visibility timeout.
+type mockSQSClient struct {
+	messages []sqstypes.Message
+	received int
+	deleted  []string
+	released []string
+}
+
+func (m *mockSQSClient) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	end := m.received + int(params.MaxNumberOfMessages)
+	if end > len(m.messages) {
+		end = len(m.messages)
+	}
+	batch := m.messages[m.received:end]
+	m.received = end
+	return &sqs.ReceiveMessageOutput{Messages: batch}, nil
+}
+
+func (m *mockSQSClient) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	m.deleted = append(m.deleted, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (m *mockSQSClient) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	m.released = append(m.released, aws.ToString(params.ReceiptHandle))
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+// dlqMessage builds a DLQ message whose receipt handle equals its ID.
+func dlqMessage(id, body string) sqstypes.Message {
+	return sqstypes.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String(id),
+		Body:          aws.String(body),
+		Attributes:    map[string]string{"ApproximateReceiveCount": "4"},
+	}
+}
+
+const testPayload = `{"perfil": {"nome": "Test User"}, "desafios": [{"descricao": "Brasil", "tipo": "leitura"}]}`
+
+func TestListDLQ(t *testing.T) {
+	sqsClient := &mockSQSClient{messages: []sqstypes.Message{
+		dlqMessage("ok", `{"uuid":"uuid-1","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`),
+		dlqMessage("broken", `not json`),
+	}}
+	c := newTestConsumer(&mockS3Client{payload: testPayload}, &mockDynamoDBClient{})
+	c.dlq = NewDLQ(sqsClient, "dlq-url")
+
+	messages, err := c.ListDLQ(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+	if messages[0].UUID != "uuid-1" || messages[0].User != "Test User" || messages[0].ReceiveCount != 4 || messages[0].ErrorCode != "" {
+		t.Errorf("unexpected first message: %+v", messages[0])
+	}
+	if messages[1].ErrorCode != "INVALID_MESSAGE" {
+		t.Errorf("expected INVALID_MESSAGE for unparseable body, got %+v", messages[1])
+	}
+
+	// Listing must not remove anything
+	if len(sqsClient.deleted) != 0 || len(sqsClient.released) != 2 {
+		t.Errorf("deleted/released = %v/%v, want none/all", sqsClient.deleted, sqsClient.released)
+	}
+}
+
+func TestListDLQ_ReportsFetchError(t *testing.T) {
+	sqsClient := &mockSQSClient{messages: []sqstypes.Message{
+		dlqMessage("bad-payload", `{"uuid":"uuid-1","user":"Test User"}`),
+	}}
+	c := newTestConsumer(&mockS3Client{payload: `{not json`}, &mockDynamoDBClient{})
+	c.dlq = NewDLQ(sqsClient, "dlq-url")
+
+	messages, _ := c.ListDLQ(context.Background())
+
+	if len(messages) != 1 || messages[0].ErrorCode != "INVALID_PAYLOAD" || messages[0].Error == "" {
+		t.Errorf("expected INVALID_PAYLOAD with message, got %+v", messages)
+	}
+}
+
+func TestRedriveDLQ_Selected(t *testing.T) {
+	sqsClient := &mockSQSClient{messages: []sqstypes.Message{
+		dlqMessage("m1", `{"uuid":"uuid-1","user":"Ana","timestamp":"2026-01-14T10:00:00Z"}`),
+		dlqMessage("m2", `{"uuid":"uuid-2","user":"Bia","timestamp":"2026-01-14T10:00:00Z"}`),
+		dlqMessage("m3", `not json`),
+	}}
+	dynamoClient := &mockDynamoDBClient{}
+	c := newTestConsumer(&mockS3Client{payload: testPayload}, dynamoClient)
+	c.dlq = NewDLQ(sqsClient, "dlq-url")
+
+	results, err := c.RedriveDLQ(context.Background(), []string{"m1", "m3", "missing"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	outcomes := make(map[string]string)
+	for _, r := range results {
+		outcomes[r.MessageID] = r.Outcome
+	}
+
+	want := map[string]string{"m1": RedriveProcessed, "m3": RedriveFailed, "missing": RedriveNotFound}
+	for id, outcome := range want {
+		if outcomes[id] != outcome {
+			t.Errorf("outcome[%s] = %q, want %q", id, outcomes[id], outcome)
+		}
+	}
+	if _, exists := outcomes["m2"]; exists {
+		t.Error("unselected message must not be redriven")
+	}
+
+	if len(sqsClient.deleted) != 1 || sqsClient.deleted[0] != "m1" {
+		t.Errorf("expected only m1 deleted, got %v", sqsClient.deleted)
+	}
+	if len(sqsClient.released) != 2 {
+		t.Errorf("expected m2 and m3 released, got %v", sqsClient.released)
+	}
+
+	if len(dynamoClient.transacts) != 1 {
+		t.Errorf("expected readings written for m1, got %d transactions", len(dynamoClient.transacts))
+	}
+}
+
+func TestRedriveDLQ_Superseded(t *testing.T) {
+	sqsClient := &mockSQSClient{messages: []sqstypes.Message{
+		dlqMessage("m1", `{"uuid":"old-uuid","user":"Ana","timestamp":"2026-01-14T10:00:00Z"}`),
+	}}
+	// The user state claim fails: a newer webhook was already applied
+	dynamoClient := &mockDynamoDBClient{conditionErr: &ddbtypes.ConditionalCheckFailedException{}}
+	c := newTestConsumer(&mockS3Client{payload: testPayload}, dynamoClient)
+	c.dlq = NewDLQ(sqsClient, "dlq-url")
+
+	results, err := c.RedriveDLQ(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Outcome != RedriveSuperseded {
+		t.Fatalf("expected a SUPERSEDED outcome, got %+v", results)
+	}
+	if results[0].ErrorCode != "" {
+		t.Errorf("expected no error code for a superseded message, got %q", results[0].ErrorCode)
+	}
+	if len(dynamoClient.transacts) != 0 {
+		t.Errorf("expected no readings written, got %d transactions", len(dynamoClient.transacts))
+	}
+	if len(sqsClient.deleted) != 1 {
+		t.Errorf("expected the superseded message removed from the DLQ, got %v", sqsClient.deleted)
+	}
+}
+
+func TestRoute_DispatchesAdminRequests(t *testing.T) {
+	t.Setenv("SST_Resource_DataTable_name", "test-table")
+
+	dynamoClient := &mockDynamoDBClient{
+		scanItems: []map[string]ddbtypes.AttributeValue{{
+			"PK":     &ddbtypes.AttributeValueMemberS{Value: "ADMINKEY#ops"},
+			"SK":     &ddbtypes.AttributeValueMemberS{Value: "METADATA"},
+			"key":    &ddbtypes.AttributeValueMemberS{Value: "secret"},
+			"active": &ddbtypes.AttributeValueMemberBOOL{Value: true},
+		}},
+	}
+	consumer = newTestConsumer(&mockS3Client{payload: testPayload}, dynamoClient)
+	consumer.dlq = NewDLQ(&mockSQSClient{}, "dlq-url")
+	defer func() { consumer = nil }()
+
+	request := events.APIGatewayV2HTTPRequest{
+		RouteKey: "GET /admin/dlq",
+		Headers:  map[string]string{"x-admin-key": "secret"},
+	}
+	raw, _ := json.Marshal(request)
+
+	out, err := route(context.Background(), raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	response, ok := out.(events.APIGatewayV2HTTPResponse)
+	if !ok || response.StatusCode != 200 {
+		t.Fatalf("expected 200 API Gateway response, got %#v", out)
+	}
+
+	request.Headers["x-admin-key"] = "wrong"
+	raw, _ = json.Marshal(request)
+	out, _ = route(context.Background(), raw)
+	if response := out.(events.APIGatewayV2HTTPResponse); response.StatusCode != 401 {
+		t.Errorf("expected 401 for invalid key, got %d", response.StatusCode)
+	}
+
+	// The public API key header does not reach admin endpoints
+	request.Headers = map[string]string{"x-api-key": "secret"}
+	raw, _ = json.Marshal(request)
+	out, _ = route(context.Background(), raw)
+	if response := out.(events.APIGatewayV2HTTPResponse); response.StatusCode != 401 {
+		t.Errorf("expected 401 for an API key, got %d", response.StatusCode)
+	}
+
+	sqsEvent, _ := json.Marshal(events.SQSEvent{Records: []events.SQSMessage{{MessageId: "m1", Body: `not json`}}})
+	out, err = route(context.Background(), sqsEvent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := out.(events.SQSEventResponse); !ok {
+		t.Errorf("expected SQS batch response, got %#v", out)
+	}
+}
+
+func TestAdminHandler_RedriveRequiresSelection(t *testing.T) {
+	t.Setenv("SST_Resource_DataTable_name", "test-table")
+
+	dynamoClient := &mockDynamoDBClient{
+		scanItems: []map[string]ddbtypes.AttributeValue{{
+			"PK":     &ddbtypes.AttributeValueMemberS{Value: "ADMINKEY#ops"},
+			"key":    &ddbtypes.AttributeValueMemberS{Value: "secret"},
+			"active": &ddbtypes.AttributeValueMemberBOOL{Value: true},
+		}},
+	}
+	c := newTestConsumer(&mockS3Client{}, dynamoClient)
+	c.dlq = NewDLQ(&mockSQSClient{}, "dlq-url")
+
+	response, _ := c.adminHandler(context.Background(), events.APIGatewayV2HTTPRequest{
+		RouteKey: "POST /admin/dlq/redrive",
+		Headers:  map[string]string{"x-admin-key": "secret"},
+		Body:     `{}`,
+	})
+
+	if response.StatusCode != 400 {
+		t.Errorf("expected 400 without messageIds or all, got %d", response.StatusCode)
+	}
+}
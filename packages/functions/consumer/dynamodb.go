@@ -2,14 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/httpcache"
 	"github.com/mundotalendo/functions/types"
 )
 
@@ -19,109 +20,465 @@ type DynamoDBClient interface {
 	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
 	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
 	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
 }
 
+// Reading partitions. The shadow partition holds readings rebuilt from the
+// payload archive until they are swapped into the live partition.
+const (
+	LivePartition   = "EVENT#LEITURA"
+	ShadowPartition = "SHADOW#LEITURA"
+)
+
 // LeituraStore handles DynamoDB operations for reading data.
 type LeituraStore struct {
-	client    DynamoDBClient
-	tableName string
+	client     DynamoDBClient
+	tableName  string
+	partition  string
+	aggregates *AggregateStore // nil disables the country aggregates
+	served     bool            // the partition is served by the API: writes bump the data version
 }
 
 // NewLeituraStore creates a new LeituraStore with the given DynamoDB client and table name.
+// The store writes to the live partition (EVENT#LEITURA).
 func NewLeituraStore(client DynamoDBClient, tableName string) *LeituraStore {
 	return &LeituraStore{
 		client:    client,
 		tableName: tableName,
+		partition: LivePartition,
+		served:    true,
+	}
+}
+
+// WithPartition returns a copy of the store that reads and writes the given partition.
+// Country aggregates only follow the live partition, so other partitions
+// never update them. Writes to the shadow partition, which the API does not
+// serve, leave the data version unchanged.
+func (s *LeituraStore) WithPartition(partition string) *LeituraStore {
+	clone := *s
+	clone.partition = partition
+	if partition != LivePartition {
+		clone.aggregates = nil
 	}
+	clone.served = partition != ShadowPartition
+	return &clone
+}
+
+// WithAggregates returns a copy of the store that keeps the country
+// aggregates up to date whenever a user's readings are replaced.
+func (s *LeituraStore) WithAggregates(aggregates *AggregateStore) *LeituraStore {
+	clone := *s
+	clone.aggregates = aggregates
+	return &clone
+}
+
+// MaxTransactItems is the DynamoDB limit of actions per TransactWriteItems call.
+const MaxTransactItems = 100
+
+// readingKey identifies a reading item.
+type readingKey struct {
+	PK string `dynamodbav:"PK"`
+	SK string `dynamodbav:"SK"`
 }
 
-// SaveLeitura persists a LeituraItem to DynamoDB.
+// ReplaceUserReadings replaces all readings of a user in the store's partition
+// with items (their PK is set to the partition, and their CountryKey to the
+// ISO3 in the live partition only, so the CountryIndex serves live readings).
+//
+// Readings identical to the stored ones (apart from the webhook UUID, which
+// keeps the last webhook that changed the reading, and the update date) are
+// not rewritten, so a webhook only costs one action per book that actually
+// changed or went away.
+// Puts and deletes of stale items are sent in a single TransactWriteItems call,
+// so readers never observe the user with zero (or half of their) countries and
+// a crash cannot lose data. A change that exceeds MaxTransactItems actions
+// (e.g. a user's first webhook with over a hundred books) cannot be applied
+// atomically, so it is rejected with ErrTooManyChanges. Only partitions the
+// API does not serve (the rebuild's shadow partition) accept it, writing new
+// items before deleting stale ones.
+//
+// Guards (see UserStateStore.Guard) are added to every transaction; if one of
+// them fails, nothing in that transaction is written.
+//
+// Once the readings are saved, the country aggregates are updated. A failure
+// there is only logged: a retry would find no change left to apply, so the
+// drift is repaired by the aggregate reconciliation (rebuild mode=aggregates).
 //
 // Returns:
-//   - error: ErrDynamoDBWrite if the write fails
-func (s *LeituraStore) SaveLeitura(ctx context.Context, item types.LeituraItem) error {
-	av, err := attributevalue.MarshalMap(item)
+//   - error: ErrDynamoDBRead if existing readings cannot be listed,
+//     ErrSuperseded if a guard condition fails,
+//     ErrTooManyChanges if the change does not fit in one transaction,
+//     ErrDynamoDBWrite if the write fails
+func (s *LeituraStore) ReplaceUserReadings(ctx context.Context, user string, items []types.LeituraItem, guards ...ddbtypes.TransactWriteItem) error {
+	return s.ReplaceUserReadingsWith(ctx, user, items, nil, guards...)
+}
+
+// ReplaceUserReadingsWith is ReplaceUserReadings with extra actions (e.g. the
+// history records of the change) written in the same transaction as the
+// readings, so they are committed only if the guarded replacement is.
+func (s *LeituraStore) ReplaceUserReadingsWith(ctx context.Context, user string, items []types.LeituraItem, extra []ddbtypes.TransactWriteItem, guards ...ddbtypes.TransactWriteItem) error {
+	previous, err := s.UserReadings(ctx, user)
 	if err != nil {
-		return fmt.Errorf("marshal error: %w", err)
+		return err
 	}
 
-	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(s.tableName),
-		Item:      av,
-	})
-	if err != nil {
-		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	stored := make(map[readingKey]types.LeituraItem, len(previous))
+	for _, item := range previous {
+		stored[readingKey{PK: item.PK, SK: item.SK}] = item
+	}
+
+	unchanged := make(map[readingKey]bool)
+	avs := make([]map[string]ddbtypes.AttributeValue, 0, len(items))
+	for _, item := range items {
+		item.PK = s.partition
+		item.CountryKey = countryKey(s.partition, item.ISO3)
+		key := readingKey{PK: item.PK, SK: item.SK}
+		if current, exists := stored[key]; exists && sameReading(current, item) {
+			unchanged[key] = true
+			continue
+		}
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return fmt.Errorf("marshal error: %w", err)
+		}
+		avs = append(avs, av)
+	}
+
+	previousKeys := make([]readingKey, 0, len(previous))
+	for _, item := range previous {
+		key := readingKey{PK: item.PK, SK: item.SK}
+		if !unchanged[key] {
+			previousKeys = append(previousKeys, key)
+		}
 	}
 
-	log.Printf("Saved leitura: ISO3=%s, User=%s, Progress=%d%%",
-		item.ISO3, item.User, item.Progresso)
+	wrote, err := s.replaceUserItems(ctx, user, avs, previousKeys, extra, guards)
+	if err != nil {
+		return err
+	}
+	if !wrote {
+		return nil // nothing changed: aggregates and ETags stay as they are
+	}
 
+	if s.aggregates != nil {
+		if err := s.aggregates.UpdateUser(ctx, user, previous, items); err != nil {
+			log.Printf("WARN: Failed to update country aggregates for user %s: %v", user, err)
+		}
+	}
+	s.bumpDataVersion(ctx)
 	return nil
 }
 
-// DeleteOldUserReadings removes all existing readings for a user.
-// This ensures each webhook replaces the user's previous data completely.
-// It uses the GSI UserIndex to find items efficiently.
-//
-// Note: This function only deletes EVENT#LEITURA items, not WEBHOOK#PAYLOAD.
+// sameReading reports whether a reading would be stored unchanged, ignoring
+// the UUID of the webhook that sent it and its update date. A desafio without
+// books is dated by the webhook that carried it, so an identical resend would
+// otherwise always look like a change.
+func sameReading(stored, item types.LeituraItem) bool {
+	stored.WebhookUUID, item.WebhookUUID = "", ""
+	stored.UpdatedAt, item.UpdatedAt = "", ""
+	return stored == item
+}
+
+// countryKey returns the CountryIndex key of a reading in the given partition.
+func countryKey(partition, iso3 string) string {
+	if partition != LivePartition {
+		return ""
+	}
+	return iso3
+}
+
+// SetCountryKey indexes a reading written before the CountryIndex existed.
+// The update is conditioned on the item being unchanged since it was read
+// (same updatedAt), so a reading deleted or rewritten meanwhile is left alone.
 //
 // Returns:
-//   - int: Number of items deleted
-//   - error: ErrDynamoDBWrite if deletion fails
-func (s *LeituraStore) DeleteOldUserReadings(ctx context.Context, user string) (int, error) {
-	log.Printf("Querying old readings for user: %s", user)
-
-	// Query using GSI UserIndex
-	result, err := s.client.Query(ctx, &dynamodb.QueryInput{
-		TableName:              aws.String(s.tableName),
-		IndexName:              aws.String("UserIndex"),
-		KeyConditionExpression: aws.String("#user = :user"),
-		ExpressionAttributeNames: map[string]string{
-			"#user": "user",
+//   - error: ErrSuperseded if the item changed, ErrDynamoDBWrite if the update fails
+func (s *LeituraStore) SetCountryKey(ctx context.Context, item types.LeituraItem) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]ddbtypes.AttributeValue{
+			"PK": &ddbtypes.AttributeValueMemberS{Value: item.PK},
+			"SK": &ddbtypes.AttributeValueMemberS{Value: item.SK},
 		},
+		UpdateExpression:    aws.String("SET countryKey = :key"),
+		ConditionExpression: aws.String("attribute_exists(PK) AND updatedAt = :updatedAt"),
 		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
-			":user": &ddbtypes.AttributeValueMemberS{Value: user},
+			":key":       &ddbtypes.AttributeValueMemberS{Value: countryKey(item.PK, item.ISO3)},
+			":updatedAt": &ddbtypes.AttributeValueMemberS{Value: item.UpdatedAt},
 		},
 	})
-	if err != nil {
-		return 0, fmt.Errorf("query error: %w", err)
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	switch {
+	case errors.As(err, &conditionFailed):
+		return ErrSuperseded
+	case err != nil:
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
 	}
+	return nil
+}
 
-	if len(result.Items) == 0 {
-		log.Printf("No old readings found for user %s", user)
-		return 0, nil
+// bumpDataVersion invalidates the ETags of the read endpoints after a write
+// to a partition they serve. It runs after every derived write (aggregates),
+// so a client never gets a new ETag with data older than it. A failure only
+// delays the refresh until the next write, so it is logged.
+func (s *LeituraStore) bumpDataVersion(ctx context.Context) {
+	if !s.served {
+		return
 	}
+	if err := httpcache.Bump(ctx, s.client, s.tableName); err != nil {
+		log.Printf("WARN: Failed to bump data version: %v", err)
+	}
+}
 
-	// Delete each EVENT#LEITURA item
-	deletedCount := 0
-	for _, item := range result.Items {
-		pk, okPK := item["PK"].(*ddbtypes.AttributeValueMemberS)
-		sk, okSK := item["SK"].(*ddbtypes.AttributeValueMemberS)
+// replaceUserItems writes the marshaled items (and the extra actions) and
+// deletes the previous keys they do not overwrite, as described in
+// ReplaceUserReadings. It reports whether any action was sent.
+func (s *LeituraStore) replaceUserItems(ctx context.Context, user string, items []map[string]ddbtypes.AttributeValue, previous []readingKey, extra, guards []ddbtypes.TransactWriteItem) (bool, error) {
+	newKeys := make(map[readingKey]bool, len(items))
+	puts := make([]ddbtypes.TransactWriteItem, 0, len(items))
+	for _, av := range items {
+		var key readingKey
+		if err := attributevalue.UnmarshalMap(av, &key); err != nil {
+			return false, fmt.Errorf("marshal error: %w", err)
+		}
+		newKeys[key] = true
+		puts = append(puts, ddbtypes.TransactWriteItem{
+			Put: &ddbtypes.Put{
+				TableName: aws.String(s.tableName),
+				Item:      av,
+			},
+		})
+	}
+	puts = append(puts, extra...)
+
+	deletes := make([]ddbtypes.TransactWriteItem, 0, len(previous))
+	for _, key := range previous {
+		if newKeys[key] {
+			continue // overwritten by the put
+		}
+		deletes = append(deletes, ddbtypes.TransactWriteItem{
+			Delete: &ddbtypes.Delete{
+				TableName: aws.String(s.tableName),
+				Key: map[string]ddbtypes.AttributeValue{
+					"PK": &ddbtypes.AttributeValueMemberS{Value: key.PK},
+					"SK": &ddbtypes.AttributeValueMemberS{Value: key.SK},
+				},
+			},
+		})
+	}
 
-		if !okPK || !okSK {
+	actions := append(puts, deletes...)
+	if len(actions) == 0 {
+		return false, nil
+	}
+
+	if len(actions)+len(guards) > MaxTransactItems {
+		if s.served {
+			return false, fmt.Errorf("%w: %d actions for user %s (limit %d)",
+				ErrTooManyChanges, len(actions)+len(guards), user, MaxTransactItems)
+		}
+		log.Printf("WARN: %d actions for user %s exceed transaction limit, writing before deleting",
+			len(actions), user)
+		return true, s.writeThenDelete(ctx, puts, deletes, guards)
+	}
+
+	if err := s.transact(ctx, actions, guards); err != nil {
+		return false, err
+	}
+
+	log.Printf("Replaced %s items for user %s: %d written, %d deleted", s.partition, user, len(puts), len(deletes))
+	return true, nil
+}
+
+// writeThenDelete applies puts before deletes, chunked by MaxTransactItems.
+// Each chunk is atomic, but the whole is not, so it is only used for
+// partitions the API does not serve; the ordering guarantees a failure never
+// leaves the user with fewer readings than before.
+func (s *LeituraStore) writeThenDelete(ctx context.Context, puts, deletes, guards []ddbtypes.TransactWriteItem) error {
+	chunkSize := MaxTransactItems - len(guards)
+	for _, batch := range [][]ddbtypes.TransactWriteItem{puts, deletes} {
+		for start := 0; start < len(batch); start += chunkSize {
+			end := start + chunkSize
+			if end > len(batch) {
+				end = len(batch)
+			}
+			if err := s.transact(ctx, batch[start:end], guards); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("Replaced readings in chunks: %d written, %d deleted", len(puts), len(deletes))
+	return nil
+}
+
+// transact runs actions in a single transaction, preceded by the guard conditions.
+func (s *LeituraStore) transact(ctx context.Context, actions, guards []ddbtypes.TransactWriteItem) error {
+	transactItems := make([]ddbtypes.TransactWriteItem, 0, len(guards)+len(actions))
+	transactItems = append(transactItems, guards...)
+	transactItems = append(transactItems, actions...)
+
+	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		var canceled *ddbtypes.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			for i, reason := range canceled.CancellationReasons {
+				if i < len(guards) && aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+					return ErrSuperseded
+				}
+			}
+		}
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+
+	return nil
+}
+
+// UserReadings returns all readings of a user in the store's partition.
+// It uses the GSI UserIndex (range key PK) so other item types are never read.
+//
+// Returns:
+//   - error: ErrDynamoDBRead if the query fails
+func (s *LeituraStore) UserReadings(ctx context.Context, user string) ([]types.LeituraItem, error) {
+	avs, err := s.queryUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []types.LeituraItem
+	for _, av := range avs {
+		var item types.LeituraItem
+		if err := attributevalue.UnmarshalMap(av, &item); err != nil || item.PK == "" || item.SK == "" {
 			log.Printf("WARN: Invalid item structure, skipping")
 			continue
 		}
+		items = append(items, item)
+	}
 
-		// Only delete EVENT#LEITURA items (protect WEBHOOK#PAYLOAD from deletion)
-		if !strings.HasPrefix(pk.Value, "EVENT#LEITURA") {
-			continue
+	return items, nil
+}
+
+// queryUser returns the raw items of a user in the store's partition.
+// It uses the GSI UserIndex (range key PK) so other item types are never read.
+//
+// Returns:
+//   - error: ErrDynamoDBRead if the query fails
+func (s *LeituraStore) queryUser(ctx context.Context, user string) ([]map[string]ddbtypes.AttributeValue, error) {
+	var items []map[string]ddbtypes.AttributeValue
+	var lastKey map[string]ddbtypes.AttributeValue
+
+	for {
+		result, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.tableName),
+			IndexName:              aws.String("UserIndex"),
+			KeyConditionExpression: aws.String("#user = :user AND begins_with(PK, :pk)"),
+			ExpressionAttributeNames: map[string]string{
+				"#user": "user",
+			},
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":user": &ddbtypes.AttributeValueMemberS{Value: user},
+				":pk":   &ddbtypes.AttributeValueMemberS{Value: s.partition},
+			},
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+		}
+
+		items = append(items, result.Items...)
+
+		if result.LastEvaluatedKey == nil {
+			break
 		}
+		lastKey = result.LastEvaluatedKey
+	}
+
+	return items, nil
+}
 
-		_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-			TableName: aws.String(s.tableName),
-			Key: map[string]ddbtypes.AttributeValue{
-				"PK": &ddbtypes.AttributeValueMemberS{Value: pk.Value},
-				"SK": &ddbtypes.AttributeValueMemberS{Value: sk.Value},
+// QueryReadings returns every reading in the store's partition.
+//
+// Returns:
+//   - error: ErrDynamoDBRead if the query fails
+func (s *LeituraStore) QueryReadings(ctx context.Context) ([]types.LeituraItem, error) {
+	var items []types.LeituraItem
+	var lastKey map[string]ddbtypes.AttributeValue
+
+	for {
+		result, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.tableName),
+			KeyConditionExpression: aws.String("PK = :pk"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":pk": &ddbtypes.AttributeValueMemberS{Value: s.partition},
 			},
+			ExclusiveStartKey: lastKey,
 		})
 		if err != nil {
-			log.Printf("WARN: Failed to delete %s#%s: %v", pk.Value, sk.Value, err)
-			continue
+			return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+		}
+
+		for _, av := range result.Items {
+			var item types.LeituraItem
+			if err := attributevalue.UnmarshalMap(av, &item); err != nil {
+				log.Printf("WARN: Invalid item structure, skipping")
+				continue
+			}
+			items = append(items, item)
+		}
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+
+	return items, nil
+}
+
+// CountryReadings returns the live readings of a country with some progress,
+// through the GSI CountryIndex (countryKey + progresso), so only that
+// country's items are read. Readings written before the index existed are
+// missed until rebuild mode=index sets their countryKey.
+//
+// Returns:
+//   - error: ErrDynamoDBRead if the query fails
+func (s *LeituraStore) CountryReadings(ctx context.Context, iso3 string) ([]types.LeituraItem, error) {
+	var items []types.LeituraItem
+	var lastKey map[string]ddbtypes.AttributeValue
+
+	for {
+		result, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.tableName),
+			IndexName:              aws.String("CountryIndex"),
+			KeyConditionExpression: aws.String("countryKey = :countryKey AND progresso >= :minProgress"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":countryKey":  &ddbtypes.AttributeValueMemberS{Value: iso3},
+				":minProgress": &ddbtypes.AttributeValueMemberN{Value: "1"},
+			},
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+		}
+
+		for _, av := range result.Items {
+			var item types.LeituraItem
+			if err := attributevalue.UnmarshalMap(av, &item); err != nil {
+				log.Printf("WARN: Invalid item structure, skipping")
+				continue
+			}
+			items = append(items, item)
+		}
+
+		if result.LastEvaluatedKey == nil {
+			break
 		}
-		deletedCount++
+		lastKey = result.LastEvaluatedKey
 	}
 
-	log.Printf("Deleted %d old readings for user %s", deletedCount, user)
-	return deletedCount, nil
+	return items, nil
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"fmt"
+
+	"github.com/mundotalendo/functions/types"
 )
 
 // Sentinel errors for consumer processing.
@@ -31,6 +33,24 @@ var (
 	// ErrDynamoDBWrite indicates a DynamoDB write operation failed.
 	// This should trigger a retry.
 	ErrDynamoDBWrite = errors.New("failed to write to DynamoDB")
+
+	// ErrDynamoDBRead indicates a DynamoDB read operation failed.
+	// This should trigger a retry.
+	ErrDynamoDBRead = errors.New("failed to read from DynamoDB")
+
+	// ErrSuperseded indicates a newer webhook was already applied for the user.
+	// This is a permanent failure - do not retry.
+	ErrSuperseded = errors.New("superseded by a newer webhook")
+
+	// ErrTooManyChanges indicates a user's change needs more actions than one
+	// transaction allows, so it cannot be applied atomically.
+	// This is a permanent failure - do not retry.
+	ErrTooManyChanges = errors.New("too many changes for a single transaction")
+
+	// ErrEventPublish indicates reading events could not be published.
+	// Events are published after the readings are saved, so this is logged
+	// and never retried.
+	ErrEventPublish = errors.New("failed to publish reading events")
 )
 
 // ProcessingError wraps an error with additional context about the processing failure.
@@ -61,13 +81,16 @@ func IsRetryable(err error) bool {
 	// Permanent failures - do not retry
 	if errors.Is(err, ErrInvalidMessage) ||
 		errors.Is(err, ErrPayloadNotFound) ||
-		errors.Is(err, ErrInvalidPayload) {
+		errors.Is(err, ErrInvalidPayload) ||
+		errors.Is(err, ErrSuperseded) ||
+		errors.Is(err, ErrTooManyChanges) {
 		return false
 	}
 
 	// Transient failures - retry
 	if errors.Is(err, ErrS3Fetch) ||
-		errors.Is(err, ErrDynamoDBWrite) {
+		errors.Is(err, ErrDynamoDBWrite) ||
+		errors.Is(err, ErrDynamoDBRead) {
 		return true
 	}
 
@@ -84,3 +107,34 @@ func WrapError(op, uuid, country string, err error) *ProcessingError {
 		Err:     err,
 	}
 }
+
+// ErrorCode maps an error to a stable code for status records and failure logs.
+// Codes of permanent failures match the FalhaItem error types (types.ErrorType*).
+func ErrorCode(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrInvalidMessage):
+		return types.ErrorTypeInvalidMessage
+	case errors.Is(err, ErrPayloadNotFound):
+		return types.ErrorTypePayloadNotFound
+	case errors.Is(err, ErrS3Fetch):
+		return "S3_FETCH_ERROR"
+	case errors.Is(err, ErrInvalidPayload):
+		return types.ErrorTypeInvalidPayload
+	case errors.Is(err, ErrCountryNotFound):
+		return types.ErrorTypeCountryNotFound
+	case errors.Is(err, ErrDynamoDBWrite):
+		return "DYNAMODB_WRITE_ERROR"
+	case errors.Is(err, ErrDynamoDBRead):
+		return "DYNAMODB_READ_ERROR"
+	case errors.Is(err, ErrSuperseded):
+		return "SUPERSEDED"
+	case errors.Is(err, ErrTooManyChanges):
+		return types.ErrorTypeTooManyChanges
+	case errors.Is(err, ErrEventPublish):
+		return "EVENT_PUBLISH_ERROR"
+	default:
+		return "UNKNOWN_ERROR"
+	}
+}
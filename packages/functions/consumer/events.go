@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// Reading event types.
+const (
+	EventStarted          = "STARTED"            // A book got its first progress
+	EventProgressed       = "PROGRESSED"         // Progress went up without completing the book
+	EventCompleted        = "COMPLETED"          // The book reached 100% (Completo or Concluido)
+	EventAbandoned        = "ABANDONED"          // An unfinished book was removed from the desafio
+	EventFirstInCommunity = "FIRST_IN_COMMUNITY" // Nobody in the community had read the country before
+)
+
+// MaxPublishBatch is the maximum number of events per SNS PublishBatch call.
+const MaxPublishBatch = 10
+
+// ReadingEvent is a milestone detected between a user's stored readings and
+// the readings of a new webhook.
+type ReadingEvent struct {
+	Type              string `json:"type"`
+	User              string `json:"user"`
+	ISO3              string `json:"iso3"`
+	Pais              string `json:"pais"`
+	Livro             string `json:"livro,omitempty"`
+	VinculadoID       string `json:"vinculadoID,omitempty"`
+	Progresso         int    `json:"progresso"`
+	ProgressoAnterior *int   `json:"progressoAnterior,omitempty"`
+	WebhookUUID       string `json:"webhookUUID"`
+	Timestamp         string `json:"timestamp"` // RFC3339 of the webhook reception
+}
+
+// EventPublisher delivers reading events to their consumers.
+type EventPublisher interface {
+	Publish(ctx context.Context, events []ReadingEvent) error
+}
+
+// SNSClient defines the interface for SNS operations.
+// This interface enables mocking in unit tests.
+type SNSClient interface {
+	PublishBatch(ctx context.Context, params *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error)
+}
+
+// SNSPublisher publishes reading events to an SNS topic. Each event carries a
+// "type" message attribute so subscribers can filter by event type.
+type SNSPublisher struct {
+	client   SNSClient
+	topicARN string
+}
+
+// NewSNSPublisher creates a new SNSPublisher for the given topic.
+func NewSNSPublisher(client SNSClient, topicARN string) *SNSPublisher {
+	return &SNSPublisher{
+		client:   client,
+		topicARN: topicARN,
+	}
+}
+
+// Publish sends the events in batches of MaxPublishBatch.
+//
+// Returns:
+//   - error: ErrEventPublish if a batch or any entry of it fails
+func (p *SNSPublisher) Publish(ctx context.Context, events []ReadingEvent) error {
+	for start := 0; start < len(events); start += MaxPublishBatch {
+		end := min(start+MaxPublishBatch, len(events))
+
+		entries := make([]snstypes.PublishBatchRequestEntry, 0, end-start)
+		for i, event := range events[start:end] {
+			body, err := json.Marshal(event)
+			if err != nil {
+				return fmt.Errorf("marshal error: %w", err)
+			}
+			entries = append(entries, snstypes.PublishBatchRequestEntry{
+				Id:      aws.String(strconv.Itoa(start + i)),
+				Message: aws.String(string(body)),
+				MessageAttributes: map[string]snstypes.MessageAttributeValue{
+					"type": {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+				},
+			})
+		}
+
+		result, err := p.client.PublishBatch(ctx, &sns.PublishBatchInput{
+			TopicArn:                   aws.String(p.topicARN),
+			PublishBatchRequestEntries: entries,
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrEventPublish, err)
+		}
+		if len(result.Failed) > 0 {
+			return fmt.Errorf("%w: %d of %d events failed (%s)", ErrEventPublish,
+				len(result.Failed), len(entries), aws.ToString(result.Failed[0].Message))
+		}
+	}
+	return nil
+}
+
+// MemoryPublisher keeps published events in memory, for tests and local runs.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []ReadingEvent
+}
+
+// Publish appends the events.
+func (p *MemoryPublisher) Publish(ctx context.Context, events []ReadingEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, events...)
+	return nil
+}
+
+// Events returns a copy of the published events.
+func (p *MemoryPublisher) Events() []ReadingEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ReadingEvent(nil), p.events...)
+}
+
+// EventEmitter detects reading milestones and publishes them.
+type EventEmitter struct {
+	publisher EventPublisher
+	community *CommunityStore // nil disables FIRST_IN_COMMUNITY events
+}
+
+// NewEventEmitter creates a new EventEmitter.
+func NewEventEmitter(publisher EventPublisher, community *CommunityStore) *EventEmitter {
+	return &EventEmitter{
+		publisher: publisher,
+		community: community,
+	}
+}
+
+// Emit publishes the milestones between the user's previous readings and the
+// readings just saved. It runs after the readings are replaced, so events are
+// delivered at most once: a failure is returned but must not trigger a retry,
+// which would find no difference left to report.
+func (e *EventEmitter) Emit(ctx context.Context, previous, items []types.LeituraItem, meta ProcessingMeta) error {
+	events := detectEvents(previous, items, meta)
+
+	if e.community != nil {
+		firsts, err := e.firstInCommunity(ctx, previous, events, meta)
+		if err != nil {
+			log.Printf("WARN: Failed to check first readers for user %s: %v", meta.User, err)
+		}
+		events = append(events, firsts...)
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+	if err := e.publisher.Publish(ctx, events); err != nil {
+		return err
+	}
+
+	log.Printf("Published %d reading events for user %s", len(events), meta.User)
+	return nil
+}
+
+// firstInCommunity returns a FIRST_IN_COMMUNITY event for every country the
+// user started reading that nobody had read before. Countries the user had
+// already read are skipped, so starting another book there is not a first.
+func (e *EventEmitter) firstInCommunity(ctx context.Context, previous []types.LeituraItem, events []ReadingEvent, meta ProcessingMeta) ([]ReadingEvent, error) {
+	var firsts []ReadingEvent
+	claimed := make(map[string]bool)
+	for _, item := range previous {
+		if item.Progresso > 0 {
+			claimed[item.ISO3] = true
+		}
+	}
+
+	for _, event := range events {
+		if event.Type != EventStarted || claimed[event.ISO3] {
+			continue
+		}
+		claimed[event.ISO3] = true
+
+		first, err := e.community.ClaimFirstReader(ctx, event.ISO3, meta.User, meta.UUID)
+		if err != nil {
+			return firsts, err
+		}
+		if first {
+			firsts = append(firsts, ReadingEvent{
+				Type:        EventFirstInCommunity,
+				User:        event.User,
+				ISO3:        event.ISO3,
+				Pais:        event.Pais,
+				Livro:       event.Livro,
+				VinculadoID: event.VinculadoID,
+				Progresso:   event.Progresso,
+				WebhookUUID: event.WebhookUUID,
+				Timestamp:   event.Timestamp,
+			})
+		}
+	}
+
+	return firsts, nil
+}
+
+// detectEvents compares the user's previous readings with the new ones, book
+// by book (see historyBookKey). An unchanged resend yields no events.
+//
+// A book with first progress is STARTED (and also COMPLETED when it arrives
+// at 100%); reaching 100% is COMPLETED; other increases are PROGRESSED;
+// an unfinished book missing from the new readings is ABANDONED. Decreases
+// are not reported.
+func detectEvents(previous, items []types.LeituraItem, meta ProcessingMeta) []ReadingEvent {
+	before := make(map[string]types.LeituraItem, len(previous))
+	for _, item := range previous {
+		before[historyBookKey(item)] = item
+	}
+
+	timestamp := meta.Timestamp.UTC().Format(time.RFC3339)
+	newEvent := func(eventType string, item types.LeituraItem, anterior *int) ReadingEvent {
+		return ReadingEvent{
+			Type:              eventType,
+			User:              meta.User,
+			ISO3:              item.ISO3,
+			Pais:              item.Pais,
+			Livro:             item.Livro,
+			VinculadoID:       item.VinculadoID,
+			Progresso:         item.Progresso,
+			ProgressoAnterior: anterior,
+			WebhookUUID:       meta.UUID,
+			Timestamp:         timestamp,
+		}
+	}
+
+	var events []ReadingEvent
+	current := make(map[string]bool, len(items))
+	for _, item := range items {
+		key := historyBookKey(item)
+		current[key] = true
+
+		prev, found := before[key]
+		var anterior *int
+		if found {
+			progress := prev.Progresso
+			anterior = &progress
+		}
+
+		switch {
+		case item.Progresso <= prev.Progresso:
+			// Unchanged, decreased or still not started
+		case prev.Progresso == 0:
+			events = append(events, newEvent(EventStarted, item, anterior))
+			if item.Progresso == 100 {
+				events = append(events, newEvent(EventCompleted, item, anterior))
+			}
+		case item.Progresso == 100:
+			events = append(events, newEvent(EventCompleted, item, anterior))
+		default:
+			events = append(events, newEvent(EventProgressed, item, anterior))
+		}
+	}
+
+	var abandoned []ReadingEvent
+	for key, prev := range before {
+		if current[key] || prev.Progresso < 1 || prev.Progresso >= 100 {
+			continue
+		}
+		progress := prev.Progresso
+		event := newEvent(EventAbandoned, prev, &progress)
+		event.Progresso = 0
+		abandoned = append(abandoned, event)
+	}
+	sort.Slice(abandoned, func(i, j int) bool {
+		if abandoned[i].ISO3 != abandoned[j].ISO3 {
+			return abandoned[i].ISO3 < abandoned[j].ISO3
+		}
+		return abandoned[i].Livro < abandoned[j].Livro
+	})
+
+	return append(events, abandoned...)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// Mock SNS client for testing
+type mockSNSClient struct {
+	batches []*sns.PublishBatchInput
+	failed  []snstypes.BatchResultErrorEntry
+}
+
+func (m *mockSNSClient) PublishBatch(ctx context.Context, params *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error) {
+	m.batches = append(m.batches, params)
+	return &sns.PublishBatchOutput{Failed: m.failed}, nil
+}
+
+// eventTypes returns the type of each event, in order.
+func eventTypes(events []ReadingEvent) []string {
+	var result []string
+	for _, e := range events {
+		result = append(result, e.Type+":"+e.ISO3)
+	}
+	return result
+}
+
+func TestDetectEvents(t *testing.T) {
+	meta := ProcessingMeta{UUID: "uuid-2", User: "Maria", Timestamp: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	previous := []types.LeituraItem{
+		{ISO3: "CHL", VinculadoID: "v1", Progresso: 20},
+		{ISO3: "PER", VinculadoID: "v2", Progresso: 50},
+		{ISO3: "ARG", VinculadoID: "v3", Progresso: 30},
+		{ISO3: "URY", VinculadoID: "v4", Progresso: 70},
+		{ISO3: "COL", VinculadoID: "v5", Progresso: 100},
+		{ISO3: "BOL"},
+	}
+	items := []types.LeituraItem{
+		{ISO3: "CHL", VinculadoID: "v1", Progresso: 60},  // progressed
+		{ISO3: "PER", VinculadoID: "v2", Progresso: 100}, // completed
+		{ISO3: "URY", VinculadoID: "v4", Progresso: 40},  // decreased, not reported
+		{ISO3: "BOL", Progresso: 10},                     // started
+		{ISO3: "BRA", VinculadoID: "v6", Progresso: 100}, // new book, already finished
+		{ISO3: "JPN"}, // new country, nothing read yet
+		// ARG missing: abandoned; COL missing but finished: not reported
+	}
+
+	got := eventTypes(detectEvents(previous, items, meta))
+	want := []string{"PROGRESSED:CHL", "COMPLETED:PER", "STARTED:BOL", "STARTED:BRA", "COMPLETED:BRA", "ABANDONED:ARG"}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+
+	if resend := detectEvents(items, items, meta); len(resend) != 0 {
+		t.Errorf("expected no events for an unchanged resend, got %v", eventTypes(resend))
+	}
+}
+
+func TestSNSPublisher_PublishesInBatches(t *testing.T) {
+	client := &mockSNSClient{}
+	publisher := NewSNSPublisher(client, "topic-arn")
+
+	published := make([]ReadingEvent, MaxPublishBatch+1)
+	for i := range published {
+		published[i] = ReadingEvent{Type: EventStarted, User: "Maria", ISO3: "CHL"}
+	}
+
+	if err := publisher.Publish(context.Background(), published); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.batches) != 2 || len(client.batches[1].PublishBatchRequestEntries) != 1 {
+		t.Fatalf("expected batches of 10 and 1, got %d batches", len(client.batches))
+	}
+	attr := client.batches[0].PublishBatchRequestEntries[0].MessageAttributes["type"]
+	if aws.ToString(attr.StringValue) != EventStarted {
+		t.Errorf("expected type attribute %s, got %s", EventStarted, aws.ToString(attr.StringValue))
+	}
+
+	client.failed = []snstypes.BatchResultErrorEntry{{Id: aws.String("0"), Message: aws.String("throttled")}}
+	if err := publisher.Publish(context.Background(), published[:1]); ErrorCode(err) != "EVENT_PUBLISH_ERROR" {
+		t.Errorf("expected EVENT_PUBLISH_ERROR for failed entries, got %v", err)
+	}
+}
+
+func TestProcessRecord_PublishesMilestones(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	c := newTestConsumer(&mockS3Client{payload: historyPayload}, dynamoClient)
+	publisher := c.processor.events.publisher.(*MemoryPublisher)
+
+	first := events.SQSMessage{Body: `{"uuid":"uuid-1","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`}
+	if err := c.processRecord(context.Background(), first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := eventTypes(publisher.Events())
+	if len(got) != 2 || got[0] != "STARTED:CHL" || got[1] != "FIRST_IN_COMMUNITY:CHL" {
+		t.Fatalf("expected STARTED and FIRST_IN_COMMUNITY for CHL, got %v", got)
+	}
+	if len(dynamoClient.putsWithPrefix(types.CommunityCountryPartition)) != 1 {
+		t.Error("expected the country to be marked as read by the community")
+	}
+
+	// Resend: the saved readings become the user's current readings
+	var saved []map[string]ddbtypes.AttributeValue
+	for _, item := range dynamoClient.transacts[0].TransactItems {
+		if item.Put != nil {
+			saved = append(saved, item.Put.Item)
+		}
+	}
+	dynamoClient.partitions = map[string][]map[string]ddbtypes.AttributeValue{LivePartition: saved}
+
+	resend := events.SQSMessage{Body: `{"uuid":"uuid-2","user":"Test User","timestamp":"2026-01-14T11:00:00Z"}`}
+	if err := c.processRecord(context.Background(), resend); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(publisher.Events()); n != 2 {
+		t.Errorf("expected no events for an identical resend, got %d in total", n)
+	}
+}
+
+func TestClaimFirstReader_ReadBeforeMarkers(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		countries: map[string][]map[string]ddbtypes.AttributeValue{
+			"CHL": {mustMarshal(t, types.LeituraItem{User: "Ana", ISO3: "CHL", Progresso: 30, UpdatedAt: "2026-01-02T10:00:00Z"})},
+		},
+	}
+	community := NewCommunityStore(dynamoClient, "test-table", NewLeituraStore(dynamoClient, "test-table"))
+
+	first, err := community.ClaimFirstReader(context.Background(), "CHL", "Maria", "uuid-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first {
+		t.Error("expected Maria not to be first: Ana read CHL before markers existed")
+	}
+
+	puts := dynamoClient.putsWithPrefix(types.CommunityCountryPartition)
+	if len(puts) != 1 {
+		t.Fatalf("expected the marker to be written, got %d puts", len(puts))
+	}
+	if user := puts[0].Item["firstUser"].(*ddbtypes.AttributeValueMemberS).Value; user != "Ana" {
+		t.Errorf("expected Ana recorded as first reader, got %s", user)
+	}
+	if len(dynamoClient.indexed) != 1 || dynamoClient.indexed[0] != "CHL" {
+		t.Errorf("expected a single CountryIndex query for CHL, got %v", dynamoClient.indexed)
+	}
+}
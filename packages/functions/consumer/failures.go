@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/mundotalendo/functions/types"
+)
+
+// FailureStore handles DynamoDB operations for FalhaItem records.
+type FailureStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewFailureStore creates a new FailureStore with the given DynamoDB client and table name.
+func NewFailureStore(client DynamoDBClient, tableName string) *FailureStore {
+	return &FailureStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// SaveFailure persists a FalhaItem to DynamoDB.
+// Keys are derived from the error type, user and country, so a redelivery or
+// a resend that fails the same way overwrites the record instead of
+// duplicating it.
+//
+// Returns:
+//   - error: ErrDynamoDBWrite if the write fails
+func (s *FailureStore) SaveFailure(ctx context.Context, item types.FalhaItem) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+
+	log.Printf("Saved failure: Type=%s, UUID=%s, User=%s", item.ErrorType, item.WebhookUUID, item.User)
+	return nil
+}
+
+// newFalhaItem creates a failure record for a webhook message.
+// Messages that could not be parsed have no user; they are keyed by a hash of
+// the message body instead, so only the same body overwrites them.
+func newFalhaItem(msg types.SQSMessage, err error, pais, originalPayload string) types.FalhaItem {
+	errorType := ErrorCode(err)
+	subject := pais
+	if msg.User == "" {
+		sum := sha256.Sum256([]byte(originalPayload))
+		subject = hex.EncodeToString(sum[:8])
+	}
+	pk, sk := types.FalhaKey(errorType, msg.User, subject)
+
+	return types.FalhaItem{
+		PK:              pk,
+		SK:              sk,
+		ErrorType:       errorType,
+		ErrorMessage:    err.Error(),
+		OriginalPayload: originalPayload,
+		WebhookUUID:     msg.UUID,
+		User:            msg.User,
+		Pais:            pais,
+		CreatedAt:       time.Now().UTC().Format(time.RFC3339),
+	}
+}
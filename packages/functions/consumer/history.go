@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// HistoryStore appends reading history records (HISTORY#COUNTRY#<iso3>).
+// Records are never updated or deleted: each one describes a progress change
+// of a user's book, as brought by a webhook.
+type HistoryStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewHistoryStore creates a new HistoryStore with the given DynamoDB client and table name.
+func NewHistoryStore(client DynamoDBClient, tableName string) *HistoryStore {
+	return &HistoryStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Puts returns the transaction actions writing the history records, so they
+// are committed together with the readings they describe (see
+// LeituraStore.ReplaceUserReadingsWith). Keys are derived from the webhook
+// timestamp, so retrying the same message rewrites the same records instead
+// of duplicating them.
+func (s *HistoryStore) Puts(entries []types.HistoryItem) ([]ddbtypes.TransactWriteItem, error) {
+	puts := make([]ddbtypes.TransactWriteItem, 0, len(entries))
+	for _, entry := range entries {
+		av, err := attributevalue.MarshalMap(entry)
+		if err != nil {
+			return nil, fmt.Errorf("marshal error: %w", err)
+		}
+		puts = append(puts, ddbtypes.TransactWriteItem{
+			Put: &ddbtypes.Put{
+				TableName: aws.String(s.tableName),
+				Item:      av,
+			},
+		})
+	}
+	return puts, nil
+}
+
+// historyEntries compares the user's previous readings with the new ones and
+// returns a record for every book whose progress changed. Books seen for the
+// first time are recorded once they have some progress; removed books and
+// resends with identical progress produce no records.
+func historyEntries(previous, items []types.LeituraItem, meta ProcessingMeta) []types.HistoryItem {
+	before := make(map[string]int, len(previous))
+	for _, item := range previous {
+		before[historyBookKey(item)] = item.Progresso
+	}
+
+	timestamp := meta.Timestamp.UTC().Format(types.HistoryTimeLayout)
+	var entries []types.HistoryItem
+	for _, item := range items {
+		key := historyBookKey(item)
+
+		var anterior *int
+		if progress, found := before[key]; found {
+			if progress == item.Progresso {
+				continue
+			}
+			anterior = &progress
+		} else if item.Progresso == 0 {
+			continue
+		}
+
+		entries = append(entries, types.HistoryItem{
+			PK:                types.HistoryPartition(item.ISO3),
+			SK:                timestamp + "#" + meta.User + "#" + key,
+			User:              meta.User,
+			ISO3:              item.ISO3,
+			Pais:              item.Pais,
+			Livro:             item.Livro,
+			VinculadoID:       item.VinculadoID,
+			Progresso:         item.Progresso,
+			ProgressoAnterior: anterior,
+			WebhookUUID:       meta.UUID,
+			Timestamp:         timestamp,
+		})
+	}
+
+	return entries
+}
+
+// historyBookKey identifies a user's book within a country across webhooks.
+// Readings saved before linked books were tracked have no vinculado ID and
+// are matched by title.
+func historyBookKey(item types.LeituraItem) string {
+	book := item.VinculadoID
+	if book == "" {
+		book = item.Livro
+	}
+	if book == "" {
+		book = "-"
+	}
+	return item.ISO3 + "#" + book
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+const historyPayload = `{"perfil": {"nome": "Test User"}, "desafios": [{"descricao": "Chile", "tipo": "leitura", "vinculados": [{"id": "v1", "progresso": 40, "updatedAt": "2026-01-14T09:00:00Z"}]}]}`
+
+func TestHistoryEntries(t *testing.T) {
+	meta := ProcessingMeta{UUID: "uuid-2", User: "Maria", Timestamp: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	previous := []types.LeituraItem{
+		{ISO3: "CHL", VinculadoID: "v1", Progresso: 20},
+		{ISO3: "PER", VinculadoID: "v2", Progresso: 50},
+		{ISO3: "ARG", Livro: "Ficciones", Progresso: 100}, // read before linked books were tracked
+	}
+	items := []types.LeituraItem{
+		{ISO3: "CHL", Pais: "Chile", VinculadoID: "v1", Progresso: 60},
+		{ISO3: "PER", VinculadoID: "v2", Progresso: 50},   // unchanged
+		{ISO3: "ARG", Livro: "Ficciones", Progresso: 100}, // unchanged
+		{ISO3: "BRA", VinculadoID: "v3", Progresso: 10},   // new book
+		{ISO3: "JPN"}, // new country, nothing read yet
+	}
+
+	entries := historyEntries(previous, items, meta)
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	chile := entries[0]
+	if chile.PK != "HISTORY#COUNTRY#CHL" || chile.SK != "2026-03-01T12:00:00.000000000Z#Maria#CHL#v1" {
+		t.Errorf("unexpected key: %s / %s", chile.PK, chile.SK)
+	}
+	if chile.Progresso != 60 || chile.ProgressoAnterior == nil || *chile.ProgressoAnterior != 20 {
+		t.Errorf("expected 20 -> 60, got %+v", chile)
+	}
+	if chile.WebhookUUID != "uuid-2" || chile.User != "Maria" {
+		t.Errorf("expected webhook and user to be recorded, got %+v", chile)
+	}
+	if entries[1].ISO3 != "BRA" || entries[1].ProgressoAnterior != nil {
+		t.Errorf("expected first reading of BRA without previous progress, got %+v", entries[1])
+	}
+}
+
+func TestProcessRecord_ResendWritesNoHistory(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	c := newTestConsumer(&mockS3Client{payload: historyPayload}, dynamoClient)
+
+	first := events.SQSMessage{Body: `{"uuid":"uuid-1","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`}
+	if err := c.processRecord(context.Background(), first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(dynamoClient.transactPutsWithPrefix(types.HistoryPartitionPrefix)); n != 1 {
+		t.Fatalf("expected 1 history record for the first webhook, got %d", n)
+	}
+
+	// The saved readings become the user's current readings
+	saved := dynamoClient.transactPutsWithPrefix(LivePartition)
+	dynamoClient.partitions = map[string][]map[string]ddbtypes.AttributeValue{LivePartition: saved}
+
+	resend := events.SQSMessage{Body: `{"uuid":"uuid-2","user":"Test User","timestamp":"2026-01-14T11:00:00Z"}`}
+	if err := c.processRecord(context.Background(), resend); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(dynamoClient.transactPutsWithPrefix(types.HistoryPartitionPrefix)); n != 1 {
+		t.Errorf("expected no history record for an identical resend, got %d in total", n)
+	}
+
+	var record types.HistoryItem
+	if err := attributevalue.UnmarshalMap(dynamoClient.transactPutsWithPrefix(types.HistoryPartitionPrefix)[0], &record); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if record.ISO3 != "CHL" || record.Progresso != 40 || record.WebhookUUID != "uuid-1" {
+		t.Errorf("unexpected history record: %+v", record)
+	}
+}
+
+func TestProcessAll_HistoryOnlyWithGuardedReplace(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		transactErr: &ddbtypes.TransactionCanceledException{
+			CancellationReasons: []ddbtypes.CancellationReason{
+				{Code: aws.String("ConditionalCheckFailed")},
+			},
+		},
+	}
+	processor := NewDesafioProcessor(
+		NewLeituraStore(dynamoClient, "test-table"),
+		NewUserStateStore(dynamoClient, "test-table"),
+		nil, NewHistoryStore(dynamoClient, "test-table"), nil, nil,
+	)
+
+	var payload types.WebhookPayload
+	if err := json.Unmarshal([]byte(historyPayload), &payload); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	_, _, results := processor.ProcessAll(context.Background(), &payload, ProcessingMeta{UUID: "old-uuid", User: "Test User"})
+
+	if !isSuperseded(results) {
+		t.Fatalf("expected superseded results, got %+v", results)
+	}
+	// The records were only part of the cancelled transaction, never written apart
+	if n := len(dynamoClient.putsWithPrefix(types.HistoryPartitionPrefix)); n != 0 {
+		t.Errorf("expected no history written outside the transaction, got %d", n)
+	}
+	if len(dynamoClient.transacts) != 1 || dynamoClient.transacts[0].TransactItems[0].ConditionCheck == nil {
+		t.Fatal("expected a single transaction led by the user state guard")
+	}
+	if n := len(dynamoClient.transactPutsWithPrefix(types.HistoryPartitionPrefix)); n != 1 {
+		t.Errorf("expected the history record inside the guarded transaction, got %d", n)
+	}
+}
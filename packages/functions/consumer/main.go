@@ -2,17 +2,29 @@
 //
 // This Lambda is triggered by SQS messages containing webhook metadata.
 // The actual payload is stored in S3 to avoid SQS message size limits.
+// It also serves the admin routes (GET /admin/dlq, POST /admin/dlq/redrive,
+// POST /admin/aliases) and the rebuild job (see rebuild.go), which reuse the
+// same processing path to replay dead-lettered messages, reprocess users after
+// an alias is registered and recompute readings from the S3 archive.
 //
 // Processing flow:
 //  1. Parse SQS message to get UUID
-//  2. Fetch full payload from S3
-//  3. Delete old user readings from DynamoDB
-//  4. Process each desafio (country reading)
-//  5. Save new readings to DynamoDB
+//  2. Record PROCESSING status
+//  3. Claim the per-user state (skip messages older than the last applied one)
+//  4. Fetch full payload from S3
+//  5. Process each desafio (country reading)
+//  6. Append progress changes to the reading history, then atomically replace
+//     the user's readings in DynamoDB and publish reading events (see events.go)
+//  7. Record final status (PROCESSED/PARTIAL/FAILED/SUPERSEDED) with per-desafio outcomes
+//
+// Batches are processed with partial batch responses: records are grouped by
+// user (sequential, oldest first) and users are processed in parallel.
 //
 // Error handling:
-//   - Permanent errors (invalid message, missing payload): Return nil to prevent retry
-//   - Transient errors (S3 timeout, DynamoDB throttle): Return error to trigger retry
+//   - Permanent errors (invalid message, missing payload, change too large for one transaction):
+//     Not reported, so the message is not retried
+//   - Superseded messages (older than the user's last applied webhook): ErrSuperseded, logged and skipped
+//   - Transient errors (S3 timeout, DynamoDB throttle): Reported in BatchItemFailures to trigger retry
 //   - Partial failures (some countries fail): Log and continue, return nil
 package main
 
@@ -20,8 +32,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -29,6 +45,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/mundotalendo/functions/auth"
 	"github.com/mundotalendo/functions/types"
 )
 
@@ -43,6 +62,13 @@ type Consumer struct {
 	fetcher   *PayloadFetcher
 	store     *LeituraStore
 	processor *DesafioProcessor
+	status    *StatusStore
+	state     *UserStateStore
+	failures  *FailureStore
+	aliases   *AliasStore
+	unmapped  *UnmappedStore
+	dlq       *DLQ                 // nil when the DLQ URL is not configured
+	apiKeys   auth.DynamoDBScanAPI // Admin key validation for admin requests
 }
 
 // Global consumer instance (initialized in init or lazily on first request)
@@ -93,36 +119,151 @@ func initConsumer() {
 
 	// Initialize consumer components
 	fetcher := NewPayloadFetcher(s3Client, bucketName)
-	store := NewLeituraStore(dynamoClient, tableName)
-	processor := NewDesafioProcessor(store)
+	store := NewLeituraStore(dynamoClient, tableName).WithAggregates(NewAggregateStore(dynamoClient, tableName))
+	state := NewUserStateStore(dynamoClient, tableName)
+	aliases := NewAliasStore(dynamoClient, tableName)
+	// Reading events are only published when the topic is linked
+	var emitter *EventEmitter
+	if topicARN := os.Getenv("SST_Resource_ReadingEvents_arn"); topicARN != "" {
+		publisher := NewSNSPublisher(sns.NewFromConfig(cfg), topicARN)
+		emitter = NewEventEmitter(publisher, NewCommunityStore(dynamoClient, tableName, store))
+	} else {
+		log.Printf("WARN: ReadingEvents topic not configured, reading events are disabled")
+	}
+	history := NewHistoryStore(dynamoClient, tableName)
+	processor := NewDesafioProcessor(store, state, aliases, history, emitter, NewActivityStore(dynamoClient, tableName))
+	status := NewStatusStore(dynamoClient, tableName)
 
 	consumer = &Consumer{
 		fetcher:   fetcher,
 		store:     store,
 		processor: processor,
+		status:    status,
+		state:     state,
+		failures:  NewFailureStore(dynamoClient, tableName),
+		aliases:   aliases,
+		unmapped:  NewUnmappedStore(dynamoClient, tableName),
+		apiKeys:   dynamoClient,
+	}
+
+	// The DLQ is only needed by the admin endpoints
+	if dlqURL := os.Getenv("SST_Resource_WebhookDLQ_url"); dlqURL != "" {
+		consumer.dlq = NewDLQ(sqs.NewFromConfig(cfg), dlqURL)
 	}
 
 	log.Printf("Consumer initialized: table=%s, bucket=%s", tableName, bucketName)
 }
 
+// MaxParallelUsers bounds how many users are processed concurrently within a batch.
+// Records of the same user are always processed sequentially.
+const MaxParallelUsers = 5
+
 // handler processes SQS events containing webhook messages.
 // Each SQS record contains a types.SQSMessage with the webhook UUID.
-func handler(ctx context.Context, sqsEvent events.SQSEvent) error {
+//
+// Only records that failed with a retryable error are reported in
+// BatchItemFailures, so SQS redelivers them without reprocessing the rest.
+func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
 	log.Printf("Received %d SQS message(s)", len(sqsEvent.Records))
 
-	for _, record := range sqsEvent.Records {
-		if err := consumer.processRecord(ctx, record); err != nil {
-			// Return error to trigger SQS retry (if retryable)
-			if IsRetryable(err) {
-				log.Printf("Retryable error, will retry: %v", err)
-				return err
+	failures := consumer.processBatch(ctx, sqsEvent.Records)
+	if len(failures) > 0 {
+		log.Printf("Batch complete: %d of %d message(s) will be retried", len(failures), len(sqsEvent.Records))
+	}
+
+	return events.SQSEventResponse{BatchItemFailures: failures}, nil
+}
+
+// processBatch processes records grouped by user, with up to MaxParallelUsers
+// users in parallel, and returns the records that should be retried.
+func (c *Consumer) processBatch(ctx context.Context, records []events.SQSMessage) []events.SQSBatchItemFailure {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures []events.SQSBatchItemFailure
+	)
+	sem := make(chan struct{}, MaxParallelUsers)
+
+	for _, group := range groupByUser(records) {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(group []events.SQSMessage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			for _, record := range group {
+				err := c.processRecord(ctx, record)
+				if err == nil {
+					continue
+				}
+				if errors.Is(err, ErrSuperseded) {
+					log.Printf("Superseded, skipping message %s", record.MessageId)
+					continue
+				}
+				if !IsRetryable(err) {
+					// Non-retryable error - log and continue (message is not redelivered)
+					log.Printf("Non-retryable error, skipping: %v", err)
+					continue
+				}
+
+				log.Printf("Retryable error, will retry message %s: %v", record.MessageId, err)
+				mu.Lock()
+				failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+				mu.Unlock()
 			}
-			// Non-retryable error - log and continue (message goes to DLQ after max retries)
-			log.Printf("Non-retryable error, skipping: %v", err)
+		}(group)
+	}
+
+	wg.Wait()
+	return failures
+}
+
+// groupByUser splits records by SQSMessage.User, each group ordered by
+// messageTimestamp (oldest first). Records that cannot be parsed or dated form
+// their own group and fail in processRecord.
+func groupByUser(records []events.SQSMessage) [][]events.SQSMessage {
+	type entry struct {
+		record    events.SQSMessage
+		timestamp time.Time
+	}
+
+	byUser := make(map[string][]entry)
+	var users []string
+	var invalid [][]events.SQSMessage
+
+	for _, record := range records {
+		var msg types.SQSMessage
+		if err := json.Unmarshal([]byte(record.Body), &msg); err != nil {
+			invalid = append(invalid, []events.SQSMessage{record})
+			continue
+		}
+		if _, exists := byUser[msg.User]; !exists {
+			users = append(users, msg.User)
+		}
+		timestamp, err := messageTimestamp(msg, record)
+		if err != nil {
+			invalid = append(invalid, []events.SQSMessage{record})
+			continue
 		}
+		byUser[msg.User] = append(byUser[msg.User], entry{record: record, timestamp: timestamp})
 	}
 
-	return nil
+	groups := make([][]events.SQSMessage, 0, len(users)+len(invalid))
+	for _, user := range users {
+		entries := byUser[user]
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].timestamp.Before(entries[j].timestamp)
+		})
+
+		group := make([]events.SQSMessage, 0, len(entries))
+		for _, e := range entries {
+			group = append(group, e.record)
+		}
+		groups = append(groups, group)
+	}
+
+	return append(groups, invalid...)
 }
 
 // processRecord handles a single SQS message.
@@ -133,67 +274,225 @@ func (c *Consumer) processRecord(ctx context.Context, record events.SQSMessage)
 	var msg types.SQSMessage
 	if err := json.Unmarshal([]byte(record.Body), &msg); err != nil {
 		log.Printf("ERROR parsing SQS message: %v", err)
+		c.saveFailure(ctx, newFalhaItem(msg, ErrInvalidMessage, "", record.Body))
 		return WrapError("parse_message", "", "", ErrInvalidMessage)
 	}
 
+	// Ordering relies on when the webhook was received; a message that cannot
+	// be dated is failed rather than dated by the consumer's clock
+	timestamp, err := messageTimestamp(msg, record)
+	if err != nil {
+		log.Printf("ERROR dating SQS message: %v", err)
+		c.saveFailure(ctx, newFalhaItem(msg, err, "", record.Body))
+		c.saveStatus(ctx, failureStatus(msg, err, record))
+		return WrapError("parse_timestamp", msg.UUID, "", err)
+	}
+
 	log.Printf("Processing webhook UUID=%s, User=%s", msg.UUID, msg.User)
+	c.saveStatus(ctx, newStatusItem(msg, types.StatusProcessing))
+
+	// Skip messages delivered after a newer webhook for the same user
+	if err := c.state.Claim(ctx, msg.User, msg.UUID, timestamp); err != nil {
+		if errors.Is(err, ErrSuperseded) {
+			c.saveStatus(ctx, newStatusItem(msg, types.StatusSuperseded))
+			return WrapError("claim_user_state", msg.UUID, "", err)
+		}
+		log.Printf("ERROR claiming user state: %v", err)
+		c.saveStatus(ctx, failureStatus(msg, err, record))
+		return WrapError("claim_user_state", msg.UUID, "", err)
+	}
 
 	// Fetch payload from S3
 	payload, err := c.fetcher.FetchPayload(ctx, msg.UUID)
 	if err != nil {
 		log.Printf("ERROR fetching payload: %v", err)
+		c.saveStatus(ctx, failureStatus(msg, err, record))
+		if !IsRetryable(err) {
+			c.saveFailure(ctx, newFalhaItem(msg, err, "", record.Body))
+		}
 		return WrapError("fetch_payload", msg.UUID, "", err)
 	}
 
-	// Delete old user readings
-	if _, err := c.store.DeleteOldUserReadings(ctx, msg.User); err != nil {
-		// Log warning but continue - this is not a fatal error
-		log.Printf("WARN: Failed to delete old readings: %v", err)
-	}
-
 	// Process desafios
 	meta := ProcessingMeta{
-		UUID:      msg.UUID,
-		User:      payload.Perfil.Nome,
-		AvatarURL: payload.Perfil.Imagem,
-		Timestamp: parseTimestamp(msg.Timestamp),
+		UUID:       msg.UUID,
+		User:       payload.Perfil.Nome,
+		AvatarURL:  payload.Perfil.Imagem,
+		ProfileURL: payload.Perfil.Link,
+		Timestamp:  timestamp,
 	}
 
 	processed, errCount, results := c.processor.ProcessAll(ctx, payload, meta)
 
+	// A newer webhook claimed the user while this one was being processed
+	if isSuperseded(results) {
+		log.Printf("Superseded during processing: UUID=%s, User=%s", msg.UUID, msg.User)
+		c.saveStatus(ctx, newStatusItem(msg, types.StatusSuperseded))
+		return WrapError("process_desafios", msg.UUID, "", ErrSuperseded)
+	}
+
 	log.Printf("Processing complete: UUID=%s, Processed=%d, Errors=%d",
 		msg.UUID, processed, errCount)
 
-	// Log individual results for monitoring
+	// Log individual results for monitoring; unmapped countries are recorded
+	// and quarantined until an alias is registered. A rejected replacement
+	// fails every result with the same error, so it is recorded once.
+	rejected := false
 	for _, r := range results {
-		if r.Error != nil && !errors.Is(r.Error, ErrCountryNotFound) {
+		if errors.Is(r.Error, ErrCountryNotFound) {
+			c.saveFailure(ctx, newFalhaItem(msg, r.Error, r.Country, ""))
+			c.recordUnmapped(ctx, r.Country, msg.User, msg.UUID)
+		} else if errors.Is(r.Error, ErrTooManyChanges) && !rejected {
+			rejected = true
+			c.saveFailure(ctx, newFalhaItem(msg, r.Error, "", ""))
+		} else if r.Error != nil {
 			log.Printf("ERROR processing country %s: %v", r.Country, r.Error)
 		}
 	}
 
 	// Determine if we should retry
 	// Only retry if ALL items failed with a retryable error
+	var retryErr error
 	if processed == 0 && errCount > 0 {
 		// Check if any error is retryable
 		for _, r := range results {
 			if r.Error != nil && IsRetryable(r.Error) {
-				return WrapError("process_desafios", msg.UUID, "", ErrDynamoDBWrite)
+				retryErr = WrapError("process_desafios", msg.UUID, "", ErrDynamoDBWrite)
+				break
 			}
 		}
 	}
 
-	return nil
+	status := newStatusItem(msg, "")
+	status.Status, status.Desafios = summarizeResults(results)
+	status.Processed = processed
+	status.Failed = errCount
+	if retryErr != nil {
+		status.Status, status.Attempts = retryStatus(record)
+		status.ErrorCode = ErrorCode(retryErr)
+	}
+	c.saveStatus(ctx, status)
+
+	return retryErr
 }
 
-// parseTimestamp parses an RFC3339 timestamp, returning current time on error.
-func parseTimestamp(ts string) time.Time {
-	t, err := time.Parse(time.RFC3339, ts)
-	if err != nil {
-		return time.Now()
+// saveStatus records a status transition. Failures are logged but never fail
+// message processing - the status record is informational only.
+func (c *Consumer) saveStatus(ctx context.Context, item types.WebhookStatusItem) {
+	if err := c.status.SaveStatus(ctx, item); err != nil {
+		log.Printf("WARN: Failed to save status %s for UUID=%s: %v", item.Status, item.UUID, err)
+	}
+}
+
+// saveFailure records a FalhaItem. Like status records, failures to write it
+// are logged but never fail message processing.
+func (c *Consumer) saveFailure(ctx context.Context, item types.FalhaItem) {
+	if err := c.failures.SaveFailure(ctx, item); err != nil {
+		log.Printf("WARN: Failed to save failure %s for UUID=%s: %v", item.ErrorType, item.WebhookUUID, err)
+	}
+}
+
+// recordUnmapped quarantines an unmapped country. Errors are logged only,
+// the FalhaItem already keeps a trace of the failure.
+func (c *Consumer) recordUnmapped(ctx context.Context, country, user, webhookUUID string) {
+	if err := c.unmapped.Record(ctx, country, user, webhookUUID); err != nil {
+		log.Printf("WARN: Failed to quarantine unmapped country %s: %v", country, err)
+	}
+}
+
+// MaxReceiveCount is how many times SQS delivers a WebhookQueue message before
+// moving it to the DLQ (dlq.retry in sst.config.ts).
+const MaxReceiveCount = 3
+
+// failureStatus builds the status record for a message-level error.
+// Permanent errors are FAILED; retryable ones are RETRYING while SQS will
+// redeliver the message (see retryStatus).
+func failureStatus(msg types.SQSMessage, err error, record events.SQSMessage) types.WebhookStatusItem {
+	item := newStatusItem(msg, types.StatusFailed)
+	if IsRetryable(err) {
+		item.Status, item.Attempts = retryStatus(record)
+	}
+	item.ErrorCode = ErrorCode(err)
+	return item
+}
+
+// retryStatus returns the status of a message that failed with a retryable
+// error, and its delivery count: RETRYING while SQS will redeliver it, FAILED
+// on the last delivery (the message goes to the DLQ). Without a receive count
+// (DLQ redrive) the attempt is final.
+func retryStatus(record events.SQSMessage) (string, int) {
+	attempts, err := strconv.Atoi(record.Attributes["ApproximateReceiveCount"])
+	if err != nil || attempts >= MaxReceiveCount {
+		return types.StatusFailed, attempts
+	}
+	return types.StatusRetrying, attempts
+}
+
+// isSuperseded reports whether the readings replacement was rejected because
+// a newer webhook was claimed for the user.
+func isSuperseded(results []ProcessingResult) bool {
+	for _, r := range results {
+		if errors.Is(r.Error, ErrSuperseded) {
+			return true
+		}
+	}
+	return false
+}
+
+// messageTimestamp returns when the webhook was received: the RFC3339
+// timestamp written by the webhook, or the SQS SentTimestamp attribute (epoch
+// milliseconds) when that is missing or malformed.
+//
+// Returns:
+//   - error: ErrInvalidMessage if neither is usable
+func messageTimestamp(msg types.SQSMessage, record events.SQSMessage) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, msg.Timestamp); err == nil {
+		return t, nil
+	}
+
+	if sent, err := strconv.ParseInt(record.Attributes["SentTimestamp"], 10, 64); err == nil && sent > 0 {
+		log.Printf("WARN: Invalid timestamp %q for UUID=%s, using SQS SentTimestamp", msg.Timestamp, msg.UUID)
+		return time.UnixMilli(sent).UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("%w: invalid timestamp %q and no SentTimestamp", ErrInvalidMessage, msg.Timestamp)
+}
+
+// route dispatches a Lambda invocation. The same binary serves the
+// WebhookQueue subscription (SQS events), the DLQ admin routes (API Gateway)
+// and the rebuild job (direct invocation with {"action": "rebuild"}).
+func route(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var probe struct {
+		RouteKey string `json:"routeKey"`
+		Action   string `json:"action"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, err
+	}
+
+	if probe.Action == "rebuild" {
+		var request RebuildRequest
+		if err := json.Unmarshal(raw, &request); err != nil {
+			return nil, err
+		}
+		return consumer.Rebuild(ctx, request.Mode)
+	}
+
+	if probe.RouteKey != "" {
+		var request events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(raw, &request); err != nil {
+			return nil, err
+		}
+		return consumer.adminHandler(ctx, request)
+	}
+
+	var sqsEvent events.SQSEvent
+	if err := json.Unmarshal(raw, &sqsEvent); err != nil {
+		return nil, err
 	}
-	return t
+	return handler(ctx, sqsEvent)
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(route)
 }
@@ -3,137 +3,421 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/mundotalendo/functions/types"
 )
 
 // Mock S3 client for testing
 type mockS3Client struct {
-	payload string
-	err     error
+	payload  string
+	err      error
+	objects  []s3types.Object             // returned by ListObjectsV2
+	bodies   map[string]string            // per-key payloads, override payload
+	metadata map[string]map[string]string // per-key object metadata, returned by HeadObject
+
+	mu      sync.Mutex
+	fetched []string // keys downloaded with GetObject
 }
 
 func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
+	m.mu.Lock()
+	m.fetched = append(m.fetched, aws.ToString(params.Key))
+	m.mu.Unlock()
+	body := m.payload
+	if b, ok := m.bodies[aws.ToString(params.Key)]; ok {
+		body = b
+	}
 	return &s3.GetObjectOutput{
-		Body: io.NopCloser(strings.NewReader(m.payload)),
+		Body: io.NopCloser(strings.NewReader(body)),
 	}, nil
 }
 
+func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &s3.HeadObjectOutput{Metadata: m.metadata[aws.ToString(params.Key)]}, nil
+}
+
+func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return &s3.ListObjectsV2Output{Contents: m.objects}, nil
+}
+
 // Mock DynamoDB client for testing
 type mockDynamoDBClient struct {
 	putErr    error
 	queryErr  error
 	deleteErr error
 	items     []map[string]interface{}
+	puts      []*dynamodb.PutItemInput
+
+	queryItems  []map[string]ddbtypes.AttributeValue
+	transactErr error
+	transacts   []*dynamodb.TransactWriteItemsInput
+
+	conditionErr error // returned by conditional PutItem calls
+	scanItems    []map[string]ddbtypes.AttributeValue
+
+	partitions map[string][]map[string]ddbtypes.AttributeValue // Query results by :pk value, override queryItems
+	countries  map[string][]map[string]ddbtypes.AttributeValue // CountryIndex query results by :countryKey value
+	indexed    []string                                        // countryKey of every CountryIndex query
+	getItems   map[string]map[string]ddbtypes.AttributeValue   // GetItem results by PK
+	updates    []*dynamodb.UpdateItemInput
+	deletes    []*dynamodb.DeleteItemInput
+	bumps      int // data version marker updates, kept apart from updates
+
+	mu sync.Mutex // batches process users concurrently
 }
 
 func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.puts = append(m.puts, params)
+	if params.ConditionExpression != nil && m.conditionErr != nil {
+		return nil, m.conditionErr
+	}
 	return &dynamodb.PutItemOutput{}, m.putErr
 }
 
+// putsWithPrefix returns the PutItem inputs whose PK starts with prefix.
+func (m *mockDynamoDBClient) putsWithPrefix(prefix string) []*dynamodb.PutItemInput {
+	var matched []*dynamodb.PutItemInput
+	for _, p := range m.puts {
+		if pk, ok := p.Item["PK"].(*ddbtypes.AttributeValueMemberS); ok && strings.HasPrefix(pk.Value, prefix) {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+// transactPutsWithPrefix returns the items put in transactions whose PK starts with prefix.
+func (m *mockDynamoDBClient) transactPutsWithPrefix(prefix string) []map[string]ddbtypes.AttributeValue {
+	var matched []map[string]ddbtypes.AttributeValue
+	for _, tx := range m.transacts {
+		for _, action := range tx.TransactItems {
+			if action.Put == nil {
+				continue
+			}
+			if pk, ok := action.Put.Item["PK"].(*ddbtypes.AttributeValueMemberS); ok && strings.HasPrefix(pk.Value, prefix) {
+				matched = append(matched, action.Put.Item)
+			}
+		}
+	}
+	return matched
+}
+
+// newTestConsumer wires a Consumer with mock clients.
+func newTestConsumer(s3Client *mockS3Client, dynamoClient *mockDynamoDBClient) *Consumer {
+	store := NewLeituraStore(dynamoClient, "test-table")
+	state := NewUserStateStore(dynamoClient, "test-table")
+	aliases := NewAliasStore(dynamoClient, "test-table")
+	history := NewHistoryStore(dynamoClient, "test-table")
+	emitter := NewEventEmitter(&MemoryPublisher{}, NewCommunityStore(dynamoClient, "test-table", store))
+	activities := NewActivityStore(dynamoClient, "test-table")
+	return &Consumer{
+		fetcher:   NewPayloadFetcher(s3Client, "test-bucket"),
+		store:     store,
+		processor: NewDesafioProcessor(store, state, aliases, history, emitter, activities),
+		status:    NewStatusStore(dynamoClient, "test-table"),
+		state:     state,
+		failures:  NewFailureStore(dynamoClient, "test-table"),
+		aliases:   aliases,
+		unmapped:  NewUnmappedStore(dynamoClient, "test-table"),
+		apiKeys:   dynamoClient,
+	}
+}
+
 func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
-	return &dynamodb.QueryOutput{}, m.queryErr
+	if key, ok := params.ExpressionAttributeValues[":countryKey"].(*ddbtypes.AttributeValueMemberS); ok {
+		m.mu.Lock()
+		m.indexed = append(m.indexed, key.Value)
+		m.mu.Unlock()
+		return &dynamodb.QueryOutput{Items: m.countries[key.Value]}, m.queryErr
+	}
+	if pk, ok := params.ExpressionAttributeValues[":pk"].(*ddbtypes.AttributeValueMemberS); ok {
+		if items, found := m.partitions[pk.Value]; found {
+			return &dynamodb.QueryOutput{Items: items}, m.queryErr
+		}
+	}
+	return &dynamodb.QueryOutput{Items: m.queryItems}, m.queryErr
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	pk := params.Key["PK"].(*ddbtypes.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: m.getItems[pk]}, nil
+}
+
+func (m *mockDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if pk, ok := params.Key["PK"].(*ddbtypes.AttributeValueMemberS); ok {
+		if versionPK, _ := types.DataVersionKey(); pk.Value == versionPK {
+			m.bumps++
+			return &dynamodb.UpdateItemOutput{}, nil
+		}
+	}
+	m.updates = append(m.updates, params)
+	return &dynamodb.UpdateItemOutput{}, m.putErr
 }
 
 func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletes = append(m.deletes, params)
 	return &dynamodb.DeleteItemOutput{}, m.deleteErr
 }
 
-func TestExtractDesafioData(t *testing.T) {
+func (m *mockDynamoDBClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transacts = append(m.transacts, params)
+	return &dynamodb.TransactWriteItemsOutput{}, m.transactErr
+}
+
+func (m *mockDynamoDBClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{Items: m.scanItems}, nil
+}
+
+// readingKeyItem builds a UserIndex query result item for an EVENT#LEITURA key.
+func readingKeyItem(sk string) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"PK": &ddbtypes.AttributeValueMemberS{Value: "EVENT#LEITURA"},
+		"SK": &ddbtypes.AttributeValueMemberS{Value: sk},
+	}
+}
+
+func TestExtractBooks(t *testing.T) {
 	tests := []struct {
 		name         string
 		desafio      types.Desafio
-		wantProgress int
-		wantTitle    string
-		wantCapa     string
+		wantKeys     []string
+		wantProgress []int
 	}{
 		{
-			name: "single vinculado with progress",
+			name: "single vinculado with book data",
 			desafio: types.Desafio{
 				Vinculados: []types.Vinculado{
 					{
+						ID:        "v1",
 						Progresso: 50,
 						Edicao: &types.Edicao{
 							Titulo: "Test Book",
+							Autor:  "Test Author",
 							Capa:   "http://example.com/capa.jpg",
 						},
 					},
 				},
 			},
-			wantProgress: 50,
-			wantTitle:    "Test Book",
-			wantCapa:     "http://example.com/capa.jpg",
+			wantKeys:     []string{"v1"},
+			wantProgress: []int{50},
 		},
 		{
-			name: "multiple vinculados - max progress",
+			name: "multiple vinculados - one reading each",
 			desafio: types.Desafio{
 				Vinculados: []types.Vinculado{
-					{Progresso: 25},
-					{Progresso: 75},
-					{Progresso: 50},
+					{ID: "v1", Progresso: 25},
+					{ID: "v2", Progresso: 75},
+					{ID: "v3", Progresso: 50},
 				},
 			},
-			wantProgress: 75,
+			wantKeys:     []string{"v1", "v2", "v3"},
+			wantProgress: []int{25, 75, 50},
 		},
 		{
-			name: "concluido forces 100%",
+			name: "missing or repeated ID falls back to position",
 			desafio: types.Desafio{
-				Concluido: true,
 				Vinculados: []types.Vinculado{
-					{Progresso: 50},
+					{ID: "v1", Progresso: 10},
+					{ID: "v1", Progresso: 20},
+					{Progresso: 30},
 				},
 			},
-			wantProgress: 100,
+			wantKeys:     []string{"v1", "1", "2"},
+			wantProgress: []int{10, 20, 30},
 		},
 		{
-			name:         "empty vinculados",
-			desafio:      types.Desafio{},
-			wantProgress: 0,
+			name: "fallback key never collides with a real ID",
+			desafio: types.Desafio{
+				Vinculados: []types.Vinculado{
+					{ID: "1", Progresso: 10},
+					{Progresso: 20},
+					{ID: "1", Progresso: 30},
+					{ID: "1-1", Progresso: 40},
+				},
+			},
+			wantKeys:     []string{"1", "1-1", "2", "3"},
+			wantProgress: []int{10, 20, 30, 40},
 		},
 		{
-			name: "progress over 100 clamped",
+			name: "completo forces 100% for that book only",
 			desafio: types.Desafio{
 				Vinculados: []types.Vinculado{
-					{Progresso: 150},
+					{ID: "v1", Completo: true, Progresso: 90},
+					{ID: "v2", Progresso: 40},
 				},
 			},
-			wantProgress: 100,
+			wantKeys:     []string{"v1", "v2"},
+			wantProgress: []int{100, 40},
 		},
 		{
-			name: "negative progress clamped",
+			name: "concluido forces 100%",
 			desafio: types.Desafio{
+				Concluido: true,
 				Vinculados: []types.Vinculado{
-					{Progresso: -10},
+					{ID: "v1", Progresso: 50},
 				},
 			},
-			wantProgress: 0,
+			wantKeys:     []string{"v1"},
+			wantProgress: []int{100},
+		},
+		{
+			name:         "empty vinculados",
+			desafio:      types.Desafio{},
+			wantKeys:     []string{""},
+			wantProgress: []int{0},
+		},
+		{
+			name: "progress clamped",
+			desafio: types.Desafio{
+				Vinculados: []types.Vinculado{
+					{ID: "v1", Progresso: 150},
+					{ID: "v2", Progresso: -10},
+				},
+			},
+			wantKeys:     []string{"v1", "v2"},
+			wantProgress: []int{100, 0},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			progress, _, title, capa := extractDesafioData(tt.desafio)
+			books := extractBooks(tt.desafio, time.Time{})
 
-			if progress != tt.wantProgress {
-				t.Errorf("progress = %d, want %d", progress, tt.wantProgress)
-			}
-			if tt.wantTitle != "" && title != tt.wantTitle {
-				t.Errorf("title = %q, want %q", title, tt.wantTitle)
+			if len(books) != len(tt.wantKeys) {
+				t.Fatalf("got %d books, want %d", len(books), len(tt.wantKeys))
 			}
-			if tt.wantCapa != "" && capa != tt.wantCapa {
-				t.Errorf("capa = %q, want %q", capa, tt.wantCapa)
+			for i, book := range books {
+				if book.Key != tt.wantKeys[i] {
+					t.Errorf("book %d key = %q, want %q", i, book.Key, tt.wantKeys[i])
+				}
+				if book.Progress != tt.wantProgress[i] {
+					t.Errorf("book %d progress = %d, want %d", i, book.Progress, tt.wantProgress[i])
+				}
 			}
 		})
 	}
+
+	books := extractBooks(tests[0].desafio, time.Time{})
+	if books[0].Title != "Test Book" || books[0].Author != "Test Author" || books[0].CapaURL != "http://example.com/capa.jpg" {
+		t.Errorf("unexpected book data: %+v", books[0])
+	}
+}
+
+func TestProcessAll_StableKeys(t *testing.T) {
+	payload := &types.WebhookPayload{
+		Desafios: []types.Desafio{
+			{ID: "d1", Descricao: "Brasil", Tipo: "leitura", Vinculados: []types.Vinculado{{ID: "v1", Progresso: 10}}},
+			{ID: "d2", Descricao: "Japão", Tipo: "leitura"},
+			{ID: "d2", Descricao: "Chile", Tipo: "leitura"}, // repeated ID
+			{Descricao: "Peru", Tipo: "leitura"},            // missing ID
+		},
+	}
+	dynamoClient := &mockDynamoDBClient{}
+	processor := NewDesafioProcessor(NewLeituraStore(dynamoClient, "test-table"), nil, nil, nil, nil, nil)
+
+	for _, webhookUUID := range []string{"uuid-1", "uuid-2"} {
+		processor.ProcessAll(context.Background(), payload, ProcessingMeta{UUID: webhookUUID, User: "Ana"})
+	}
+
+	want := []string{"Ana#d1#v1", "Ana#d2", "Ana#CHL#2", "Ana#PER#3"}
+	for _, tx := range dynamoClient.transacts {
+		if len(tx.TransactItems) != len(want) {
+			t.Fatalf("expected %d readings, got %d", len(want), len(tx.TransactItems))
+		}
+		for i, sk := range want {
+			if got := tx.TransactItems[i].Put.Item["SK"].(*ddbtypes.AttributeValueMemberS).Value; got != sk {
+				t.Errorf("reading %d: expected SK %s, got %s", i, sk, got)
+			}
+		}
+	}
+}
+
+func TestProcessAll_OneReadingPerVinculado(t *testing.T) {
+	payload := &types.WebhookPayload{
+		Desafios: []types.Desafio{{
+			Descricao: "Japão",
+			Tipo:      "leitura",
+			Vinculados: []types.Vinculado{
+				{ID: "v1", Progresso: 100, UpdatedAt: "2026-01-10", Edicao: &types.Edicao{Titulo: "Kafka à Beira-Mar", Autor: "Haruki Murakami"}},
+				{ID: "v2", Progresso: 30, UpdatedAt: "2026-01-12", Avaliacao: 4, Comentario: " Lindo ", DiaMarcado: "12", Edicao: &types.Edicao{Titulo: "Kokoro", Autor: "Natsume Soseki"}},
+			},
+		}},
+	}
+	dynamoClient := &mockDynamoDBClient{}
+	processor := NewDesafioProcessor(NewLeituraStore(dynamoClient, "test-table"), nil, nil, nil, nil, nil)
+
+	processed, _, _ := processor.ProcessAll(context.Background(), payload, ProcessingMeta{UUID: "test-uuid", User: "Test User"})
+
+	if processed != 1 {
+		t.Errorf("expected 1 processed desafio, got %d", processed)
+	}
+	puts := dynamoClient.transacts[0].TransactItems
+	if len(puts) != 2 {
+		t.Fatalf("expected 2 readings, got %d", len(puts))
+	}
+
+	var second types.LeituraItem
+	attributevalue.UnmarshalMap(puts[1].Put.Item, &second)
+	if second.SK != "Test User#JPN#0#v2" || second.Livro != "Kokoro" || second.Autor != "Natsume Soseki" || second.Progresso != 30 {
+		t.Errorf("unexpected reading: %+v", second)
+	}
+	if second.Avaliacao != 4 || second.Comentario != "Lindo" || second.DiaMarcado != "12" {
+		t.Errorf("expected rating, trimmed comment and marked day, got %+v", second)
+	}
+}
+
+func TestProcessAll_FlagsMonthMismatch(t *testing.T) {
+	payload := &types.WebhookPayload{
+		Desafios: []types.Desafio{
+			{ID: "d1", Descricao: "Chile", Categoria: "🌎Janeiro", Tipo: "leitura"},
+			{ID: "d2", Descricao: "Japão", Categoria: "🌈Novembro", Tipo: "leitura"}, // Japan is read in Fevereiro
+			{ID: "d3", Descricao: "Peru", Categoria: "Bônus", Tipo: "leitura"},      // not a month
+		},
+	}
+	dynamoClient := &mockDynamoDBClient{}
+	processor := NewDesafioProcessor(NewLeituraStore(dynamoClient, "test-table"), nil, nil, nil, nil, nil)
+
+	processor.ProcessAll(context.Background(), payload, ProcessingMeta{UUID: "test-uuid", User: "Ana"})
+
+	want := []struct {
+		month    int
+		mismatch bool
+	}{{1, false}, {11, true}, {0, false}}
+	puts := dynamoClient.transacts[0].TransactItems
+	for i, w := range want {
+		var item types.LeituraItem
+		attributevalue.UnmarshalMap(puts[i].Put.Item, &item)
+		if item.Mes != w.month || item.MesDivergente != w.mismatch {
+			t.Errorf("%s: expected month %d (mismatch %v), got %d (mismatch %v)", item.ISO3, w.month, w.mismatch, item.Mes, item.MesDivergente)
+		}
+	}
 }
 
 func TestClampProgress(t *testing.T) {
@@ -343,44 +627,749 @@ func TestProcessingResult(t *testing.T) {
 	}
 }
 
-func TestParseTimestamp(t *testing.T) {
+func TestMessageTimestamp(t *testing.T) {
+	sent := events.SQSMessage{Attributes: map[string]string{"SentTimestamp": "1768384800000"}}
+
 	tests := []struct {
-		name  string
-		input string
-		valid bool
+		name    string
+		input   string
+		record  events.SQSMessage
+		want    time.Time
+		wantErr bool
 	}{
 		{
 			name:  "valid RFC3339",
 			input: "2026-01-14T10:00:00Z",
-			valid: true,
+			want:  time.Date(2026, 1, 14, 10, 0, 0, 0, time.UTC),
 		},
 		{
-			name:  "invalid format",
-			input: "not-a-timestamp",
-			valid: false,
+			name:   "invalid format falls back to SentTimestamp",
+			input:  "not-a-timestamp",
+			record: sent,
+			want:   time.Date(2026, 1, 14, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "invalid format without SentTimestamp",
+			input:   "not-a-timestamp",
+			wantErr: true,
 		},
 		{
-			name:  "empty string",
-			input: "",
-			valid: false,
+			name:    "empty string",
+			input:   "",
+			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := parseTimestamp(tt.input)
+			result, err := messageTimestamp(types.SQSMessage{Timestamp: tt.input}, tt.record)
 
-			if tt.valid {
-				// Should parse to the expected time
-				if result.IsZero() {
-					t.Error("expected valid time, got zero")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMessage) {
+					t.Errorf("expected ErrInvalidMessage, got %v", err)
 				}
-			} else {
-				// Should return current time (not zero, but recent)
-				if result.IsZero() {
-					t.Error("expected fallback to current time, got zero")
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.Equal(tt.want) {
+				t.Errorf("got %s, want %s", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessRecord_UndatedMessageFails(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	c := newTestConsumer(&mockS3Client{payload: `{"perfil": {"nome": "Test User"}, "desafios": []}`}, dynamoClient)
+
+	body := `{"uuid":"test-uuid","user":"Test User","timestamp":"yesterday"}`
+	err := c.processRecord(context.Background(), events.SQSMessage{Body: body})
+	if !errors.Is(err, ErrInvalidMessage) || IsRetryable(err) {
+		t.Fatalf("expected a permanent ErrInvalidMessage, got %v", err)
+	}
+	if n := len(dynamoClient.putsWithPrefix("ERROR#" + types.ErrorTypeInvalidMessage)); n != 1 {
+		t.Errorf("expected 1 INVALID_MESSAGE record, got %d", n)
+	}
+	if n := len(dynamoClient.putsWithPrefix("USERSTATE#")); n != 0 {
+		t.Errorf("expected the user state not to be claimed, got %d writes", n)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{ErrInvalidMessage, "INVALID_MESSAGE"},
+		{ErrPayloadNotFound, "PAYLOAD_NOT_FOUND"},
+		{ErrDynamoDBRead, "DYNAMODB_READ_ERROR"},
+		{ErrSuperseded, "SUPERSEDED"},
+		{ErrS3Fetch, "S3_FETCH_ERROR"},
+		{ErrInvalidPayload, "INVALID_PAYLOAD"},
+		{WrapError("process", "uuid", "Xyz", ErrCountryNotFound), "COUNTRY_NOT_FOUND"},
+		{ErrDynamoDBWrite, "DYNAMODB_WRITE_ERROR"},
+		{errors.New("boom"), "UNKNOWN_ERROR"},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorCode(tt.err); got != tt.want {
+			t.Errorf("ErrorCode(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeResults(t *testing.T) {
+	tests := []struct {
+		name       string
+		results    []ProcessingResult
+		wantStatus string
+	}{
+		{
+			name: "all processed",
+			results: []ProcessingResult{
+				{ISO3: "BRA", Country: "Brasil", Processed: true},
+				{Country: "Caminhada"}, // skipped
+			},
+			wantStatus: types.StatusProcessed,
+		},
+		{
+			name: "partial",
+			results: []ProcessingResult{
+				{ISO3: "BRA", Country: "Brasil", Processed: true},
+				{Country: "Atlântida", Error: ErrCountryNotFound},
+			},
+			wantStatus: types.StatusPartial,
+		},
+		{
+			name: "all failed",
+			results: []ProcessingResult{
+				{Country: "Atlântida", Error: ErrCountryNotFound},
+			},
+			wantStatus: types.StatusFailed,
+		},
+		{
+			name:       "no desafios",
+			results:    nil,
+			wantStatus: types.StatusProcessed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, outcomes := summarizeResults(tt.results)
+			if status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", status, tt.wantStatus)
+			}
+			if len(outcomes) != len(tt.results) {
+				t.Fatalf("outcomes = %d, want %d", len(outcomes), len(tt.results))
+			}
+			for i, r := range tt.results {
+				if r.Error != nil && outcomes[i].ErrorCode != ErrorCode(r.Error) {
+					t.Errorf("outcome %d errorCode = %q, want %q", i, outcomes[i].ErrorCode, ErrorCode(r.Error))
 				}
 			}
 		})
 	}
 }
+
+func TestFailureStatus(t *testing.T) {
+	msg := types.SQSMessage{UUID: "test-uuid", User: "Test User", Timestamp: "2026-01-14T10:00:00Z"}
+
+	firstDelivery := events.SQSMessage{Attributes: map[string]string{"ApproximateReceiveCount": "1"}}
+	lastDelivery := events.SQSMessage{Attributes: map[string]string{"ApproximateReceiveCount": strconv.Itoa(MaxReceiveCount)}}
+
+	permanent := failureStatus(msg, ErrPayloadNotFound, firstDelivery)
+	if permanent.Status != types.StatusFailed {
+		t.Errorf("permanent error status = %q, want %q", permanent.Status, types.StatusFailed)
+	}
+	if permanent.ErrorCode != "PAYLOAD_NOT_FOUND" {
+		t.Errorf("errorCode = %q, want PAYLOAD_NOT_FOUND", permanent.ErrorCode)
+	}
+	if permanent.PK != "WEBHOOK#STATUS#test-uuid" || permanent.SK != "STATUS" {
+		t.Errorf("unexpected key %s/%s", permanent.PK, permanent.SK)
+	}
+
+	transient := failureStatus(msg, ErrS3Fetch, firstDelivery)
+	if transient.Status != types.StatusRetrying || transient.Attempts != 1 {
+		t.Errorf("retryable error status = %q (attempts %d), want %q (1)", transient.Status, transient.Attempts, types.StatusRetrying)
+	}
+
+	// The last delivery goes to the DLQ, a redrive is never retried by SQS
+	if last := failureStatus(msg, ErrS3Fetch, lastDelivery); last.Status != types.StatusFailed || last.Attempts != MaxReceiveCount {
+		t.Errorf("last delivery status = %q (attempts %d), want %q (%d)", last.Status, last.Attempts, types.StatusFailed, MaxReceiveCount)
+	}
+	if redrive := failureStatus(msg, ErrS3Fetch, events.SQSMessage{}); redrive.Status != types.StatusFailed {
+		t.Errorf("redrive status = %q, want %q", redrive.Status, types.StatusFailed)
+	}
+}
+
+func TestSaveStatus_InFlightNeverReplacesFinalStatus(t *testing.T) {
+	msg := types.SQSMessage{UUID: "test-uuid", User: "Test User", Timestamp: "2026-01-14T10:00:00Z"}
+	dynamoClient := &mockDynamoDBClient{conditionErr: &ddbtypes.ConditionalCheckFailedException{}}
+	store := NewStatusStore(dynamoClient, "test-table")
+
+	if err := store.SaveStatus(context.Background(), newStatusItem(msg, types.StatusProcessed)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dynamoClient.puts[0].ConditionExpression != nil {
+		t.Error("expected final statuses to be written unconditionally")
+	}
+
+	// A late redelivery finds the final status and leaves it
+	if err := store.SaveStatus(context.Background(), newStatusItem(msg, types.StatusProcessing)); err != nil {
+		t.Fatalf("expected the skipped write not to be an error, got %v", err)
+	}
+	if dynamoClient.puts[1].ConditionExpression == nil {
+		t.Error("expected PROCESSING to be written conditionally")
+	}
+}
+
+func TestProcessRecord_SavesStatusTransitions(t *testing.T) {
+	payload := `{
+		"perfil": {"nome": "Test User"},
+		"maratona": {"identificador": "mundotalendo-2026"},
+		"desafios": [
+			{"descricao": "Brasil", "categoria": "Janeiro", "tipo": "leitura", "vinculados": [{"progresso": 40}]},
+			{"descricao": "Atlântida", "categoria": "Janeiro", "tipo": "leitura"}
+		]
+	}`
+
+	dynamoClient := &mockDynamoDBClient{}
+	c := newTestConsumer(&mockS3Client{payload: payload}, dynamoClient)
+
+	record := events.SQSMessage{
+		MessageId: "msg-1",
+		Body:      `{"uuid":"test-uuid","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`,
+	}
+
+	if err := c.processRecord(context.Background(), record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	statuses := dynamoClient.putsWithPrefix("WEBHOOK#STATUS#")
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 status writes, got %d", len(statuses))
+	}
+
+	var first, last types.WebhookStatusItem
+	attributevalue.UnmarshalMap(statuses[0].Item, &first)
+	attributevalue.UnmarshalMap(statuses[1].Item, &last)
+
+	if first.Status != types.StatusProcessing {
+		t.Errorf("first status = %q, want PROCESSING", first.Status)
+	}
+	if last.Status != types.StatusPartial {
+		t.Errorf("final status = %q, want PARTIAL", last.Status)
+	}
+	if last.Processed != 1 || last.Failed != 1 {
+		t.Errorf("processed/failed = %d/%d, want 1/1", last.Processed, last.Failed)
+	}
+	if len(last.Desafios) != 2 || last.Desafios[1].ErrorCode != "COUNTRY_NOT_FOUND" {
+		t.Errorf("unexpected desafio outcomes: %+v", last.Desafios)
+	}
+}
+
+func TestReplaceUserReadings_SingleTransaction(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		queryItems: []map[string]ddbtypes.AttributeValue{
+			readingKeyItem("old-uuid#BRA#0"),
+			readingKeyItem("new-uuid#ARG#1"),
+		},
+	}
+	store := NewLeituraStore(dynamoClient, "test-table")
+
+	items := []types.LeituraItem{
+		{PK: "EVENT#LEITURA", SK: "new-uuid#BRA#0", ISO3: "BRA", User: "Test User"},
+		{PK: "EVENT#LEITURA", SK: "new-uuid#ARG#1", ISO3: "ARG", User: "Test User"},
+	}
+
+	if err := store.ReplaceUserReadings(context.Background(), "Test User", items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(dynamoClient.transacts) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(dynamoClient.transacts))
+	}
+
+	puts, deletes := 0, 0
+	for _, action := range dynamoClient.transacts[0].TransactItems {
+		switch {
+		case action.Put != nil:
+			puts++
+		case action.Delete != nil:
+			deletes++
+			if sk := action.Delete.Key["SK"].(*ddbtypes.AttributeValueMemberS).Value; sk != "old-uuid#BRA#0" {
+				t.Errorf("unexpected delete of %s", sk)
+			}
+		}
+	}
+
+	// The overwritten key must not be deleted in the same transaction
+	if puts != 2 || deletes != 1 {
+		t.Errorf("puts/deletes = %d/%d, want 2/1", puts, deletes)
+	}
+
+	if len(dynamoClient.puts) != 0 {
+		t.Errorf("expected no individual PutItem calls, got %d", len(dynamoClient.puts))
+	}
+}
+
+func TestReplaceUserReadings_RejectsLiveChangeAboveLimit(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	for i := 0; i < 80; i++ {
+		dynamoClient.queryItems = append(dynamoClient.queryItems, readingKeyItem(fmt.Sprintf("old-uuid#BRA#%d", i)))
+	}
+	store := NewLeituraStore(dynamoClient, "test-table")
+
+	items := make([]types.LeituraItem, 0, 80)
+	for i := 0; i < 80; i++ {
+		items = append(items, types.LeituraItem{PK: "EVENT#LEITURA", SK: fmt.Sprintf("new-uuid#BRA#%d", i)})
+	}
+
+	err := store.ReplaceUserReadings(context.Background(), "Test User", items)
+	if !errors.Is(err, ErrTooManyChanges) {
+		t.Fatalf("expected ErrTooManyChanges, got %v", err)
+	}
+	if IsRetryable(err) {
+		t.Error("expected a change too large for one transaction not to be retried")
+	}
+	if len(dynamoClient.transacts) != 0 || dynamoClient.bumps != 0 {
+		t.Errorf("expected nothing written, got %d transactions and %d bumps", len(dynamoClient.transacts), dynamoClient.bumps)
+	}
+}
+
+func TestReplaceUserReadings_ShadowWritesBeforeDeletingAboveLimit(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	for i := 0; i < 80; i++ {
+		dynamoClient.queryItems = append(dynamoClient.queryItems, readingKeyItem(fmt.Sprintf("old-uuid#BRA#%d", i)))
+	}
+	store := NewLeituraStore(dynamoClient, "test-table").WithPartition(ShadowPartition)
+
+	items := make([]types.LeituraItem, 0, 80)
+	for i := 0; i < 80; i++ {
+		items = append(items, types.LeituraItem{PK: "EVENT#LEITURA", SK: fmt.Sprintf("new-uuid#BRA#%d", i)})
+	}
+
+	if err := store.ReplaceUserReadings(context.Background(), "Test User", items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sawDelete := false
+	total := 0
+	for _, tx := range dynamoClient.transacts {
+		if len(tx.TransactItems) > MaxTransactItems {
+			t.Errorf("transaction with %d actions exceeds limit", len(tx.TransactItems))
+		}
+		for _, action := range tx.TransactItems {
+			total++
+			if action.Delete != nil {
+				sawDelete = true
+			} else if sawDelete {
+				t.Fatal("put issued after a delete; new readings must be written first")
+			}
+		}
+	}
+
+	if total != 160 {
+		t.Errorf("expected 160 actions, got %d", total)
+	}
+}
+
+func TestReplaceUserReadings_SkipsUnchangedReadings(t *testing.T) {
+	// A user with 150 books: a webhook that changes two of them must still be
+	// a single all-or-nothing transaction
+	stored := make([]types.LeituraItem, 0, 150)
+	dynamoClient := &mockDynamoDBClient{}
+	for i := 0; i < 150; i++ {
+		item := types.LeituraItem{
+			PK: "EVENT#LEITURA", SK: fmt.Sprintf("Test User#d%d", i), ISO3: "BRA", CountryKey: "BRA",
+			User: "Test User", Progresso: 10, WebhookUUID: "uuid-1",
+		}
+		stored = append(stored, item)
+		av, _ := attributevalue.MarshalMap(item)
+		dynamoClient.queryItems = append(dynamoClient.queryItems, av)
+	}
+	store := NewLeituraStore(dynamoClient, "test-table")
+
+	items := make([]types.LeituraItem, 0, len(stored))
+	for _, item := range stored {
+		item.WebhookUUID = "uuid-2"
+		items = append(items, item)
+	}
+	items[3].Progresso = 50
+	items = items[:len(items)-1] // d149 removed
+
+	if err := store.ReplaceUserReadings(context.Background(), "Test User", items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(dynamoClient.transacts) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(dynamoClient.transacts))
+	}
+	actions := dynamoClient.transacts[0].TransactItems
+	if len(actions) != 2 || actions[0].Put == nil || actions[1].Delete == nil {
+		t.Fatalf("expected 1 put and 1 delete, got %+v", actions)
+	}
+	if sk := actions[0].Put.Item["SK"].(*ddbtypes.AttributeValueMemberS).Value; sk != "Test User#d3" {
+		t.Errorf("expected only the changed reading to be written, got %s", sk)
+	}
+	if sk := actions[1].Delete.Key["SK"].(*ddbtypes.AttributeValueMemberS).Value; sk != "Test User#d149" {
+		t.Errorf("expected the removed reading to be deleted, got %s", sk)
+	}
+}
+
+func TestReplaceUserReadings_BumpsDataVersion(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	items := []types.LeituraItem{{SK: "Test User#d1#v1", ISO3: "BRA", User: "Test User"}}
+
+	live := NewLeituraStore(dynamoClient, "test-table")
+	if err := live.ReplaceUserReadings(context.Background(), "Test User", items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dynamoClient.bumps != 1 {
+		t.Errorf("expected a live write to bump the data version once, got %d", dynamoClient.bumps)
+	}
+
+	shadow := live.WithPartition(ShadowPartition)
+	if err := shadow.ReplaceUserReadings(context.Background(), "Test User", items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dynamoClient.bumps != 1 {
+		t.Errorf("expected no bump for the shadow partition, got %d", dynamoClient.bumps)
+	}
+
+	dynamoClient.transactErr = errors.New("TransactionCanceledException")
+	if err := live.ReplaceUserReadings(context.Background(), "Test User", items); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	if dynamoClient.bumps != 1 {
+		t.Errorf("expected no bump for a failed write, got %d", dynamoClient.bumps)
+	}
+}
+
+func TestReplaceUserReadings_UnchangedKeepsDataVersion(t *testing.T) {
+	item := types.LeituraItem{
+		PK: "EVENT#LEITURA", SK: "Test User#d1#v1", ISO3: "BRA", CountryKey: "BRA",
+		User: "Test User", Progresso: 40, WebhookUUID: "uuid-1",
+	}
+	av, _ := attributevalue.MarshalMap(item)
+	dynamoClient := &mockDynamoDBClient{queryItems: []map[string]ddbtypes.AttributeValue{av}}
+	store := NewLeituraStore(dynamoClient, "test-table")
+
+	item.WebhookUUID = "uuid-2"
+	if err := store.ReplaceUserReadings(context.Background(), "Test User", []types.LeituraItem{item}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dynamoClient.transacts) != 0 {
+		t.Errorf("expected no transaction for unchanged readings, got %d", len(dynamoClient.transacts))
+	}
+	if dynamoClient.bumps != 0 {
+		t.Errorf("expected no bump when nothing was written, got %d", dynamoClient.bumps)
+	}
+}
+
+func TestReplaceUserActivities_UnchangedKeepsDataVersion(t *testing.T) {
+	activity := types.AtividadeItem{
+		PK: types.ActivityPartition, SK: "Test User#d1", User: "Test User",
+		Descricao: "Maratona", Progresso: 40, WebhookUUID: "uuid-1",
+	}
+	av, _ := attributevalue.MarshalMap(activity)
+	dynamoClient := &mockDynamoDBClient{queryItems: []map[string]ddbtypes.AttributeValue{av}}
+	store := NewActivityStore(dynamoClient, "test-table")
+
+	activity.WebhookUUID = "uuid-2"
+	if err := store.ReplaceUserActivities(context.Background(), "Test User", []types.AtividadeItem{activity}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dynamoClient.transacts) != 0 || dynamoClient.bumps != 0 {
+		t.Errorf("expected no write and no bump, got %d transactions and %d bumps", len(dynamoClient.transacts), dynamoClient.bumps)
+	}
+
+	activity.Progresso = 60
+	if err := store.ReplaceUserActivities(context.Background(), "Test User", []types.AtividadeItem{activity}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dynamoClient.transacts) != 1 || dynamoClient.bumps != 1 {
+		t.Errorf("expected one write and one bump, got %d transactions and %d bumps", len(dynamoClient.transacts), dynamoClient.bumps)
+	}
+}
+
+func TestReplaceUserReadings_CountryKeyOnlyInLivePartition(t *testing.T) {
+	items := []types.LeituraItem{{SK: "Test User#d1#v1", ISO3: "BRA", User: "Test User"}}
+
+	for partition, want := range map[string]string{LivePartition: "BRA", ShadowPartition: ""} {
+		dynamoClient := &mockDynamoDBClient{}
+		store := NewLeituraStore(dynamoClient, "test-table").WithPartition(partition)
+		if err := store.ReplaceUserReadings(context.Background(), "Test User", items); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		put := dynamoClient.transacts[0].TransactItems[0].Put
+		got := ""
+		if key, ok := put.Item["countryKey"].(*ddbtypes.AttributeValueMemberS); ok {
+			got = key.Value
+		}
+		if got != want {
+			t.Errorf("%s: expected countryKey %q, got %q", partition, want, got)
+		}
+	}
+}
+
+func TestProcessAll_ReplaceFailureMarksResultsFailed(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{transactErr: errors.New("TransactionCanceledException")}
+	processor := NewDesafioProcessor(NewLeituraStore(dynamoClient, "test-table"), nil, nil, nil, nil, nil)
+
+	payload := &types.WebhookPayload{
+		Desafios: []types.Desafio{
+			{Descricao: "Brasil", Tipo: "leitura"},
+			{Descricao: "Atlântida", Tipo: "leitura"},
+		},
+	}
+
+	processed, errCount, results := processor.ProcessAll(context.Background(), payload, ProcessingMeta{UUID: "test-uuid", User: "Test User"})
+
+	if processed != 0 || errCount != 2 {
+		t.Fatalf("processed/errors = %d/%d, want 0/2", processed, errCount)
+	}
+	if !errors.Is(results[0].Error, ErrDynamoDBWrite) || !IsRetryable(results[0].Error) {
+		t.Errorf("expected retryable write error, got %v", results[0].Error)
+	}
+	if !errors.Is(results[1].Error, ErrCountryNotFound) {
+		t.Errorf("expected country not found error, got %v", results[1].Error)
+	}
+}
+
+func TestUserStateStore_Claim(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	store := NewUserStateStore(dynamoClient, "test-table")
+	ts := time.Date(2026, 1, 14, 10, 0, 0, 123456789, time.UTC)
+
+	if err := store.Claim(context.Background(), "Test User", "uuid-2", ts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims := dynamoClient.putsWithPrefix("USERSTATE#")
+	if len(claims) != 1 {
+		t.Fatalf("expected 1 state write, got %d", len(claims))
+	}
+
+	var item UserStateItem
+	attributevalue.UnmarshalMap(claims[0].Item, &item)
+	if item.PK != "USERSTATE#Test User" || item.LastUUID != "uuid-2" || item.LastApplied != ts.UnixNano() {
+		t.Errorf("unexpected state item: %+v", item)
+	}
+	if claims[0].ConditionExpression == nil {
+		t.Error("expected conditional write")
+	}
+
+	// A newer webhook already holds the claim
+	dynamoClient.conditionErr = &ddbtypes.ConditionalCheckFailedException{}
+	err := store.Claim(context.Background(), "Test User", "uuid-1", ts.Add(-time.Second))
+	if !errors.Is(err, ErrSuperseded) {
+		t.Errorf("expected ErrSuperseded, got %v", err)
+	}
+	if IsRetryable(err) {
+		t.Error("superseded messages must not be retried")
+	}
+}
+
+func TestProcessRecord_SkipsSupersededMessage(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{conditionErr: &ddbtypes.ConditionalCheckFailedException{}}
+	s3Client := &mockS3Client{err: errors.New("payload must not be fetched")}
+	c := newTestConsumer(s3Client, dynamoClient)
+
+	record := events.SQSMessage{
+		MessageId: "msg-1",
+		Body:      `{"uuid":"old-uuid","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`,
+	}
+
+	if err := c.processRecord(context.Background(), record); !errors.Is(err, ErrSuperseded) {
+		t.Fatalf("expected ErrSuperseded, got %v", err)
+	}
+
+	if len(dynamoClient.transacts) != 0 {
+		t.Errorf("expected no readings written, got %d transactions", len(dynamoClient.transacts))
+	}
+
+	statuses := dynamoClient.putsWithPrefix("WEBHOOK#STATUS#")
+	var last types.WebhookStatusItem
+	attributevalue.UnmarshalMap(statuses[len(statuses)-1].Item, &last)
+	if last.Status != types.StatusSuperseded {
+		t.Errorf("final status = %q, want SUPERSEDED", last.Status)
+	}
+}
+
+func TestProcessAll_GuardFailureSupersedes(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		transactErr: &ddbtypes.TransactionCanceledException{
+			CancellationReasons: []ddbtypes.CancellationReason{
+				{Code: aws.String("ConditionalCheckFailed")},
+				{Code: aws.String("None")},
+			},
+		},
+	}
+	state := NewUserStateStore(dynamoClient, "test-table")
+	processor := NewDesafioProcessor(NewLeituraStore(dynamoClient, "test-table"), state, nil, nil, nil, nil)
+
+	payload := &types.WebhookPayload{
+		Desafios: []types.Desafio{{Descricao: "Brasil", Tipo: "leitura"}},
+	}
+
+	_, _, results := processor.ProcessAll(context.Background(), payload, ProcessingMeta{UUID: "old-uuid", User: "Test User"})
+
+	if len(dynamoClient.transacts) != 1 || dynamoClient.transacts[0].TransactItems[0].ConditionCheck == nil {
+		t.Fatal("expected the user state guard as the first transaction item")
+	}
+	if !isSuperseded(results) {
+		t.Errorf("expected superseded results, got %+v", results)
+	}
+}
+
+func TestGroupByUser(t *testing.T) {
+	records := []events.SQSMessage{
+		{MessageId: "a-new", Body: `{"uuid":"1","user":"Ana","timestamp":"2026-01-14T10:00:02.5Z"}`},
+		{MessageId: "bia", Body: `{"uuid":"2","user":"Bia","timestamp":"2026-01-14T10:00:00Z"}`},
+		{MessageId: "broken", Body: `not json`},
+		{MessageId: "a-old", Body: `{"uuid":"3","user":"Ana","timestamp":"2026-01-14T10:00:02.1Z"}`},
+	}
+
+	groups := groupByUser(records)
+
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+	}
+
+	ana := groups[0]
+	if len(ana) != 2 || ana[0].MessageId != "a-old" || ana[1].MessageId != "a-new" {
+		t.Errorf("expected Ana's records oldest first, got %v", ana)
+	}
+
+	if groups[1][0].MessageId != "bia" {
+		t.Errorf("expected Bia's group second, got %v", groups[1])
+	}
+
+	if groups[2][0].MessageId != "broken" {
+		t.Errorf("expected unparseable record in its own group, got %v", groups[2])
+	}
+}
+
+func TestProcessBatch_ReportsOnlyRetryableFailures(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{}
+	s3Client := &mockS3Client{err: errors.New("S3 timeout")}
+	c := newTestConsumer(s3Client, dynamoClient)
+
+	var records []events.SQSMessage
+	for i := 0; i < 8; i++ {
+		records = append(records, events.SQSMessage{
+			MessageId: fmt.Sprintf("msg-%d", i),
+			Body:      fmt.Sprintf(`{"uuid":"uuid-%d","user":"User %d","timestamp":"2026-01-14T10:00:00Z"}`, i, i),
+		})
+	}
+	records = append(records, events.SQSMessage{MessageId: "broken", Body: `not json`})
+
+	failures := c.processBatch(context.Background(), records)
+
+	if len(failures) != 8 {
+		t.Fatalf("expected 8 retryable failures, got %d", len(failures))
+	}
+	for _, f := range failures {
+		if f.ItemIdentifier == "broken" {
+			t.Error("invalid messages must not be retried")
+		}
+	}
+}
+
+func TestNewFalhaItem(t *testing.T) {
+	msg := types.SQSMessage{UUID: "test-uuid", User: "Test User", Timestamp: "2026-01-14T10:00:00Z"}
+
+	item := newFalhaItem(msg, WrapError("process", "test-uuid", "Atlântida", ErrCountryNotFound), "Atlântida", "")
+
+	if item.PK != "ERROR#COUNTRY_NOT_FOUND" {
+		t.Errorf("PK = %q, want ERROR#COUNTRY_NOT_FOUND", item.PK)
+	}
+	if item.SK != "USER#Test User#Atlântida" {
+		t.Errorf("unexpected SK %q", item.SK)
+	}
+	if item.User != "Test User" || item.WebhookUUID != "test-uuid" || item.Pais != "Atlântida" {
+		t.Errorf("unexpected failure item: %+v", item)
+	}
+
+	// A resend failing the same way overwrites instead of duplicating
+	resend := types.SQSMessage{UUID: "other-uuid", User: "Test User", Timestamp: "2026-01-15T08:00:00Z"}
+	if again := newFalhaItem(resend, ErrCountryNotFound, "Atlântida", ""); again.SK != item.SK {
+		t.Errorf("expected stable SK, got %q and %q", item.SK, again.SK)
+	}
+
+	// Another country or user is a separate record
+	if other := newFalhaItem(msg, ErrCountryNotFound, "Lemúria", ""); other.SK == item.SK {
+		t.Error("expected a separate record per country")
+	}
+
+	// Unparseable messages are keyed by their body
+	a := newFalhaItem(types.SQSMessage{}, ErrInvalidMessage, "", "{bad")
+	b := newFalhaItem(types.SQSMessage{}, ErrInvalidMessage, "", "{worse")
+	if a.SK == b.SK {
+		t.Error("expected different bodies to be separate records")
+	}
+}
+
+func TestProcessRecord_RecordsFailures(t *testing.T) {
+	t.Run("unmapped country", func(t *testing.T) {
+		payload := `{
+			"perfil": {"nome": "Test User"},
+			"desafios": [
+				{"descricao": "Brasil", "tipo": "leitura"},
+				{"descricao": "Atlântida", "tipo": "leitura"}
+			]
+		}`
+		dynamoClient := &mockDynamoDBClient{}
+		c := newTestConsumer(&mockS3Client{payload: payload}, dynamoClient)
+
+		record := events.SQSMessage{Body: `{"uuid":"test-uuid","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`}
+		if err := c.processRecord(context.Background(), record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		failures := dynamoClient.putsWithPrefix("ERROR#COUNTRY_NOT_FOUND")
+		if len(failures) != 1 {
+			t.Fatalf("expected 1 COUNTRY_NOT_FOUND record, got %d", len(failures))
+		}
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		dynamoClient := &mockDynamoDBClient{}
+		c := newTestConsumer(&mockS3Client{payload: `{not json`}, dynamoClient)
+
+		body := `{"uuid":"test-uuid","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`
+		err := c.processRecord(context.Background(), events.SQSMessage{Body: body})
+		if IsRetryable(err) {
+			t.Fatalf("expected permanent error, got %v", err)
+		}
+
+		failures := dynamoClient.putsWithPrefix("ERROR#INVALID_PAYLOAD")
+		if len(failures) != 1 {
+			t.Fatalf("expected 1 INVALID_PAYLOAD record, got %d", len(failures))
+		}
+
+		var item types.FalhaItem
+		attributevalue.UnmarshalMap(failures[0].Item, &item)
+		if item.OriginalPayload != body {
+			t.Errorf("expected SQS body as original payload, got %q", item.OriginalPayload)
+		}
+	})
+
+	t.Run("transient S3 error", func(t *testing.T) {
+		dynamoClient := &mockDynamoDBClient{}
+		c := newTestConsumer(&mockS3Client{err: errors.New("timeout")}, dynamoClient)
+
+		record := events.SQSMessage{Body: `{"uuid":"test-uuid","user":"Test User","timestamp":"2026-01-14T10:00:00Z"}`}
+		c.processRecord(context.Background(), record)
+
+		if failures := dynamoClient.putsWithPrefix("ERROR#"); len(failures) != 0 {
+			t.Errorf("retryable errors must not be recorded, got %d records", len(failures))
+		}
+	})
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/calendar"
 	"github.com/mundotalendo/functions/mapping"
 	"github.com/mundotalendo/functions/types"
 	"github.com/mundotalendo/functions/utils"
@@ -19,10 +23,11 @@ var ValidDesafioTypes = map[string]bool{
 
 // ProcessingMeta contains metadata for processing a webhook.
 type ProcessingMeta struct {
-	UUID      string    // Webhook UUID
-	User      string    // User name
-	AvatarURL string    // User avatar URL
-	Timestamp time.Time // Processing timestamp
+	UUID       string    // Webhook UUID
+	User       string    // User name
+	AvatarURL  string    // User avatar URL
+	ProfileURL string    // User profile link (perfil.link)
+	Timestamp  time.Time // Processing timestamp
 }
 
 // ProcessingResult contains the result of processing a desafio.
@@ -31,153 +36,362 @@ type ProcessingResult struct {
 	Country   string // Country name
 	Processed bool   // Whether processing succeeded
 	Error     error  // Error if processing failed
+	Activity  bool   // Whether the desafio is an activity (atividade)
 }
 
 // DesafioProcessor handles the processing of reading challenges.
 type DesafioProcessor struct {
-	store *LeituraStore
+	store      *LeituraStore
+	state      *UserStateStore
+	aliases    *AliasStore
+	history    *HistoryStore
+	events     *EventEmitter
+	activities *ActivityStore
 }
 
-// NewDesafioProcessor creates a new processor with the given DynamoDB store.
-func NewDesafioProcessor(store *LeituraStore) *DesafioProcessor {
+// NewDesafioProcessor creates a new processor with the given DynamoDB stores.
+// When state is set, readings are only replaced while the webhook is still the
+// latest one claimed for the user. When aliases is set, country names are also
+// resolved through the aliases registered at runtime. When history is set,
+// every progress change is appended to the reading history. When events is
+// set, reading milestones are published once the readings are saved. When
+// activities is set, atividade desafios are saved to their own partition;
+// otherwise they are processed but not stored.
+func NewDesafioProcessor(store *LeituraStore, state *UserStateStore, aliases *AliasStore, history *HistoryStore, events *EventEmitter, activities *ActivityStore) *DesafioProcessor {
 	return &DesafioProcessor{
-		store: store,
+		store:      store,
+		state:      state,
+		aliases:    aliases,
+		history:    history,
+		events:     events,
+		activities: activities,
 	}
 }
 
-// ProcessAll processes all desafios in a payload and saves them to DynamoDB.
+// ProcessAll processes all desafios in a payload and replaces the user's
+// readings in DynamoDB with the result.
 // It returns the count of successfully processed items and errors.
 //
-// Note: This function continues processing even if individual desafios fail.
-// Only transient errors (DynamoDB throttling) should cause a retry.
+// Note: Individual desafios that cannot be mapped are reported as failed while
+// the rest are still saved. The replacement itself is all-or-nothing: if it
+// fails, every mapped desafio is reported with the write error (ErrSuperseded
+// when a newer webhook for the user won the race). Progress changes are
+// appended to the history in the replacement transaction (see historyPuts),
+// so a superseded webhook records none, and published as events after it. Activities are not readings: they are
+// replaced separately once the readings are saved (see replaceActivities).
 func (p *DesafioProcessor) ProcessAll(ctx context.Context, payload *types.WebhookPayload, meta ProcessingMeta) (int, int, []ProcessingResult) {
+	items, activities, results := p.build(ctx, payload, meta)
+
+	var guards []ddbtypes.TransactWriteItem
+	if p.state != nil {
+		guards = append(guards, p.state.Guard(meta.User, meta.UUID))
+	}
+
+	var history []ddbtypes.TransactWriteItem
+	previous, err := p.previousReadings(ctx, meta.User)
+	if err == nil {
+		history, err = p.historyPuts(previous, items, meta)
+	}
+	if err == nil {
+		err = p.store.ReplaceUserReadingsWith(ctx, meta.User, items, history, guards...)
+	}
+	if err != nil {
+		log.Printf("ERROR replacing readings for user %s: %v", meta.User, err)
+		for i := range results {
+			if results[i].Processed {
+				results[i].Processed = false
+				results[i].Error = err
+			}
+		}
+	} else {
+		if p.events != nil {
+			if err := p.events.Emit(ctx, previous, items, meta); err != nil {
+				log.Printf("WARN: Failed to publish reading events for user %s: %v", meta.User, err)
+			}
+		}
+		p.replaceActivities(ctx, activities, results, meta, guards)
+	}
+
 	processed := 0
 	errors := 0
+	for _, r := range results {
+		if r.Processed {
+			processed++
+			log.Printf("Processed: %s (%s) - User: %s", r.Country, r.ISO3, meta.User)
+		} else if r.Error != nil {
+			errors++
+		}
+	}
+
+	return processed, errors, results
+}
+
+// build converts every desafio in a payload into the readings and activities
+// to save, without writing anything. Desafios that cannot be mapped are
+// reported in the results and yield no reading.
+func (p *DesafioProcessor) build(ctx context.Context, payload *types.WebhookPayload, meta ProcessingMeta) ([]types.LeituraItem, []types.AtividadeItem, []ProcessingResult) {
 	results := make([]ProcessingResult, 0, len(payload.Desafios))
+	items := make([]types.LeituraItem, 0, len(payload.Desafios))
+	var activities []types.AtividadeItem
+	resolver := p.resolver(ctx)
 
+	ids := desafioIDs(payload.Desafios)
 	for i, desafio := range payload.Desafios {
-		result := p.processDesafio(ctx, desafio, i, payload, meta)
-		results = append(results, result)
+		if desafio.Tipo == DesafioTypeActivity {
+			activity, result := buildActivity(desafio, i, ids[i], meta, resolver)
+			activities = append(activities, activity)
+			results = append(results, result)
+			continue
+		}
 
+		desafioItems, result := p.buildDesafio(desafio, i, ids[i], meta, resolver)
 		if result.Processed {
-			processed++
-		} else if result.Error != nil {
-			errors++
+			items = append(items, desafioItems...)
 		}
+		results = append(results, result)
 	}
 
-	return processed, errors, results
+	return items, activities, results
+}
+
+// replaceActivities replaces the user's activities. If it fails, the activity
+// results are reported with the error, so the message is retried; the readings
+// already saved are rewritten identically by the retry.
+func (p *DesafioProcessor) replaceActivities(ctx context.Context, activities []types.AtividadeItem, results []ProcessingResult, meta ProcessingMeta, guards []ddbtypes.TransactWriteItem) {
+	if p.activities == nil {
+		return
+	}
+
+	err := p.activities.ReplaceUserActivities(ctx, meta.User, activities, guards...)
+	if err == nil {
+		return
+	}
+
+	log.Printf("ERROR replacing activities for user %s: %v", meta.User, err)
+	for i := range results {
+		if results[i].Activity && results[i].Processed {
+			results[i].Processed = false
+			results[i].Error = err
+		}
+	}
+}
+
+// previousReadings returns the user's readings before this webhook, which
+// history and events are computed against (nil when neither is configured).
+func (p *DesafioProcessor) previousReadings(ctx context.Context, user string) ([]types.LeituraItem, error) {
+	if p.history == nil && p.events == nil {
+		return nil, nil
+	}
+	return p.store.UserReadings(ctx, user)
+}
+
+// historyPuts returns the history records of the progress changes between the
+// user's previous readings and the new ones, as actions of the replacement
+// transaction: they are committed exactly when the readings are, so a failed
+// or superseded replacement leaves no record, and its retry finds the same
+// changes again.
+func (p *DesafioProcessor) historyPuts(previous, items []types.LeituraItem, meta ProcessingMeta) ([]ddbtypes.TransactWriteItem, error) {
+	if p.history == nil {
+		return nil, nil
+	}
+	return p.history.Puts(historyEntries(previous, items, meta))
+}
+
+// resolver returns the country resolver, with runtime aliases when configured.
+func (p *DesafioProcessor) resolver(ctx context.Context) *mapping.Resolver {
+	if p.aliases == nil {
+		return mapping.NewResolver(nil)
+	}
+	return p.aliases.Resolver(ctx)
+}
+
+// desafioIDs returns the ID identifying each desafio across webhooks, or an
+// empty string when the ID is missing or repeated in the payload.
+func desafioIDs(desafios []types.Desafio) []string {
+	ids := make([]string, len(desafios))
+	seen := make(map[string]bool, len(desafios))
+	for i, desafio := range desafios {
+		id := strings.TrimSpace(desafio.ID)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids[i] = id
+	}
+	return ids
 }
 
-// processDesafio handles a single desafio, extracting data and saving to DynamoDB.
-func (p *DesafioProcessor) processDesafio(ctx context.Context, desafio types.Desafio, index int, payload *types.WebhookPayload, meta ProcessingMeta) ProcessingResult {
+// readingSK returns the stable key of a reading, "<user>#<desafioID>[#<bookKey>]".
+// Desafios without a usable ID fall back to "<user>#<iso3>#<index>[#<bookKey>]".
+// Resending a desafio overwrites the same items instead of creating new ones.
+func readingSK(user, desafioID, iso3 string, index int, bookKey string) string {
+	sk := user + "#" + desafioID
+	if desafioID == "" {
+		sk = fmt.Sprintf("%s#%s#%d", user, iso3, index)
+	}
+	if bookKey != "" {
+		sk += "#" + bookKey
+	}
+	return sk
+}
+
+// buildDesafio converts a single desafio into LeituraItems, one per linked book
+// (Vinculado). A desafio without books yields a single item without book data.
+// The returned result is marked Processed when the items should be saved.
+func (p *DesafioProcessor) buildDesafio(desafio types.Desafio, index int, desafioID string, meta ProcessingMeta, resolver *mapping.Resolver) ([]types.LeituraItem, ProcessingResult) {
 	// Filter: only process valid types
 	if !ValidDesafioTypes[desafio.Tipo] {
-		return ProcessingResult{Processed: false}
+		return nil, ProcessingResult{
+			Country:   utils.CleanEmojis(desafio.Descricao),
+			Processed: false,
+		}
 	}
 
-	// Extract progress and book data
-	progress, latestUpdate, bookTitle, capaURL := extractDesafioData(desafio)
-
 	// Clean emojis from country name and category
 	cleanedCountry := utils.CleanEmojis(desafio.Descricao)
 	cleanedCategory := utils.CleanEmojis(desafio.Categoria)
 
-	// Map country to ISO3
-	iso3 := mapping.GetISO(cleanedCountry)
+	// Map country to ISO3 (built-in names first, then runtime aliases)
+	iso3 := resolver.GetISO(cleanedCountry)
 	if iso3 == "" {
 		log.Printf("Country not found: %s (original: %s)", cleanedCountry, desafio.Descricao)
-		return ProcessingResult{
+		return nil, ProcessingResult{
 			Country: cleanedCountry,
 			Error:   fmt.Errorf("%w: %s", ErrCountryNotFound, cleanedCountry),
 		}
 	}
 
-	// Create LeituraItem
-	item := types.LeituraItem{
-		PK:          "EVENT#LEITURA",
-		SK:          fmt.Sprintf("%s#%s#%d", meta.UUID, iso3, index),
-		ISO3:        iso3,
-		Pais:        cleanedCountry,
-		Categoria:   cleanedCategory,
-		Progresso:   progress,
-		User:        meta.User,
-		ImagemURL:   meta.AvatarURL,
-		CapaURL:     capaURL,
-		Livro:       bookTitle,
-		WebhookUUID: meta.UUID,
-		UpdatedAt:   latestUpdate.Format(time.RFC3339),
-	}
-
-	// Save to DynamoDB
-	if err := p.store.SaveLeitura(ctx, item); err != nil {
-		log.Printf("ERROR saving leitura for %s: %v", iso3, err)
-		return ProcessingResult{
-			ISO3:    iso3,
-			Country: cleanedCountry,
-			Error:   err,
-		}
+	// Check the declared month against the official calendar
+	month := calendar.ParseCategory(cleanedCategory)
+	mismatch := month != 0 && !calendar.BelongsTo(iso3, month)
+	if mismatch {
+		log.Printf("WARN: %s (%s) does not belong to category %s (user %s)", cleanedCountry, iso3, cleanedCategory, meta.User)
 	}
 
-	log.Printf("Processed: %s (%s) - User: %s - Category: %s - Progress: %d%%",
-		cleanedCountry, iso3, meta.User, cleanedCategory, progress)
+	// Create one LeituraItem per book
+	books := extractBooks(desafio, meta.Timestamp)
+	items := make([]types.LeituraItem, 0, len(books))
+	for _, book := range books {
+		items = append(items, types.LeituraItem{
+			PK:            "EVENT#LEITURA",
+			SK:            readingSK(meta.User, desafioID, iso3, index, book.Key),
+			ISO3:          iso3,
+			Pais:          cleanedCountry,
+			Categoria:     cleanedCategory,
+			Mes:           month,
+			MesDivergente: mismatch,
+			Progresso:     book.Progress,
+			User:          meta.User,
+			ImagemURL:     meta.AvatarURL,
+			PerfilURL:     meta.ProfileURL,
+			CapaURL:       book.CapaURL,
+			Livro:         book.Title,
+			Autor:         book.Author,
+			Avaliacao:     book.Rating,
+			Comentario:    book.Comment,
+			DiaMarcado:    book.MarkedDay,
+			VinculadoID:   book.VinculadoID,
+			WebhookUUID:   meta.UUID,
+			UpdatedAt:     book.UpdatedAt.Format(time.RFC3339),
+		})
+	}
 
-	return ProcessingResult{
+	return items, ProcessingResult{
 		ISO3:      iso3,
 		Country:   cleanedCountry,
 		Processed: true,
 	}
 }
 
-// extractDesafioData extracts progress, update timestamp, book title, and cover URL from a desafio.
-// It handles multiple vinculados by taking the maximum progress and latest update.
-func extractDesafioData(desafio types.Desafio) (progress int, latestUpdate time.Time, bookTitle, capaURL string) {
-	maxProgress := 0
-	latestUpdate = time.Time{}
+// bookReading holds the reading data of a single linked book.
+type bookReading struct {
+	Key         string // SK suffix: vinculado ID, or position when the ID is missing or repeated
+	VinculadoID string
+	Progress    int
+	UpdatedAt   time.Time
+	Title       string
+	Author      string
+	CapaURL     string
+	Rating      int    // Avaliacao, 0 when not rated
+	Comment     string // Comentario
+	MarkedDay   string // DiaMarcado
+}
 
-	for _, vinculado := range desafio.Vinculados {
-		// Track maximum progress
-		if vinculado.Progresso > maxProgress {
-			maxProgress = vinculado.Progresso
+// extractBooks extracts one bookReading per Vinculado of a desafio.
+// A completed book (Completo) or a completed desafio (Concluido) forces 100%.
+// A desafio without Vinculados yields a single entry with no book data and an
+// empty Key, so the country is still recorded; having no update date of its
+// own, it is dated receivedAt (the webhook timestamp).
+func extractBooks(desafio types.Desafio, receivedAt time.Time) []bookReading {
+	if len(desafio.Vinculados) == 0 {
+		progress := 0
+		if desafio.Concluido {
+			progress = 100
 		}
+		return []bookReading{{Progress: progress, UpdatedAt: receivedAt}}
+	}
 
-		// Extract book title
-		if vinculado.Edicao != nil && vinculado.Edicao.Titulo != "" {
-			bookTitle = vinculado.Edicao.Titulo
+	books := make([]bookReading, 0, len(desafio.Vinculados))
+	seen := make(map[string]bool, len(desafio.Vinculados))
+
+	for i, vinculado := range desafio.Vinculados {
+		key := vinculado.ID
+		if key == "" || seen[key] {
+			key = fallbackBookKey(i, seen)
 		}
+		seen[key] = true
 
-		// Extract cover URL
-		if vinculado.Edicao != nil && vinculado.Edicao.Capa != "" {
-			capaURL = vinculado.Edicao.Capa
+		progress := clampProgress(vinculado.Progresso)
+		if vinculado.Completo || desafio.Concluido {
+			progress = 100
 		}
 
-		// Parse update timestamp
-		if vinculado.UpdatedAt != "" {
-			parsedTime, err := time.Parse("2006-01-02", vinculado.UpdatedAt)
-			if err != nil {
-				// Try RFC3339 format
-				parsedTime, err = time.Parse(time.RFC3339, vinculado.UpdatedAt)
-			}
-			if err == nil && parsedTime.After(latestUpdate) {
-				latestUpdate = parsedTime
-			}
+		book := bookReading{
+			Key:         key,
+			VinculadoID: vinculado.ID,
+			Progress:    progress,
+			UpdatedAt:   parseUpdatedAt(vinculado.UpdatedAt),
+			Rating:      vinculado.Avaliacao,
+			Comment:     strings.TrimSpace(vinculado.Comentario),
+			MarkedDay:   vinculado.DiaMarcado,
+		}
+		if vinculado.Edicao != nil {
+			book.Title = vinculado.Edicao.Titulo
+			book.Author = vinculado.Edicao.Autor
+			book.CapaURL = vinculado.Edicao.Capa
 		}
+		books = append(books, book)
 	}
 
-	// Handle empty vinculados
-	if len(desafio.Vinculados) == 0 {
-		latestUpdate = time.Now()
-	}
+	return books
+}
 
-	// If concluido == true, force progress to 100%
-	if desafio.Concluido {
-		maxProgress = 100
+// fallbackBookKey returns the position-based key of a book without a usable
+// vinculado ID, suffixed until it differs from every key already taken.
+// Two readings sharing a key would collide in the same transaction.
+func fallbackBookKey(index int, seen map[string]bool) string {
+	key := strconv.Itoa(index)
+	for n := 1; seen[key]; n++ {
+		key = fmt.Sprintf("%d-%d", index, n)
 	}
+	return key
+}
 
-	// Clamp progress to 0-100
-	progress = clampProgress(maxProgress)
-
-	return progress, latestUpdate, bookTitle, capaURL
+// parseUpdatedAt parses a Vinculado update date (YYYY-MM-DD or RFC3339).
+// Invalid or empty values return the zero time.
+func parseUpdatedAt(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	parsedTime, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		// Try RFC3339 format
+		parsedTime, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return time.Time{}
+	}
+	return parsedTime
 }
 
 // clampProgress ensures progress is within valid range [0, 100].
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mundotalendo/functions/types"
+)
+
+// Rebuild modes.
+const (
+	// RebuildLive recomputes readings straight into the live partition.
+	RebuildLive = "live"
+	// RebuildShadow recomputes readings into the shadow partition and reports
+	// the diff against the live partition, without touching live data.
+	RebuildShadow = "shadow"
+	// RebuildSwap moves the shadow partition into the live partition.
+	RebuildSwap = "swap"
+	// RebuildKeys moves live readings whose keys differ from the ones the
+	// processor derives today (e.g. "<uuid>#<iso3>#<index>...") to current
+	// keys, rebuilding each user's last applied payload.
+	RebuildKeys = "keys"
+	// RebuildAggregates recomputes the country aggregates from the live
+	// readings, repairing drift; no reading is written.
+	RebuildAggregates = "aggregates"
+	// RebuildIndex backfills the CountryIndex key of live readings written
+	// before the index existed, in place.
+	RebuildIndex = "index"
+)
+
+// rebuildFetchWorkers bounds concurrent S3 payload fetches.
+const rebuildFetchWorkers = 10
+
+// RebuildRequest is the event that starts a rebuild, e.g.
+// {"action": "rebuild", "mode": "shadow"}.
+type RebuildRequest struct {
+	Action string `json:"action"`
+	Mode   string `json:"mode"`
+}
+
+// RebuildReport summarizes a rebuild run.
+type RebuildReport struct {
+	Mode            string           `json:"mode"`
+	PayloadsScanned int              `json:"payloadsScanned"`
+	Users           int              `json:"users"`
+	Rebuilt         int              `json:"rebuilt"`
+	Superseded      int              `json:"superseded"`
+	Aggregates      int              `json:"aggregates,omitempty"` // Country aggregates rewritten (mode aggregates)
+	Indexed         int              `json:"indexed,omitempty"`    // Readings added to the CountryIndex (mode index)
+	Failures        []RebuildFailure `json:"failures,omitempty"`
+	Diff            *RebuildDiff     `json:"diff,omitempty"`
+	DurationMs      int64            `json:"durationMs"`
+}
+
+// RebuildFailure reports a payload or user that could not be rebuilt.
+type RebuildFailure struct {
+	UUID      string `json:"uuid,omitempty"`
+	User      string `json:"user,omitempty"`
+	ErrorCode string `json:"errorCode"`
+	Error     string `json:"error"`
+}
+
+// RebuildDiff compares the shadow partition with the live partition.
+// Users only present in live have no archived payload (e.g. older than the
+// S3 lifecycle) and are left untouched by a swap.
+type RebuildDiff struct {
+	UsersChanged    int        `json:"usersChanged"`
+	UsersUnchanged  int        `json:"usersUnchanged"`
+	UsersOnlyLive   []string   `json:"usersOnlyLive,omitempty"`
+	UsersOnlyShadow []string   `json:"usersOnlyShadow,omitempty"`
+	Changes         []UserDiff `json:"changes,omitempty"`
+}
+
+// UserDiff lists the country differences for one user (ISO3 codes).
+type UserDiff struct {
+	User            string           `json:"user"`
+	Added           []string         `json:"added,omitempty"`
+	Removed         []string         `json:"removed,omitempty"`
+	ProgressChanged []ProgressChange `json:"progressChanged,omitempty"`
+}
+
+// ProgressChange is a country whose progress differs between live and shadow.
+type ProgressChange struct {
+	ISO3   string `json:"iso3"`
+	Live   int    `json:"live"`
+	Shadow int    `json:"shadow"`
+}
+
+// latestPayload is the newest archived payload found for a user.
+type latestPayload struct {
+	archived ArchivedPayload
+	payload  *types.WebhookPayload
+}
+
+// Rebuild recomputes reading data from the S3 payload archive.
+//
+// For live and shadow modes, the newest payload of each user (by reception
+// time, see latestPayloads) is run through DesafioProcessor. Live writes are
+// guarded by the per-user state, so users who sent a newer webhook meanwhile
+// are skipped.
+func (c *Consumer) Rebuild(ctx context.Context, mode string) (*RebuildReport, error) {
+	start := time.Now()
+	report := &RebuildReport{Mode: mode}
+
+	var err error
+	switch mode {
+	case RebuildLive, RebuildShadow:
+		err = c.rebuildFromArchive(ctx, report)
+		if err == nil && mode == RebuildShadow {
+			report.Diff, err = c.diffShadow(ctx)
+		}
+	case RebuildSwap:
+		err = c.swapShadow(ctx, report)
+	case RebuildKeys:
+		err = c.migrateKeys(ctx, report)
+	case RebuildAggregates:
+		err = c.reconcileAggregates(ctx, report)
+	case RebuildIndex:
+		err = c.backfillCountryIndex(ctx, report)
+	default:
+		return nil, fmt.Errorf("invalid rebuild mode %q, expected %s, %s, %s, %s, %s or %s", mode, RebuildLive, RebuildShadow, RebuildSwap, RebuildKeys, RebuildAggregates, RebuildIndex)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report.DurationMs = time.Since(start).Milliseconds()
+	log.Printf("Rebuild %s complete: users=%d, rebuilt=%d, superseded=%d, failures=%d",
+		mode, report.Users, report.Rebuilt, report.Superseded, len(report.Failures))
+	return report, nil
+}
+
+// rebuildFromArchive processes the latest archived payload of every user.
+func (c *Consumer) rebuildFromArchive(ctx context.Context, report *RebuildReport) error {
+	latest, err := c.latestPayloads(ctx, report)
+	if err != nil {
+		return err
+	}
+	report.Users = len(latest)
+
+	// Rebuilds correct past data rather than report reading progress, so no
+	// history or events are recorded. Activities are only rebuilt in place:
+	// the shadow partition holds readings alone.
+	processor := NewDesafioProcessor(c.store, c.state, c.aliases, nil, nil, c.processor.activities)
+	if report.Mode == RebuildShadow {
+		processor = NewDesafioProcessor(c.store.WithPartition(ShadowPartition), nil, c.aliases, nil, nil, nil)
+	}
+
+	users := make([]string, 0, len(latest))
+	for user := range latest {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	for _, user := range users {
+		p := latest[user]
+		webhookUUID := p.archived.UUID
+
+		if report.Mode == RebuildLive {
+			if err := c.state.Claim(ctx, user, webhookUUID, p.archived.ReceivedAt); err != nil {
+				if errors.Is(err, ErrSuperseded) {
+					report.Superseded++
+					continue
+				}
+				report.Failures = append(report.Failures, rebuildFailure(webhookUUID, user, err))
+				continue
+			}
+		}
+
+		meta := ProcessingMeta{
+			UUID:       webhookUUID,
+			User:       user,
+			AvatarURL:  p.payload.Perfil.Imagem,
+			ProfileURL: p.payload.Perfil.Link,
+			Timestamp:  p.archived.ReceivedAt,
+		}
+		_, _, results := processor.ProcessAll(ctx, p.payload, meta)
+
+		if isSuperseded(results) {
+			report.Superseded++
+			continue
+		}
+		if err := replaceError(results); err != nil {
+			report.Failures = append(report.Failures, rebuildFailure(webhookUUID, user, err))
+			continue
+		}
+		report.Rebuilt++
+	}
+
+	return nil
+}
+
+// latestPayloads finds the newest archived payload of each user from the
+// object metadata and downloads only those. Payloads archived without
+// metadata are downloaded to learn their user. Errors are reported as
+// failures and do not stop the rebuild; a user whose newest payload cannot be
+// downloaded is left out rather than rebuilt from an older one.
+func (c *Consumer) latestPayloads(ctx context.Context, report *RebuildReport) (map[string]latestPayload, error) {
+	archived, err := c.fetcher.ListPayloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.PayloadsScanned = len(archived)
+
+	var mu sync.Mutex
+	latest := make(map[string]latestPayload)
+
+	forEachArchived(archived, func(a ArchivedPayload) {
+		var payload *types.WebhookPayload
+		a, err := c.fetcher.HeadPayload(ctx, a)
+		if err == nil && a.User == "" {
+			if payload, err = c.fetcher.FetchPayload(ctx, a.UUID); err == nil {
+				a.User = payload.Perfil.Nome
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			report.Failures = append(report.Failures, rebuildFailure(a.UUID, "", err))
+		} else if current, exists := latest[a.User]; !exists || a.ReceivedAt.After(current.archived.ReceivedAt) {
+			latest[a.User] = latestPayload{archived: a, payload: payload}
+		}
+	})
+
+	var pending []ArchivedPayload
+	for _, p := range latest {
+		if p.payload == nil {
+			pending = append(pending, p.archived)
+		}
+	}
+
+	forEachArchived(pending, func(a ArchivedPayload) {
+		payload, err := c.fetcher.FetchPayload(ctx, a.UUID)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			report.Failures = append(report.Failures, rebuildFailure(a.UUID, a.User, err))
+			delete(latest, a.User)
+			return
+		}
+		latest[a.User] = latestPayload{archived: a, payload: payload}
+	})
+
+	return latest, nil
+}
+
+// forEachArchived calls fn for every archived payload, with at most
+// rebuildFetchWorkers calls running at once.
+func forEachArchived(archived []ArchivedPayload, fn func(ArchivedPayload)) {
+	var wg sync.WaitGroup
+	jobs := make(chan ArchivedPayload)
+
+	for i := 0; i < rebuildFetchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range jobs {
+				fn(a)
+			}
+		}()
+	}
+
+	for _, a := range archived {
+		jobs <- a
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// swapShadow replaces live readings with the shadow readings of each user and
+// clears the shadow partition. Users who sent a newer webhook since the shadow
+// rebuild are skipped (their shadow readings are discarded).
+func (c *Consumer) swapShadow(ctx context.Context, report *RebuildReport) error {
+	shadowStore := c.store.WithPartition(ShadowPartition)
+	shadow, err := shadowStore.QueryReadings(ctx)
+	if err != nil {
+		return err
+	}
+
+	byUser := groupReadingsByUser(shadow)
+	report.Users = len(byUser)
+
+	for user, items := range byUser {
+		webhookUUID := items[0].WebhookUUID
+
+		err := c.store.ReplaceUserReadings(ctx, user, items, c.state.Guard(user, webhookUUID))
+		switch {
+		case errors.Is(err, ErrSuperseded):
+			report.Superseded++
+		case err != nil:
+			report.Failures = append(report.Failures, rebuildFailure(webhookUUID, user, err))
+			continue // keep shadow readings so the swap can be retried
+		default:
+			report.Rebuilt++
+		}
+
+		if err := shadowStore.ReplaceUserReadings(ctx, user, nil); err != nil {
+			log.Printf("WARN: Failed to clear shadow readings for user %s: %v", user, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateKeys moves live readings to the keys the processor derives today
+// ("<user>#<desafioID>[#<bookKey>]", see readingSK). Legacy items carry no
+// desafio ID, so each user's last applied payload is fetched from the archive
+// and rebuilt; the readings are replaced only when a key differs, so the
+// user's next identical webhook finds them unchanged. Users who sent a newer
+// webhook meanwhile are skipped: that webhook already wrote current keys.
+func (c *Consumer) migrateKeys(ctx context.Context, report *RebuildReport) error {
+	live, err := c.store.QueryReadings(ctx)
+	if err != nil {
+		return err
+	}
+
+	byUser := groupReadingsByUser(live)
+	report.Users = len(byUser)
+
+	// Keys only: no history, events or activities are recorded.
+	processor := NewDesafioProcessor(c.store, c.state, c.aliases, nil, nil, nil)
+
+	users := make([]string, 0, len(byUser))
+	for user := range byUser {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	for _, user := range users {
+		items := byUser[user]
+
+		meta, err := c.appliedMeta(ctx, user, items)
+		if err != nil {
+			report.Failures = append(report.Failures, rebuildFailure(meta.UUID, user, err))
+			continue
+		}
+		payload, err := c.fetcher.FetchPayload(ctx, meta.UUID)
+		if err != nil {
+			report.Failures = append(report.Failures, rebuildFailure(meta.UUID, user, err))
+			continue
+		}
+		report.PayloadsScanned++
+		meta.AvatarURL = payload.Perfil.Imagem
+		meta.ProfileURL = payload.Perfil.Link
+
+		migrated, _, _ := processor.build(ctx, payload, meta)
+		if sameKeys(items, migrated) {
+			continue
+		}
+
+		err = c.store.ReplaceUserReadings(ctx, user, migrated, c.state.Guard(user, meta.UUID))
+		switch {
+		case errors.Is(err, ErrSuperseded):
+			report.Superseded++
+		case err != nil:
+			report.Failures = append(report.Failures, rebuildFailure(meta.UUID, user, err))
+		default:
+			report.Rebuilt++
+		}
+	}
+
+	return nil
+}
+
+// appliedMeta returns the webhook that wrote the user's readings: the last one
+// applied per the user state or, for readings older than the user state, the
+// one recorded on the readings (dated by their newest update).
+func (c *Consumer) appliedMeta(ctx context.Context, user string, items []types.LeituraItem) (ProcessingMeta, error) {
+	meta := ProcessingMeta{User: user, UUID: items[0].WebhookUUID}
+
+	state, err := c.state.Get(ctx, user)
+	if err != nil {
+		return meta, err
+	}
+	if state != nil {
+		meta.UUID = state.LastUUID
+		meta.Timestamp = time.Unix(0, state.LastApplied).UTC()
+		return meta, nil
+	}
+
+	for _, item := range items {
+		if t, err := time.Parse(time.RFC3339, item.UpdatedAt); err == nil && t.After(meta.Timestamp) {
+			meta.Timestamp = t
+		}
+	}
+	return meta, nil
+}
+
+// sameKeys reports whether two sets of readings have exactly the same keys.
+func sameKeys(live, migrated []types.LeituraItem) bool {
+	if len(live) != len(migrated) {
+		return false
+	}
+	keys := make(map[string]bool, len(live))
+	for _, item := range live {
+		keys[item.SK] = true
+	}
+	for _, item := range migrated {
+		if !keys[item.SK] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffShadow compares the shadow partition with the live partition, by user
+// and country (maximum progress per country).
+func (c *Consumer) diffShadow(ctx context.Context) (*RebuildDiff, error) {
+	live, err := c.store.QueryReadings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shadow, err := c.store.WithPartition(ShadowPartition).QueryReadings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return diffReadings(live, shadow), nil
+}
+
+// diffReadings builds a RebuildDiff from live and shadow readings.
+func diffReadings(live, shadow []types.LeituraItem) *RebuildDiff {
+	liveProgress := progressByUser(live)
+	shadowProgress := progressByUser(shadow)
+	diff := &RebuildDiff{}
+
+	for user := range liveProgress {
+		if _, exists := shadowProgress[user]; !exists {
+			diff.UsersOnlyLive = append(diff.UsersOnlyLive, user)
+		}
+	}
+
+	for user, countries := range shadowProgress {
+		liveCountries, exists := liveProgress[user]
+		if !exists {
+			diff.UsersOnlyShadow = append(diff.UsersOnlyShadow, user)
+		}
+
+		userDiff := UserDiff{User: user}
+		for iso3, progress := range countries {
+			liveValue, found := liveCountries[iso3]
+			switch {
+			case !found:
+				userDiff.Added = append(userDiff.Added, iso3)
+			case liveValue != progress:
+				userDiff.ProgressChanged = append(userDiff.ProgressChanged, ProgressChange{ISO3: iso3, Live: liveValue, Shadow: progress})
+			}
+		}
+		for iso3 := range liveCountries {
+			if _, found := countries[iso3]; !found {
+				userDiff.Removed = append(userDiff.Removed, iso3)
+			}
+		}
+
+		if len(userDiff.Added) == 0 && len(userDiff.Removed) == 0 && len(userDiff.ProgressChanged) == 0 {
+			diff.UsersUnchanged++
+			continue
+		}
+
+		sort.Strings(userDiff.Added)
+		sort.Strings(userDiff.Removed)
+		sort.Slice(userDiff.ProgressChanged, func(i, j int) bool {
+			return userDiff.ProgressChanged[i].ISO3 < userDiff.ProgressChanged[j].ISO3
+		})
+		diff.UsersChanged++
+		diff.Changes = append(diff.Changes, userDiff)
+	}
+
+	sort.Strings(diff.UsersOnlyLive)
+	sort.Strings(diff.UsersOnlyShadow)
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].User < diff.Changes[j].User
+	})
+
+	return diff
+}
+
+// progressByUser maps user -> ISO3 -> maximum progress.
+func progressByUser(items []types.LeituraItem) map[string]map[string]int {
+	result := make(map[string]map[string]int)
+	for _, item := range items {
+		countries, exists := result[item.User]
+		if !exists {
+			countries = make(map[string]int)
+			result[item.User] = countries
+		}
+		if current, found := countries[item.ISO3]; !found || item.Progresso > current {
+			countries[item.ISO3] = item.Progresso
+		}
+	}
+	return result
+}
+
+// groupReadingsByUser groups readings by user.
+func groupReadingsByUser(items []types.LeituraItem) map[string][]types.LeituraItem {
+	result := make(map[string][]types.LeituraItem)
+	for _, item := range items {
+		result[item.User] = append(result[item.User], item)
+	}
+	return result
+}
+
+// replaceError returns the readings write error from processing results, if any.
+// Per-desafio errors such as unmapped countries are not rebuild failures.
+func replaceError(results []ProcessingResult) error {
+	for _, r := range results {
+		if r.Error != nil && !errors.Is(r.Error, ErrCountryNotFound) {
+			return r.Error
+		}
+	}
+	return nil
+}
+
+func rebuildFailure(webhookUUID, user string, err error) RebuildFailure {
+	return RebuildFailure{
+		UUID:      webhookUUID,
+		User:      user,
+		ErrorCode: ErrorCode(err),
+		Error:     err.Error(),
+	}
+}
+
+// reconcileAggregates recomputes the country aggregates from the live readings.
+func (c *Consumer) reconcileAggregates(ctx context.Context, report *RebuildReport) error {
+	if c.store.aggregates == nil {
+		return fmt.Errorf("country aggregates are not configured")
+	}
+
+	readings, err := c.store.QueryReadings(ctx)
+	if err != nil {
+		return err
+	}
+
+	users := make(map[string]bool)
+	for _, reading := range readings {
+		users[reading.User] = true
+	}
+	report.Users = len(users)
+
+	report.Aggregates, err = c.store.aggregates.Reconcile(ctx, readings)
+	return err
+}
+
+// backfillCountryIndex sets the CountryIndex key of every live reading that
+// lacks it. Readings rewritten meanwhile were indexed by that write and count
+// as superseded.
+func (c *Consumer) backfillCountryIndex(ctx context.Context, report *RebuildReport) error {
+	readings, err := c.store.QueryReadings(ctx)
+	if err != nil {
+		return err
+	}
+
+	users := make(map[string]bool)
+	for _, reading := range readings {
+		users[reading.User] = true
+		if reading.ISO3 == "" || reading.CountryKey == countryKey(reading.PK, reading.ISO3) {
+			continue
+		}
+
+		err := c.store.SetCountryKey(ctx, reading)
+		switch {
+		case errors.Is(err, ErrSuperseded):
+			report.Superseded++
+		case err != nil:
+			report.Failures = append(report.Failures, rebuildFailure(reading.WebhookUUID, reading.User, err))
+		default:
+			report.Indexed++
+		}
+	}
+	report.Users = len(users)
+
+	if report.Indexed > 0 {
+		c.store.bumpDataVersion(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// archivedObject builds a ListObjectsV2 entry for payloads/{uuid}.json.
+func archivedObject(uuid string, modified time.Time) s3types.Object {
+	return s3types.Object{
+		Key:          aws.String("payloads/" + uuid + ".json"),
+		LastModified: aws.Time(modified),
+	}
+}
+
+func TestRebuild_ShadowKeepsNewestPayloadPerUser(t *testing.T) {
+	older := time.Date(2026, 1, 10, 10, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	s3Client := &mockS3Client{
+		objects: []s3types.Object{
+			archivedObject("old", older),
+			archivedObject("new", newer),
+			{Key: aws.String("payloads/")}, // folder marker, ignored
+		},
+		bodies: map[string]string{
+			"payloads/old.json": `{"perfil": {"nome": "Test User"}, "desafios": [{"descricao": "Brasil", "tipo": "leitura"}]}`,
+			"payloads/new.json": `{"perfil": {"nome": "Test User"}, "desafios": [{"descricao": "Japão", "tipo": "leitura"}]}`,
+		},
+	}
+	dynamoClient := &mockDynamoDBClient{}
+	consumer := newTestConsumer(s3Client, dynamoClient)
+
+	report, err := consumer.Rebuild(context.Background(), RebuildShadow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.PayloadsScanned != 2 || report.Users != 1 || report.Rebuilt != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(dynamoClient.putsWithPrefix("USERSTATE#")) != 0 {
+		t.Error("shadow rebuild must not claim user state")
+	}
+	if len(dynamoClient.transacts) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(dynamoClient.transacts))
+	}
+
+	items := dynamoClient.transacts[0].TransactItems
+	if len(items) != 1 || items[0].Put == nil {
+		t.Fatalf("expected a single unguarded put, got %+v", items)
+	}
+	put := items[0].Put.Item
+	if pk := put["PK"].(*ddbtypes.AttributeValueMemberS).Value; pk != ShadowPartition {
+		t.Errorf("expected PK %s, got %s", ShadowPartition, pk)
+	}
+	if iso := put["iso3"].(*ddbtypes.AttributeValueMemberS).Value; iso != "JPN" {
+		t.Errorf("expected newest payload (JPN), got %s", iso)
+	}
+	if report.Diff == nil {
+		t.Error("expected a diff report in shadow mode")
+	}
+}
+
+func TestRebuild_DownloadsOnlyNewestPayloadPerUser(t *testing.T) {
+	received := time.Date(2026, 1, 10, 10, 0, 0, 0, time.UTC)
+	archived := received.Add(time.Hour) // S3 LastModified, ignored when metadata is present
+	metadata := func(user string, at time.Time) map[string]string {
+		return map[string]string{
+			types.PayloadMetadataUser:      url.QueryEscape(user),
+			types.PayloadMetadataTimestamp: at.Format(time.RFC3339Nano),
+		}
+	}
+
+	s3Client := &mockS3Client{
+		objects: []s3types.Object{
+			archivedObject("new", archived),
+			archivedObject("old", archived.Add(time.Minute)),
+		},
+		metadata: map[string]map[string]string{
+			"payloads/new.json": metadata("João", received.Add(time.Second)),
+			"payloads/old.json": metadata("João", received),
+		},
+		bodies: map[string]string{
+			"payloads/new.json": `{"perfil": {"nome": "João"}, "desafios": [{"descricao": "Japão", "tipo": "leitura"}]}`,
+		},
+	}
+	dynamoClient := &mockDynamoDBClient{}
+	consumer := newTestConsumer(s3Client, dynamoClient)
+
+	report, err := consumer.Rebuild(context.Background(), RebuildShadow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.PayloadsScanned != 2 || report.Users != 1 || report.Rebuilt != 1 || len(report.Failures) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(s3Client.fetched) != 1 || s3Client.fetched[0] != "payloads/new.json" {
+		t.Errorf("expected only the newest payload to be downloaded, got %v", s3Client.fetched)
+	}
+	put := dynamoClient.transacts[0].TransactItems[0].Put.Item
+	if user := put["user"].(*ddbtypes.AttributeValueMemberS).Value; user != "João" {
+		t.Errorf("expected the unescaped user, got %s", user)
+	}
+}
+
+func TestRebuild_LiveClaimsUserState(t *testing.T) {
+	s3Client := &mockS3Client{
+		payload: testPayload,
+		objects: []s3types.Object{archivedObject("uuid-1", time.Date(2026, 1, 10, 10, 0, 0, 0, time.UTC))},
+	}
+	dynamoClient := &mockDynamoDBClient{}
+	consumer := newTestConsumer(s3Client, dynamoClient)
+
+	report, err := consumer.Rebuild(context.Background(), RebuildLive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Rebuilt != 1 || report.Diff != nil {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(dynamoClient.putsWithPrefix("USERSTATE#Test User")) != 1 {
+		t.Error("expected the user state to be claimed")
+	}
+	items := dynamoClient.transacts[0].TransactItems
+	if items[0].ConditionCheck == nil {
+		t.Error("expected live writes to be guarded by the user state")
+	}
+	if pk := items[1].Put.Item["PK"].(*ddbtypes.AttributeValueMemberS).Value; pk != LivePartition {
+		t.Errorf("expected PK %s, got %s", LivePartition, pk)
+	}
+}
+
+func TestRebuild_KeysMigratesLegacyReadings(t *testing.T) {
+	payload := `{"perfil": {"nome": "Ana"}, "desafios": [{"id": "d1", "descricao": "Brasil", "categoria": "Janeiro", "tipo": "leitura", "vinculados": [{"id": "v1", "progresso": 40}]}]}`
+	dynamoClient := &mockDynamoDBClient{
+		partitions: map[string][]map[string]ddbtypes.AttributeValue{
+			LivePartition: {
+				mustMarshal(t, types.LeituraItem{PK: LivePartition, SK: "uuid-1#BRA#0#v1", User: "Ana", ISO3: "BRA", Progresso: 40, WebhookUUID: "uuid-1"}),
+			},
+		},
+		getItems: map[string]map[string]ddbtypes.AttributeValue{
+			"USERSTATE#Ana": mustMarshal(t, UserStateItem{LastUUID: "uuid-1", LastApplied: time.Date(2026, 1, 10, 10, 0, 0, 0, time.UTC).UnixNano()}),
+		},
+	}
+	consumer := newTestConsumer(&mockS3Client{bodies: map[string]string{"payloads/uuid-1.json": payload}}, dynamoClient)
+
+	report, err := consumer.Rebuild(context.Background(), RebuildKeys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Users != 1 || report.Rebuilt != 1 || len(report.Failures) != 0 {
+		t.Errorf("expected Ana to be migrated, got %+v", report)
+	}
+	if len(dynamoClient.transacts) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(dynamoClient.transacts))
+	}
+
+	items := dynamoClient.transacts[0].TransactItems
+	if items[0].ConditionCheck == nil {
+		t.Error("expected the migration to be guarded by the user state")
+	}
+	if sk := items[1].Put.Item["SK"].(*ddbtypes.AttributeValueMemberS).Value; sk != "Ana#d1#v1" {
+		t.Errorf("expected current key Ana#d1#v1, got %s", sk)
+	}
+	deleted := false
+	for _, item := range items {
+		if item.Delete != nil && item.Delete.Key["SK"].(*ddbtypes.AttributeValueMemberS).Value == "uuid-1#BRA#0#v1" {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Error("expected the legacy key to be deleted")
+	}
+
+	// Serve the migrated readings back: the user's next identical webhook
+	// must find nothing to change
+	dynamoClient.partitions[LivePartition] = dynamoClient.transactPutsWithPrefix(LivePartition)
+	transacts, bumps := len(dynamoClient.transacts), dynamoClient.bumps
+
+	meta := ProcessingMeta{UUID: "uuid-2", User: "Ana", Timestamp: time.Date(2026, 1, 11, 10, 0, 0, 0, time.UTC)}
+	parsed := &types.WebhookPayload{}
+	if err := json.Unmarshal([]byte(payload), parsed); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if _, errCount, results := consumer.processor.ProcessAll(context.Background(), parsed, meta); errCount != 0 {
+		t.Fatalf("unexpected errors: %+v", results)
+	}
+
+	if n := len(dynamoClient.transacts) - transacts; n != 0 {
+		t.Errorf("expected the identical webhook to write nothing after the migration, got %d transactions", n)
+	}
+	if n := dynamoClient.bumps - bumps; n != 0 {
+		t.Errorf("expected the identical webhook to keep the data version, got %d bumps", n)
+	}
+}
+
+func TestRebuild_KeysKeepsCurrentReadings(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		partitions: map[string][]map[string]ddbtypes.AttributeValue{
+			LivePartition: {
+				mustMarshal(t, types.LeituraItem{PK: LivePartition, SK: "Bia#d1", User: "Bia", ISO3: "FRA", WebhookUUID: "uuid-2"}),
+			},
+		},
+	}
+	s3Client := &mockS3Client{bodies: map[string]string{
+		"payloads/uuid-2.json": `{"perfil": {"nome": "Bia"}, "desafios": [{"id": "d1", "descricao": "França", "tipo": "leitura"}]}`,
+	}}
+	consumer := newTestConsumer(s3Client, dynamoClient)
+
+	report, err := consumer.Rebuild(context.Background(), RebuildKeys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Users != 1 || report.Rebuilt != 0 || len(report.Failures) != 0 {
+		t.Errorf("expected Bia to be left as is, got %+v", report)
+	}
+	if len(dynamoClient.transacts) != 0 {
+		t.Errorf("expected no write, got %d transactions", len(dynamoClient.transacts))
+	}
+}
+
+func TestRebuild_IndexBackfillsCountryKey(t *testing.T) {
+	dynamoClient := &mockDynamoDBClient{
+		partitions: map[string][]map[string]ddbtypes.AttributeValue{
+			LivePartition: {
+				mustMarshal(t, types.LeituraItem{PK: LivePartition, SK: "Ana#d1", User: "Ana", ISO3: "BRA", UpdatedAt: "2026-01-10T00:00:00Z"}),
+				mustMarshal(t, types.LeituraItem{PK: LivePartition, SK: "Bia#d1", User: "Bia", ISO3: "FRA", CountryKey: "FRA"}),
+			},
+		},
+	}
+	consumer := newTestConsumer(&mockS3Client{}, dynamoClient)
+
+	report, err := consumer.Rebuild(context.Background(), RebuildIndex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Users != 2 || report.Indexed != 1 {
+		t.Errorf("expected only Ana's reading to be indexed, got %+v", report)
+	}
+	if len(dynamoClient.updates) != 1 {
+		t.Fatalf("expected 1 update, got %d", len(dynamoClient.updates))
+	}
+	update := dynamoClient.updates[0]
+	if sk := update.Key["SK"].(*ddbtypes.AttributeValueMemberS).Value; sk != "Ana#d1" {
+		t.Errorf("expected Ana#d1 to be updated, got %s", sk)
+	}
+	if key := update.ExpressionAttributeValues[":key"].(*ddbtypes.AttributeValueMemberS).Value; key != "BRA" {
+		t.Errorf("expected countryKey BRA, got %s", key)
+	}
+	if update.ConditionExpression == nil {
+		t.Error("expected the update to be conditioned on the reading being unchanged")
+	}
+	if dynamoClient.bumps != 1 {
+		t.Errorf("expected the data version to be bumped once, got %d", dynamoClient.bumps)
+	}
+}
+
+func TestRebuild_InvalidMode(t *testing.T) {
+	consumer := newTestConsumer(&mockS3Client{}, &mockDynamoDBClient{})
+
+	if _, err := consumer.Rebuild(context.Background(), "everything"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
+
+func TestDiffReadings(t *testing.T) {
+	live := []types.LeituraItem{
+		{User: "Ana", ISO3: "BRA", Progresso: 50},
+		{User: "Ana", ISO3: "JPN", Progresso: 100},
+		{User: "Bia", ISO3: "FRA", Progresso: 10},
+		{User: "Caio", ISO3: "ITA", Progresso: 30},
+	}
+	shadow := []types.LeituraItem{
+		{User: "Ana", ISO3: "BRA", Progresso: 80},
+		{User: "Ana", ISO3: "PRT", Progresso: 20},
+		{User: "Bia", ISO3: "FRA", Progresso: 5},
+		{User: "Bia", ISO3: "FRA", Progresso: 10}, // maximum per country is compared
+		{User: "Duda", ISO3: "ARG", Progresso: 40},
+	}
+
+	diff := diffReadings(live, shadow)
+
+	if diff.UsersUnchanged != 1 || diff.UsersChanged != 2 {
+		t.Errorf("expected 2 changed and 1 unchanged user, got %+v", diff)
+	}
+	if len(diff.UsersOnlyLive) != 1 || diff.UsersOnlyLive[0] != "Caio" {
+		t.Errorf("expected Caio only in live, got %v", diff.UsersOnlyLive)
+	}
+	if len(diff.UsersOnlyShadow) != 1 || diff.UsersOnlyShadow[0] != "Duda" {
+		t.Errorf("expected Duda only in shadow, got %v", diff.UsersOnlyShadow)
+	}
+
+	ana := diff.Changes[0]
+	if ana.User != "Ana" {
+		t.Fatalf("expected changes sorted by user, got %s first", ana.User)
+	}
+	if len(ana.Added) != 1 || ana.Added[0] != "PRT" {
+		t.Errorf("expected PRT added, got %v", ana.Added)
+	}
+	if len(ana.Removed) != 1 || ana.Removed[0] != "JPN" {
+		t.Errorf("expected JPN removed, got %v", ana.Removed)
+	}
+	if len(ana.ProgressChanged) != 1 || ana.ProgressChanged[0] != (ProgressChange{ISO3: "BRA", Live: 50, Shadow: 80}) {
+		t.Errorf("expected BRA progress change, got %v", ana.ProgressChanged)
+	}
+}
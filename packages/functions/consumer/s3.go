@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -18,6 +21,8 @@ import (
 // This interface enables mocking in unit tests.
 type S3Client interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 }
 
 // PayloadFetcher handles fetching and parsing webhook payloads from S3.
@@ -82,3 +87,73 @@ func (f *PayloadFetcher) FetchPayload(ctx context.Context, uuid string) (*types.
 
 	return &payload, nil
 }
+
+// ArchivedPayload identifies a payload stored in the archive.
+type ArchivedPayload struct {
+	UUID       string
+	User       string    // From the object metadata; empty until read (see HeadPayload)
+	ReceivedAt time.Time // Webhook reception time, or S3 LastModified for payloads archived without metadata
+}
+
+// ListPayloads lists every archived payload (payloads/{uuid}.json).
+//
+// Returns:
+//   - error: ErrS3Fetch if listing fails
+func (f *PayloadFetcher) ListPayloads(ctx context.Context) ([]ArchivedPayload, error) {
+	var payloads []ArchivedPayload
+
+	paginator := s3.NewListObjectsV2Paginator(f.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(f.bucketName),
+		Prefix: aws.String("payloads/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrS3Fetch, err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if !strings.HasSuffix(key, ".json") {
+				continue
+			}
+			payloads = append(payloads, ArchivedPayload{
+				UUID:       strings.TrimSuffix(strings.TrimPrefix(key, "payloads/"), ".json"),
+				ReceivedAt: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	log.Printf("Listed %d archived payload(s) in %s", len(payloads), f.bucketName)
+	return payloads, nil
+}
+
+// HeadPayload reads the user and reception time of an archived payload from its
+// object metadata, without downloading it. Payloads archived before the webhook
+// recorded them are returned unchanged (empty User).
+//
+// Returns:
+//   - error: ErrPayloadNotFound if the object doesn't exist, ErrS3Fetch otherwise
+func (f *PayloadFetcher) HeadPayload(ctx context.Context, a ArchivedPayload) (ArchivedPayload, error) {
+	key := fmt.Sprintf("payloads/%s.json", a.UUID)
+
+	result, err := f.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(f.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return a, fmt.Errorf("%w: %s", ErrPayloadNotFound, key)
+		}
+		return a, fmt.Errorf("%w: %v", ErrS3Fetch, err)
+	}
+
+	if user, err := url.QueryUnescape(result.Metadata[types.PayloadMetadataUser]); err == nil {
+		a.User = user
+	}
+	if receivedAt, err := time.Parse(time.RFC3339Nano, result.Metadata[types.PayloadMetadataTimestamp]); err == nil {
+		a.ReceivedAt = receivedAt
+	}
+	return a, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// StatusStore handles DynamoDB operations for webhook processing status records.
+type StatusStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewStatusStore creates a new StatusStore with the given DynamoDB client and table name.
+func NewStatusStore(client DynamoDBClient, tableName string) *StatusStore {
+	return &StatusStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// SaveStatus writes the full status record, replacing the previous transition.
+// In-flight statuses (PROCESSING, RETRYING) are written conditionally, so a late
+// redelivery never hides the final status of a webhook; only FAILED may be
+// left again, when a dead-lettered message is redriven.
+//
+// Returns:
+//   - error: ErrDynamoDBWrite if the write fails
+func (s *StatusStore) SaveStatus(ctx context.Context, item types.WebhookStatusItem) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      av,
+	}
+	if item.Status == types.StatusProcessing || item.Status == types.StatusRetrying {
+		input.ConditionExpression = aws.String("attribute_not_exists(PK) OR #status IN (:queued, :processing, :retrying, :failed)")
+		input.ExpressionAttributeNames = map[string]string{"#status": "status"}
+		input.ExpressionAttributeValues = map[string]ddbtypes.AttributeValue{
+			":queued":     &ddbtypes.AttributeValueMemberS{Value: types.StatusQueued},
+			":processing": &ddbtypes.AttributeValueMemberS{Value: types.StatusProcessing},
+			":retrying":   &ddbtypes.AttributeValueMemberS{Value: types.StatusRetrying},
+			":failed":     &ddbtypes.AttributeValueMemberS{Value: types.StatusFailed},
+		}
+	}
+
+	_, err = s.client.PutItem(ctx, input)
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		log.Printf("Kept final status for UUID=%s, skipped %s", item.UUID, item.Status)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+
+	log.Printf("Saved status: UUID=%s, Status=%s", item.UUID, item.Status)
+	return nil
+}
+
+// newStatusItem creates a status record for a webhook message.
+func newStatusItem(msg types.SQSMessage, status string) types.WebhookStatusItem {
+	pk, sk := types.WebhookStatusKey(msg.UUID)
+	now := time.Now()
+
+	return types.WebhookStatusItem{
+		PK:         pk,
+		SK:         sk,
+		UUID:       msg.UUID,
+		User:       msg.User,
+		Status:     status,
+		ReceivedAt: msg.Timestamp,
+		UpdatedAt:  now.UTC().Format(time.RFC3339),
+		ExpiresAt:  now.AddDate(0, 0, types.StatusRetentionDays).Unix(),
+	}
+}
+
+// summarizeResults converts processing results into per-desafio outcomes
+// and the overall webhook status.
+//
+// PROCESSED: no desafio failed (skipped desafios do not count as failures)
+// PARTIAL:   some desafios saved, some failed
+// FAILED:    desafios failed and none were saved
+func summarizeResults(results []ProcessingResult) (string, []types.DesafioOutcome) {
+	outcomes := make([]types.DesafioOutcome, 0, len(results))
+	processed, failed := 0, 0
+
+	for _, r := range results {
+		outcome := types.DesafioOutcome{
+			Country: r.Country,
+			ISO3:    r.ISO3,
+		}
+
+		switch {
+		case r.Processed:
+			outcome.Outcome = types.OutcomeProcessed
+			processed++
+		case r.Error != nil:
+			outcome.Outcome = types.OutcomeFailed
+			outcome.ErrorCode = ErrorCode(r.Error)
+			failed++
+		default:
+			outcome.Outcome = types.OutcomeSkipped
+		}
+
+		outcomes = append(outcomes, outcome)
+	}
+
+	switch {
+	case failed == 0:
+		return types.StatusProcessed, outcomes
+	case processed > 0:
+		return types.StatusPartial, outcomes
+	default:
+		return types.StatusFailed, outcomes
+	}
+}
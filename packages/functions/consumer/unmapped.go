@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// UnmappedStore quarantines country names that could not be mapped to ISO3,
+// with occurrence counts and affected users, until an alias is registered.
+type UnmappedStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewUnmappedStore creates a new UnmappedStore with the given DynamoDB client and table name.
+func NewUnmappedStore(client DynamoDBClient, tableName string) *UnmappedStore {
+	return &UnmappedStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// unmappedKey returns the primary key of an UnmappedCountryItem.
+func unmappedKey(name string) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"PK": &ddbtypes.AttributeValueMemberS{Value: types.UnmappedCountryPartition},
+		"SK": &ddbtypes.AttributeValueMemberS{Value: types.CountryNameKey(name)},
+	}
+}
+
+// Record counts one occurrence of an unmapped country for a user.
+// The update is atomic, so concurrent users do not lose occurrences.
+//
+// Returns:
+//   - error: ErrDynamoDBWrite if the update fails
+func (s *UnmappedStore) Record(ctx context.Context, name, user, webhookUUID string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	values := map[string]ddbtypes.AttributeValue{
+		":name": &ddbtypes.AttributeValueMemberS{Value: name},
+		":one":  &ddbtypes.AttributeValueMemberN{Value: "1"},
+		":uuid": &ddbtypes.AttributeValueMemberS{Value: webhookUUID},
+		":now":  &ddbtypes.AttributeValueMemberS{Value: now},
+	}
+	update := "SET #name = :name, lastUUID = :uuid, lastSeen = :now, firstSeen = if_not_exists(firstSeen, :now) ADD occurrences :one"
+	if user != "" {
+		values[":user"] = &ddbtypes.AttributeValueMemberSS{Value: []string{user}}
+		update += ", #users :user"
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.tableName),
+		Key:              unmappedKey(name),
+		UpdateExpression: aws.String(update),
+		ExpressionAttributeNames: map[string]string{
+			"#name":  "name",
+			"#users": "users",
+		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+
+	log.Printf("Recorded unmapped country: %s (user %s)", name, user)
+	return nil
+}
+
+// Get returns the quarantined country, or nil if the name was never recorded.
+//
+// Returns:
+//   - error: ErrDynamoDBRead if the read fails
+func (s *UnmappedStore) Get(ctx context.Context, name string) (*types.UnmappedCountryItem, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       unmappedKey(name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var item types.UnmappedCountryItem
+	if err := attributevalue.UnmarshalMap(result.Item, &item); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+	}
+	return &item, nil
+}
+
+// Delete removes a country from quarantine once an alias is registered.
+//
+// Returns:
+//   - error: ErrDynamoDBWrite if the delete fails
+func (s *UnmappedStore) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       unmappedKey(name),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+	return nil
+}
+
+// RemoveUsers removes users from a quarantined country, keeping it (and any
+// user recorded meanwhile) for the others.
+//
+// Returns:
+//   - error: ErrDynamoDBWrite if the update fails
+func (s *UnmappedStore) RemoveUsers(ctx context.Context, name string, users []string) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tableName),
+		Key:                 unmappedKey(name),
+		UpdateExpression:    aws.String("DELETE #users :users"),
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+		ExpressionAttributeNames: map[string]string{
+			"#users": "users",
+		},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":users": &ddbtypes.AttributeValueMemberSS{Value: users},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// UserStateItem records the last webhook applied to a user's readings.
+// PK: "USERSTATE#<user>" - one item per perfil.nome
+// SK: "STATE"
+// LastApplied is the SQSMessage timestamp in Unix nanoseconds so that several
+// syncs within the same second are still ordered.
+type UserStateItem struct {
+	PK            string `dynamodbav:"PK"`
+	SK            string `dynamodbav:"SK"`
+	LastApplied   int64  `dynamodbav:"lastApplied"`
+	LastUUID      string `dynamodbav:"lastUUID"`
+	LastTimestamp string `dynamodbav:"lastTimestamp"`
+	UpdatedAt     string `dynamodbav:"updatedAt"`
+}
+
+// UserStateStore guards a user's readings against out-of-order webhooks.
+type UserStateStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewUserStateStore creates a new UserStateStore with the given DynamoDB client and table name.
+func NewUserStateStore(client DynamoDBClient, tableName string) *UserStateStore {
+	return &UserStateStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// userStateKey returns the primary key of a user's state item.
+func userStateKey(user string) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"PK": &ddbtypes.AttributeValueMemberS{Value: "USERSTATE#" + user},
+		"SK": &ddbtypes.AttributeValueMemberS{Value: "STATE"},
+	}
+}
+
+// Claim marks the webhook as the latest one for the user with a conditional write.
+// A redelivery of the webhook that already holds the claim is accepted, so SQS
+// retries after a transient failure are not mistaken for stale messages.
+//
+// Returns:
+//   - error: ErrSuperseded if a newer webhook was already claimed,
+//     ErrDynamoDBWrite if the write fails
+func (s *UserStateStore) Claim(ctx context.Context, user, webhookUUID string, timestamp time.Time) error {
+	item := UserStateItem{
+		PK:            "USERSTATE#" + user,
+		SK:            "STATE",
+		LastApplied:   timestamp.UnixNano(),
+		LastUUID:      webhookUUID,
+		LastTimestamp: timestamp.UTC().Format(time.RFC3339Nano),
+		UpdatedAt:     time.Now().UTC().Format(time.RFC3339),
+	}
+
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(PK) OR lastApplied < :ts OR lastUUID = :uuid"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":ts":   &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(item.LastApplied, 10)},
+			":uuid": &ddbtypes.AttributeValueMemberS{Value: webhookUUID},
+		},
+		ReturnValuesOnConditionCheckFailure: ddbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var conditionFailed *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			var current UserStateItem
+			if err := attributevalue.UnmarshalMap(conditionFailed.Item, &current); err == nil {
+				log.Printf("Superseded: UUID=%s (%s) is older than applied UUID=%s (%s) for user %s",
+					webhookUUID, item.LastTimestamp, current.LastUUID, current.LastTimestamp, user)
+			}
+			return ErrSuperseded
+		}
+		return fmt.Errorf("%w: %v", ErrDynamoDBWrite, err)
+	}
+
+	return nil
+}
+
+// Get returns the user's state, or nil if no webhook was claimed for the user.
+//
+// Returns:
+//   - error: ErrDynamoDBRead if the read fails
+func (s *UserStateStore) Get(ctx context.Context, user string) (*UserStateItem, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       userStateKey(user),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var item UserStateItem
+	if err := attributevalue.UnmarshalMap(result.Item, &item); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDynamoDBRead, err)
+	}
+	return &item, nil
+}
+
+// Guard returns a transaction condition that only holds while the webhook is
+// still the latest claimed for the user (or no webhook was claimed yet, e.g.
+// readings written before user state existed). Adding it to the readings
+// transaction stops a slow, older message from overwriting newer readings.
+func (s *UserStateStore) Guard(user, webhookUUID string) ddbtypes.TransactWriteItem {
+	return ddbtypes.TransactWriteItem{
+		ConditionCheck: &ddbtypes.ConditionCheck{
+			TableName:           aws.String(s.tableName),
+			Key:                 userStateKey(user),
+			ConditionExpression: aws.String("attribute_not_exists(PK) OR lastUUID = :uuid"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+				":uuid": &ddbtypes.AttributeValueMemberS{Value: webhookUUID},
+			},
+		},
+	}
+}
@@ -0,0 +1,204 @@
+// Package main implements the reading history endpoints.
+//
+// GET /history/users/{user} returns every progress change of a user and
+// GET /history/countries/{iso3} every progress change in a country, both in
+// chronological order. Records are appended by the consumer (HistoryItem) only
+// when a webhook actually changes a book's progress.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/mapping"
+	"github.com/mundotalendo/functions/types"
+)
+
+var (
+	dynamoClient *dynamodb.Client
+	tableName    string
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("SST_Resource_DataTable_name")
+}
+
+func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	log.Printf("History request: %s %v", request.RouteKey, request.PathParameters)
+
+	// Validate API key
+	apiKey := request.Headers["x-api-key"]
+	if apiKey == "" {
+		apiKey = request.Headers["X-API-Key"]
+	}
+	if !auth.ValidateAPIKey(ctx, dynamoClient, apiKey) {
+		log.Printf("Unauthorized: invalid API key")
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"UNAUTHORIZED","message":"Invalid or missing API key"}`,
+		}, nil
+	}
+
+	var (
+		response types.HistoryResponse
+		input    *dynamodb.QueryInput
+	)
+
+	switch request.RouteKey {
+	case "GET /history/users/{user}":
+		response.User = strings.TrimSpace(request.PathParameters["user"])
+		if response.User == "" {
+			return errorResponse(400, "User is required"), nil
+		}
+		input = userHistoryQuery(response.User)
+	case "GET /history/countries/{iso3}":
+		response.ISO3 = strings.ToUpper(strings.TrimSpace(request.PathParameters["iso3"]))
+		if !mapping.IsKnownISO(response.ISO3) {
+			return errorResponse(400, "Invalid ISO3 code"), nil
+		}
+		input = countryHistoryQuery(response.ISO3)
+	default:
+		return errorResponse(404, "Not found"), nil
+	}
+
+	history, err := queryHistory(ctx, input)
+	if err != nil {
+		log.Printf("Error querying history: %v", err)
+		return errorResponse(500, "Error fetching data"), nil
+	}
+
+	sortChronologically(history)
+	response.History = history
+	response.Total = len(history)
+
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return errorResponse(500, "Error building response"), nil
+	}
+
+	log.Printf("Returning %d history records", response.Total)
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(responseBody),
+	}, nil
+}
+
+// userHistoryQuery reads a user's records through the GSI UserIndex,
+// restricted to HISTORY# partitions.
+func userHistoryQuery(user string) *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		TableName:              &tableName,
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("#user = :user AND begins_with(PK, :pk)"),
+		ExpressionAttributeNames: map[string]string{
+			"#user": "user",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":user": &ddbTypes.AttributeValueMemberS{Value: user},
+			":pk":   &ddbTypes.AttributeValueMemberS{Value: types.HistoryPartitionPrefix},
+		},
+	}
+}
+
+// countryHistoryQuery reads the history partition of a country.
+func countryHistoryQuery(iso3 string) *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		TableName:              &tableName,
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":pk": &ddbTypes.AttributeValueMemberS{Value: types.HistoryPartition(iso3)},
+		},
+	}
+}
+
+// queryHistory runs the query to the end (all pages).
+func queryHistory(ctx context.Context, input *dynamodb.QueryInput) ([]types.HistoryItem, error) {
+	history := []types.HistoryItem{}
+
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []types.HistoryItem
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, err
+		}
+		history = append(history, page...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return history, nil
+}
+
+// sortChronologically orders records by timestamp, oldest first. UserIndex
+// results are ordered by country, so user history must always be re-sorted.
+func sortChronologically(history []types.HistoryItem) {
+	sort.SliceStable(history, func(i, j int) bool {
+		if history[i].Timestamp != history[j].Timestamp {
+			return history[i].Timestamp < history[j].Timestamp
+		}
+		return history[i].SK < history[j].SK
+	})
+}
+
+func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	body, err := json.Marshal(map[string]string{
+		"error": message,
+	})
+	if err != nil {
+		log.Printf("ERROR marshaling error response: %v", err)
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 500,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"INTERNAL_ERROR"}`,
+		}
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(body),
+	}
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+func TestSortChronologically(t *testing.T) {
+	history := []types.HistoryItem{
+		{ISO3: "BRA", Timestamp: "2026-02-01T10:00:00.000000000Z", SK: "b"},
+		{ISO3: "ARG", Timestamp: "2026-03-01T10:00:00.000000000Z", SK: "c"},
+		{ISO3: "CHL", Timestamp: "2026-01-01T10:00:00.000000000Z", SK: "a"},
+		{ISO3: "PER", Timestamp: "2026-02-01T10:00:00.000000000Z", SK: "a"}, // same webhook, ordered by SK
+	}
+
+	sortChronologically(history)
+
+	want := []string{"CHL", "PER", "BRA", "ARG"}
+	for i, iso3 := range want {
+		if history[i].ISO3 != iso3 {
+			t.Errorf("position %d: expected %s, got %s", i, iso3, history[i].ISO3)
+		}
+	}
+}
+
+func TestUserHistoryQuery(t *testing.T) {
+	input := userHistoryQuery("Maria")
+
+	if aws.ToString(input.IndexName) != "UserIndex" {
+		t.Errorf("expected UserIndex, got %s", aws.ToString(input.IndexName))
+	}
+	pk := input.ExpressionAttributeValues[":pk"].(*ddbTypes.AttributeValueMemberS).Value
+	if pk != types.HistoryPartitionPrefix {
+		t.Errorf("expected only history partitions, got %s", pk)
+	}
+}
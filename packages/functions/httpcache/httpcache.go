@@ -0,0 +1,166 @@
+// Package httpcache implements conditional GET for the read endpoints.
+//
+// Writers bump a version marker (types.DataVersionItem) on every change of the
+// data served by the API. A read handler loads the marker (a single GetItem),
+// derives the ETag from it and the request, and answers If-None-Match or
+// If-Modified-Since with 304 without reading the partitions.
+package httpcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// CacheControl lets clients keep the response but revalidate it on every use.
+const CacheControl = "no-cache"
+
+// DynamoDBGetItemAPI defines the interface for reading the version marker.
+type DynamoDBGetItemAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+// DynamoDBUpdateItemAPI defines the interface for bumping the version marker.
+type DynamoDBUpdateItemAPI interface {
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
+// Validator is the cache validator of a response: its ETag and Last-Modified.
+type Validator struct {
+	ETag         string
+	LastModified time.Time
+}
+
+// Bump increments the version marker. Call it after every successful write
+// of data served by the read endpoints.
+func Bump(ctx context.Context, client DynamoDBUpdateItemAPI, tableName string) error {
+	pk, sk := types.DataVersionKey()
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pk},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: sk},
+		},
+		UpdateExpression: aws.String("ADD version :one SET updatedAt = :now"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":one": &ddbTypes.AttributeValueMemberN{Value: "1"},
+			":now": &ddbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	return err
+}
+
+// Load reads the version marker and returns the validator of a response built
+// from the data at that version for the given request parts (route, query
+// parameters). It returns false when there is no marker yet, in which case
+// the response must not be cached.
+func Load(ctx context.Context, client DynamoDBGetItemAPI, tableName string, parts ...string) (Validator, bool, error) {
+	pk, sk := types.DataVersionKey()
+	result, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pk},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: sk},
+		},
+	})
+	if err != nil {
+		return Validator{}, false, err
+	}
+	if result.Item == nil {
+		return Validator{}, false, nil
+	}
+
+	var marker types.DataVersionItem
+	if err := attributevalue.UnmarshalMap(result.Item, &marker); err != nil {
+		return Validator{}, false, err
+	}
+	lastModified, _ := time.Parse(time.RFC3339, marker.UpdatedAt)
+
+	return Validator{
+		ETag:         ETag(marker.Version, parts...),
+		LastModified: lastModified,
+	}, true, nil
+}
+
+// ETag returns a strong entity tag for a data version and request parts.
+func ETag(version int64, parts ...string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s", version, strings.Join(parts, "|"))))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// QueryKey returns the query parameters in a stable order, to be used as an
+// ETag part.
+func QueryKey(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+params[key])
+	}
+	return strings.Join(pairs, "&")
+}
+
+// NotModified reports whether the request already holds the current response.
+// If-None-Match takes precedence over If-Modified-Since, as in RFC 9110.
+func (v Validator) NotModified(headers map[string]string) bool {
+	if match := header(headers, "If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == v.ETag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := header(headers, "If-Modified-Since"); since != "" && !v.LastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !v.LastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// Apply adds the validator and Cache-Control to the response headers.
+func (v Validator) Apply(headers map[string]string) {
+	headers["ETag"] = v.ETag
+	headers["Cache-Control"] = CacheControl
+	if !v.LastModified.IsZero() {
+		headers["Last-Modified"] = v.LastModified.UTC().Format(http.TimeFormat)
+	}
+}
+
+// NotModifiedResponse returns the 304 answer to a conditional request.
+func (v Validator) NotModifiedResponse() events.APIGatewayV2HTTPResponse {
+	headers := map[string]string{
+		"Access-Control-Allow-Origin": "*",
+	}
+	v.Apply(headers)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusNotModified,
+		Headers:    headers,
+	}
+}
+
+// header returns a request header; API Gateway lowercases header names.
+func header(headers map[string]string, name string) string {
+	if value, ok := headers[strings.ToLower(name)]; ok {
+		return value
+	}
+	return headers[name]
+}
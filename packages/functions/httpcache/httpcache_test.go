@@ -0,0 +1,84 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/mundotalendo/functions/types"
+)
+
+// MockDynamoDBClient implements DynamoDBGetItemAPI for testing
+type MockDynamoDBClient struct {
+	Item *types.DataVersionItem
+}
+
+func (m *MockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.Item == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	item, err := attributevalue.MarshalMap(m.Item)
+	return &dynamodb.GetItemOutput{Item: item}, err
+}
+
+func TestLoad(t *testing.T) {
+	if _, ok, err := Load(context.Background(), &MockDynamoDBClient{}, "test-table", "/stats"); ok || err != nil {
+		t.Errorf("expected no validator without a marker, got ok=%v err=%v", ok, err)
+	}
+
+	client := &MockDynamoDBClient{Item: &types.DataVersionItem{Version: 7, UpdatedAt: "2026-03-01T12:00:00Z"}}
+	v, ok, err := Load(context.Background(), client, "test-table", "/stats", "mes=3")
+	if !ok || err != nil {
+		t.Fatalf("expected a validator, got ok=%v err=%v", ok, err)
+	}
+	if v.ETag != ETag(7, "/stats", "mes=3") || v.ETag == ETag(7, "/stats", "mes=4") || v.ETag == ETag(8, "/stats", "mes=3") {
+		t.Errorf("expected the ETag to depend on the version and the request, got %s", v.ETag)
+	}
+	if !v.LastModified.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected Last-Modified %v", v.LastModified)
+	}
+}
+
+func TestValidator_NotModified(t *testing.T) {
+	v := Validator{ETag: ETag(3, "/stats"), LastModified: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"no conditional headers", map[string]string{}, false},
+		{"matching ETag", map[string]string{"if-none-match": v.ETag}, true},
+		{"weak matching ETag in a list", map[string]string{"if-none-match": `"other", W/` + v.ETag}, true},
+		{"stale ETag", map[string]string{"if-none-match": ETag(2, "/stats")}, false},
+		{"wildcard", map[string]string{"If-None-Match": "*"}, true},
+		{"modified since", map[string]string{"if-modified-since": v.LastModified.Add(-time.Minute).Format(http.TimeFormat)}, false},
+		{"not modified since", map[string]string{"if-modified-since": v.LastModified.Format(http.TimeFormat)}, true},
+		{"ETag takes precedence", map[string]string{"if-none-match": `"other"`, "if-modified-since": v.LastModified.Format(http.TimeFormat)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.NotModified(tt.headers); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	response := v.NotModifiedResponse()
+	if response.StatusCode != http.StatusNotModified || response.Body != "" || response.Headers["ETag"] != v.ETag {
+		t.Errorf("unexpected 304 response: %+v", response)
+	}
+	if response.Headers["Last-Modified"] != "Sun, 01 Mar 2026 12:00:00 GMT" || response.Headers["Cache-Control"] != CacheControl {
+		t.Errorf("unexpected cache headers: %v", response.Headers)
+	}
+}
+
+func TestQueryKey(t *testing.T) {
+	if got := QueryKey(map[string]string{"user": "Ana", "mes": "3"}); got != "mes=3&user=Ana" {
+		t.Errorf("expected parameters in a stable order, got %s", got)
+	}
+}
@@ -0,0 +1,352 @@
+// Package main implements the leaderboard endpoint.
+//
+// GET /leaderboard ranks the participants by countries completed, then
+// countries started, months fully completed and distinct continents. It reads
+// the country aggregates (AGGREGATE#COUNTRY), which keep each user's progress
+// per country and categoria. Optional parameters: mes (month number 1-12, only
+// readings of that month), limit and offset.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/calendar"
+	"github.com/mundotalendo/functions/httpcache"
+	"github.com/mundotalendo/functions/mapping"
+	"github.com/mundotalendo/functions/types"
+)
+
+// Page size of the leaderboard.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var (
+	dynamoClient *dynamodb.Client
+	tableName    string
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("SST_Resource_DataTable_name")
+}
+
+func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	log.Printf("Leaderboard request: %v", request.QueryStringParameters)
+
+	// Validate API key
+	apiKey := request.Headers["x-api-key"]
+	if apiKey == "" {
+		apiKey = request.Headers["X-API-Key"]
+	}
+	if !auth.ValidateAPIKey(ctx, dynamoClient, apiKey) {
+		log.Printf("Unauthorized: invalid API key")
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"UNAUTHORIZED","message":"Invalid or missing API key"}`,
+		}, nil
+	}
+
+	params, err := parseParams(request.QueryStringParameters)
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+
+	// Conditional GET: the data version marker tells whether the client's copy
+	// is current, without reading the partitions
+	validator, cacheable, err := httpcache.Load(ctx, dynamoClient, tableName, "/leaderboard", httpcache.QueryKey(request.QueryStringParameters))
+	if err != nil {
+		log.Printf("WARN: Failed to load data version: %v", err)
+	}
+	if cacheable && validator.NotModified(request.Headers) {
+		log.Printf("Not modified: %s", validator.ETag)
+		return validator.NotModifiedResponse(), nil
+	}
+
+	aggregates, err := queryAggregates(ctx)
+	if err != nil {
+		log.Printf("Error querying DynamoDB: %v", err)
+		return errorResponse(500, "Error fetching data"), nil
+	}
+
+	ranking := rank(userScores(aggregates, params.month))
+	response := types.LeaderboardResponse{
+		Users:  page(ranking, params.offset, params.limit),
+		Total:  len(ranking),
+		Offset: params.offset,
+		Limit:  params.limit,
+	}
+	if next := params.offset + params.limit; next < len(ranking) {
+		response.NextOffset = next
+	}
+
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return errorResponse(500, "Error building response"), nil
+	}
+
+	log.Printf("Returning %d of %d ranked users", len(response.Users), response.Total)
+
+	headers := map[string]string{
+		"Content-Type":                "application/json",
+		"Access-Control-Allow-Origin": "*",
+	}
+	if cacheable {
+		validator.Apply(headers)
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    headers,
+		Body:       string(responseBody),
+	}, nil
+}
+
+// leaderboardParams are the query parameters of GET /leaderboard.
+type leaderboardParams struct {
+	month  int // only readings whose categoria is this month (0 for all)
+	limit  int
+	offset int
+}
+
+// parseParams validates mes, limit and offset.
+func parseParams(query map[string]string) (leaderboardParams, error) {
+	params := leaderboardParams{limit: DefaultLimit}
+
+	if mes := strings.TrimSpace(query["mes"]); mes != "" {
+		n, err := strconv.Atoi(mes)
+		if _, ok := calendar.ByNumber(n); err != nil || !ok {
+			return leaderboardParams{}, errors.New("Invalid mes, expected a month number from 1 to 12")
+		}
+		params.month = n
+	}
+	if limit := strings.TrimSpace(query["limit"]); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return leaderboardParams{}, errors.New("Invalid limit, expected a number from 1 to 100")
+		}
+		params.limit = n
+	}
+	if offset := strings.TrimSpace(query["offset"]); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return leaderboardParams{}, errors.New("Invalid offset, expected a number from 0")
+		}
+		params.offset = n
+	}
+
+	return params, nil
+}
+
+// queryAggregates reads the country aggregates (all pages).
+func queryAggregates(ctx context.Context) ([]types.CountryAggregateItem, error) {
+	var aggregates []types.CountryAggregateItem
+	var lastKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              &tableName,
+			KeyConditionExpression: aws.String("PK = :pk"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk": &ddbTypes.AttributeValueMemberS{Value: types.CountryAggregatePartition},
+			},
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var page []types.CountryAggregateItem
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, err
+		}
+		aggregates = append(aggregates, page...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+
+	return aggregates, nil
+}
+
+// userScores computes the leaderboard metrics of every user with at least
+// one country started. With a month, only the categorias of that month count.
+func userScores(aggregates []types.CountryAggregateItem, month int) []types.LeaderboardEntry {
+	type userReadings struct {
+		started    int
+		completed  int
+		continents map[string]bool
+		months     map[int]map[string]int // month -> ISO3 -> best progress
+	}
+	users := make(map[string]*userReadings)
+
+	for _, aggregate := range aggregates {
+		for user, contribution := range aggregate.Users {
+			progress := contribution.Progresso
+			if month != 0 {
+				progress = 0
+				for categoria, p := range contribution.Categorias {
+					if calendar.ParseCategory(categoria) == month {
+						progress = max(progress, p)
+					}
+				}
+			}
+			u, exists := users[user]
+			if !exists {
+				u = &userReadings{continents: make(map[string]bool), months: make(map[int]map[string]int)}
+				users[user] = u
+			}
+
+			// A month is fully completed when every country of it is at 100%,
+			// including the ones not started
+			for categoria, p := range contribution.Categorias {
+				mes := calendar.ParseCategory(categoria)
+				if mes == 0 || (month != 0 && mes != month) {
+					continue
+				}
+				if u.months[mes] == nil {
+					u.months[mes] = make(map[string]int)
+				}
+				u.months[mes][aggregate.ISO3] = max(u.months[mes][aggregate.ISO3], p)
+			}
+
+			if progress <= 0 {
+				continue
+			}
+			u.started++
+			if progress == 100 {
+				u.completed++
+			}
+			if continent := mapping.Continent(aggregate.ISO3); continent != "" {
+				u.continents[continent] = true
+			}
+		}
+	}
+
+	entries := make([]types.LeaderboardEntry, 0, len(users))
+	for user, u := range users {
+		if u.started == 0 {
+			continue
+		}
+		monthsCompleted := 0
+		for _, countries := range u.months {
+			if calendar.MonthComplete(countries) {
+				monthsCompleted++
+			}
+		}
+		entries = append(entries, types.LeaderboardEntry{
+			User:            user,
+			Completed:       u.completed,
+			Started:         u.started,
+			MonthsCompleted: monthsCompleted,
+			Continents:      len(u.continents),
+		})
+	}
+	return entries
+}
+
+// rank sorts the entries by completed, started, months completed and
+// continents (ties by user name) and sets their rank. Users tied on every
+// metric share the rank.
+func rank(entries []types.LeaderboardEntry) []types.LeaderboardEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !sameScore(a, b) {
+			return better(a, b)
+		}
+		return a.User < b.User
+	})
+
+	for i := range entries {
+		if i > 0 && sameScore(entries[i], entries[i-1]) {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
+		}
+	}
+	return entries
+}
+
+// better reports whether a ranks above b.
+func better(a, b types.LeaderboardEntry) bool {
+	if a.Completed != b.Completed {
+		return a.Completed > b.Completed
+	}
+	if a.Started != b.Started {
+		return a.Started > b.Started
+	}
+	if a.MonthsCompleted != b.MonthsCompleted {
+		return a.MonthsCompleted > b.MonthsCompleted
+	}
+	return a.Continents > b.Continents
+}
+
+// sameScore reports whether a and b tie on every metric.
+func sameScore(a, b types.LeaderboardEntry) bool {
+	return a.Completed == b.Completed && a.Started == b.Started &&
+		a.MonthsCompleted == b.MonthsCompleted && a.Continents == b.Continents
+}
+
+// page returns the entries from offset, at most limit.
+func page(entries []types.LeaderboardEntry, offset, limit int) []types.LeaderboardEntry {
+	if offset >= len(entries) {
+		return []types.LeaderboardEntry{}
+	}
+	return entries[offset:min(offset+limit, len(entries))]
+}
+
+func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	body, err := json.Marshal(map[string]string{
+		"error": message,
+	})
+	if err != nil {
+		log.Printf("ERROR marshaling error response: %v", err)
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 500,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"INTERNAL_ERROR"}`,
+		}
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(body),
+	}
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mundotalendo/functions/types"
+)
+
+func TestUserScoresAndRank(t *testing.T) {
+	aggregates := []types.CountryAggregateItem{
+		{ISO3: "CHL", Users: map[string]types.CountryContribution{
+			"Maria": {Progresso: 100, Categorias: map[string]int{"Janeiro": 100}},
+			"Ana":   {Progresso: 100, Categorias: map[string]int{"Janeiro": 100}},
+			"Rita":  {Progresso: 0, Categorias: map[string]int{"Janeiro": 0}},
+		}},
+		{ISO3: "PRT", Users: map[string]types.CountryContribution{
+			"Maria": {Progresso: 100, Categorias: map[string]int{"Março": 100}},
+			"Ana":   {Progresso: 40, Categorias: map[string]int{"Março": 40}},
+		}},
+		{ISO3: "JPN", Users: map[string]types.CountryContribution{
+			"Bia": {Progresso: 100, Categorias: map[string]int{"Março": 100}},
+			"Ana": {Progresso: 0, Categorias: map[string]int{"Janeiro": 0}},
+		}},
+	}
+
+	ranking := rank(userScores(aggregates, 0))
+	if len(ranking) != 3 {
+		t.Fatalf("expected 3 ranked users (Rita started nothing), got %+v", ranking)
+	}
+
+	maria, ana, bia := ranking[0], ranking[1], ranking[2]
+	if maria.User != "Maria" || maria.Rank != 1 || maria.Completed != 2 || maria.MonthsCompleted != 2 || maria.Continents != 2 {
+		t.Errorf("unexpected first place: %+v", maria)
+	}
+	// Ana's January has a reading not started, so no month is fully completed
+	if ana.User != "Ana" || ana.Rank != 2 || ana.Completed != 1 || ana.Started != 2 || ana.MonthsCompleted != 0 {
+		t.Errorf("unexpected second place: %+v", ana)
+	}
+	if bia.User != "Bia" || bia.Rank != 3 || bia.MonthsCompleted != 1 || bia.Continents != 1 {
+		t.Errorf("unexpected third place: %+v", bia)
+	}
+
+	march := rank(userScores(aggregates, 3))
+	if len(march) != 3 || march[0].Rank != 1 || march[1].Rank != 1 || march[2].User != "Ana" || march[2].Rank != 3 {
+		t.Errorf("expected Bia and Maria tied first in March, then Ana: %+v", march)
+	}
+}
+
+func TestParseParamsAndPage(t *testing.T) {
+	params, err := parseParams(map[string]string{"mes": "3", "limit": "2", "offset": "1"})
+	if err != nil || params.month != 3 || params.limit != 2 || params.offset != 1 {
+		t.Errorf("unexpected params %+v (err %v)", params, err)
+	}
+	if params, _ := parseParams(map[string]string{}); params.limit != DefaultLimit {
+		t.Errorf("expected default limit %d, got %d", DefaultLimit, params.limit)
+	}
+	for _, query := range []map[string]string{{"mes": "13"}, {"limit": "0"}, {"limit": "101"}, {"offset": "-1"}} {
+		if _, err := parseParams(query); err == nil {
+			t.Errorf("expected an error for %v", query)
+		}
+	}
+
+	entries := []types.LeaderboardEntry{{User: "a"}, {User: "b"}, {User: "c"}}
+	if got := page(entries, 1, 5); len(got) != 2 || got[0].User != "b" {
+		t.Errorf("unexpected page %+v", got)
+	}
+	if got := page(entries, 3, 5); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty page past the end, got %+v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package mapping
+
+// Continents of the ISO codes in NameToIso. Central America and the Caribbean
+// count as North America; transcontinental countries follow their capital
+// (Russia in Europe, Turkey and the Caucasus in Asia, Egypt in Africa).
+const (
+	ContinentAfrica       = "África"
+	ContinentNorthAmerica = "América do Norte"
+	ContinentSouthAmerica = "América do Sul"
+	ContinentAsia         = "Ásia"
+	ContinentEurope       = "Europa"
+	ContinentOceania      = "Oceania"
+)
+
+// isoContinent maps ISO 3166-1 Alpha-3 codes to their continent
+var isoContinent = map[string]string{
+	// África
+	"AGO": ContinentAfrica, "BDI": ContinentAfrica, "BEN": ContinentAfrica, "BFA": ContinentAfrica,
+	"BWA": ContinentAfrica, "CAF": ContinentAfrica, "CIV": ContinentAfrica, "CMR": ContinentAfrica,
+	"COD": ContinentAfrica, "COG": ContinentAfrica, "COM": ContinentAfrica, "CPV": ContinentAfrica,
+	"DJI": ContinentAfrica, "DZA": ContinentAfrica, "EGY": ContinentAfrica, "ERI": ContinentAfrica,
+	"ESH": ContinentAfrica, "ETH": ContinentAfrica, "GAB": ContinentAfrica, "GHA": ContinentAfrica,
+	"GIN": ContinentAfrica, "GMB": ContinentAfrica, "GNB": ContinentAfrica, "GNQ": ContinentAfrica,
+	"KEN": ContinentAfrica, "LBR": ContinentAfrica, "LBY": ContinentAfrica, "LSO": ContinentAfrica,
+	"MAR": ContinentAfrica, "MDG": ContinentAfrica, "MLI": ContinentAfrica, "MOZ": ContinentAfrica,
+	"MRT": ContinentAfrica, "MUS": ContinentAfrica, "MWI": ContinentAfrica, "NAM": ContinentAfrica,
+	"NER": ContinentAfrica, "NGA": ContinentAfrica, "RWA": ContinentAfrica, "SDN": ContinentAfrica,
+	"SEN": ContinentAfrica, "SLE": ContinentAfrica, "SOM": ContinentAfrica, "SSD": ContinentAfrica,
+	"STP": ContinentAfrica, "SWZ": ContinentAfrica, "SYC": ContinentAfrica, "TCD": ContinentAfrica,
+	"TGO": ContinentAfrica, "TUN": ContinentAfrica, "TZA": ContinentAfrica, "UGA": ContinentAfrica,
+	"ZAF": ContinentAfrica, "ZMB": ContinentAfrica, "ZWE": ContinentAfrica,
+	// América do Norte
+	"ATG": ContinentNorthAmerica, "BHS": ContinentNorthAmerica, "BLZ": ContinentNorthAmerica, "BRB": ContinentNorthAmerica,
+	"CAN": ContinentNorthAmerica, "CRI": ContinentNorthAmerica, "CUB": ContinentNorthAmerica, "DMA": ContinentNorthAmerica,
+	"DOM": ContinentNorthAmerica, "GRD": ContinentNorthAmerica, "GRL": ContinentNorthAmerica, "GTM": ContinentNorthAmerica,
+	"HND": ContinentNorthAmerica, "HTI": ContinentNorthAmerica, "JAM": ContinentNorthAmerica, "KNA": ContinentNorthAmerica,
+	"LCA": ContinentNorthAmerica, "MEX": ContinentNorthAmerica, "MSR": ContinentNorthAmerica, "NIC": ContinentNorthAmerica,
+	"PAN": ContinentNorthAmerica, "PRI": ContinentNorthAmerica, "SLV": ContinentNorthAmerica, "TTO": ContinentNorthAmerica,
+	"USA": ContinentNorthAmerica, "VCT": ContinentNorthAmerica,
+	// América do Sul
+	"ARG": ContinentSouthAmerica, "BOL": ContinentSouthAmerica, "BRA": ContinentSouthAmerica, "CHL": ContinentSouthAmerica,
+	"COL": ContinentSouthAmerica, "ECU": ContinentSouthAmerica, "GUF": ContinentSouthAmerica, "GUY": ContinentSouthAmerica,
+	"PER": ContinentSouthAmerica, "PRY": ContinentSouthAmerica, "SUR": ContinentSouthAmerica, "URY": ContinentSouthAmerica,
+	"VEN": ContinentSouthAmerica,
+	// Ásia
+	"AFG": ContinentAsia, "ARE": ContinentAsia, "ARM": ContinentAsia, "AZE": ContinentAsia,
+	"BGD": ContinentAsia, "BHR": ContinentAsia, "BRN": ContinentAsia, "BTN": ContinentAsia,
+	"CHN": ContinentAsia, "GEO": ContinentAsia, "IDN": ContinentAsia, "IND": ContinentAsia,
+	"IRN": ContinentAsia, "IRQ": ContinentAsia, "ISR": ContinentAsia, "JOR": ContinentAsia,
+	"JPN": ContinentAsia, "KAZ": ContinentAsia, "KGZ": ContinentAsia, "KHM": ContinentAsia,
+	"KOR": ContinentAsia, "KWT": ContinentAsia, "LAO": ContinentAsia, "LBN": ContinentAsia,
+	"LKA": ContinentAsia, "MDV": ContinentAsia, "MMR": ContinentAsia, "MNG": ContinentAsia,
+	"MYS": ContinentAsia, "NPL": ContinentAsia, "OMN": ContinentAsia, "PAK": ContinentAsia,
+	"PHL": ContinentAsia, "PRK": ContinentAsia, "PSE": ContinentAsia, "QAT": ContinentAsia,
+	"SAU": ContinentAsia, "SGP": ContinentAsia, "SYR": ContinentAsia, "THA": ContinentAsia,
+	"TJK": ContinentAsia, "TKM": ContinentAsia, "TLS": ContinentAsia, "TUR": ContinentAsia,
+	"TWN": ContinentAsia, "UZB": ContinentAsia, "VNM": ContinentAsia, "YEM": ContinentAsia,
+	// Europa
+	"ALB": ContinentEurope, "AND": ContinentEurope, "AUT": ContinentEurope, "BEL": ContinentEurope,
+	"BGR": ContinentEurope, "BIH": ContinentEurope, "BLR": ContinentEurope, "CHE": ContinentEurope,
+	"CYP": ContinentEurope, "CZE": ContinentEurope, "DEU": ContinentEurope, "DNK": ContinentEurope,
+	"ESP": ContinentEurope, "EST": ContinentEurope, "FIN": ContinentEurope, "FRA": ContinentEurope,
+	"GBR": ContinentEurope, "GRC": ContinentEurope, "HRV": ContinentEurope, "HUN": ContinentEurope,
+	"IRL": ContinentEurope, "ISL": ContinentEurope, "ITA": ContinentEurope, "LIE": ContinentEurope,
+	"LTU": ContinentEurope, "LUX": ContinentEurope, "LVA": ContinentEurope, "MCO": ContinentEurope,
+	"MDA": ContinentEurope, "MKD": ContinentEurope, "MLT": ContinentEurope, "MNE": ContinentEurope,
+	"NLD": ContinentEurope, "NOR": ContinentEurope, "POL": ContinentEurope, "PRT": ContinentEurope,
+	"ROU": ContinentEurope, "RUS": ContinentEurope, "SMR": ContinentEurope, "SRB": ContinentEurope,
+	"SVK": ContinentEurope, "SVN": ContinentEurope, "SWE": ContinentEurope, "UKR": ContinentEurope,
+	"VAT": ContinentEurope,
+	// Oceania
+	"AUS": ContinentOceania, "FJI": ContinentOceania, "FSM": ContinentOceania, "KIR": ContinentOceania,
+	"MHL": ContinentOceania, "NRU": ContinentOceania, "NZL": ContinentOceania, "PLW": ContinentOceania,
+	"PNG": ContinentOceania, "SLB": ContinentOceania, "TON": ContinentOceania, "TUV": ContinentOceania,
+	"VUT": ContinentOceania, "WSM": ContinentOceania,
+}
+
+// Continent returns the continent of an ISO code, or empty string if unknown
+func Continent(iso3 string) string {
+	return isoContinent[iso3]
+}
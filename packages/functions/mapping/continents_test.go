@@ -0,0 +1,18 @@
+package mapping
+
+import "testing"
+
+func TestContinent_EveryMappedISO(t *testing.T) {
+	for name, iso := range NameToIso {
+		if Continent(iso) == "" {
+			t.Errorf("%s (%s) has no continent", name, iso)
+		}
+	}
+
+	if got := Continent("BRA"); got != ContinentSouthAmerica {
+		t.Errorf("expected BRA in %s, got %s", ContinentSouthAmerica, got)
+	}
+	if got := Continent("XXX"); got != "" {
+		t.Errorf("expected no continent for an unknown ISO, got %s", got)
+	}
+}
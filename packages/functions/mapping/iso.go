@@ -224,3 +224,32 @@ func GetISO(countryName string) string {
 	}
 	return ""
 }
+
+// IsKnownISO returns true if the ISO code is the target of at least one NameToIso entry
+func IsKnownISO(iso3 string) bool {
+	for _, iso := range NameToIso {
+		if iso == iso3 {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver maps country names using NameToIso plus aliases registered at runtime.
+// Built-in names always take precedence over aliases.
+type Resolver struct {
+	aliases map[string]string
+}
+
+// NewResolver creates a Resolver with the given alias -> ISO3 map (may be nil)
+func NewResolver(aliases map[string]string) *Resolver {
+	return &Resolver{aliases: aliases}
+}
+
+// GetISO returns the ISO code for a country name or alias, or empty string if not found
+func (r *Resolver) GetISO(countryName string) string {
+	if iso := GetISO(countryName); iso != "" {
+		return iso
+	}
+	return r.aliases[countryName]
+}
@@ -269,6 +269,46 @@ func TestNameToIso_NoISOCollisions(t *testing.T) {
 	}
 }
 
+func TestIsKnownISO(t *testing.T) {
+	for _, iso := range []string{"BRA", "GBR", "USA"} {
+		if !IsKnownISO(iso) {
+			t.Errorf("Expected %s to be known", iso)
+		}
+	}
+	for _, iso := range []string{"", "XXX", "bra"} {
+		if IsKnownISO(iso) {
+			t.Errorf("Expected %q to be unknown", iso)
+		}
+	}
+}
+
+func TestResolver_GetISO(t *testing.T) {
+	resolver := NewResolver(map[string]string{
+		"Brasiu":  "BRA",
+		"Japão":   "KOR", // built-in names win over aliases
+	})
+
+	tests := []struct {
+		countryName string
+		expectedISO string
+	}{
+		{"Brasil", "BRA"},
+		{"Brasiu", "BRA"},
+		{"Japão", "JPN"},
+		{"País Inexistente", ""},
+	}
+
+	for _, tt := range tests {
+		if got := resolver.GetISO(tt.countryName); got != tt.expectedISO {
+			t.Errorf("GetISO(%q) = %q, want %q", tt.countryName, got, tt.expectedISO)
+		}
+	}
+
+	if got := NewResolver(nil).GetISO("Brasiu"); got != "" {
+		t.Errorf("Expected empty string without aliases, got %s", got)
+	}
+}
+
 func BenchmarkGetISO(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		GetISO("Brasil")
@@ -4,9 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
-	"sort"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -17,6 +17,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 
+	"github.com/mundotalendo/functions/httpcache"
+	"github.com/mundotalendo/functions/mapping"
 	sharedTypes "github.com/mundotalendo/functions/types"
 )
 
@@ -26,15 +28,23 @@ type ReadingResponse struct {
 	AvatarURL string `json:"avatarURL"`
 	CapaURL   string `json:"capaURL"`
 	Livro     string `json:"livro"`
+	Autor     string `json:"autor,omitempty"`
 	Progresso int    `json:"progresso"`
 	Categoria string `json:"categoria"`
+	Mes       int    `json:"mes,omitempty"`
 	UpdatedAt string `json:"updatedAt"`
+
+	Avaliacao  int    `json:"avaliacao,omitempty"`
+	Comentario string `json:"comentario,omitempty"`
+	DiaMarcado string `json:"diaMarcado,omitempty"`
 }
 
-// Response - API response with all readings
+// Response - API response with a page of readings. Total counts every
+// reading of the country; nextCursor is set while there are more pages.
 type Response struct {
-	Readings []ReadingResponse `json:"readings"`
-	Total    int               `json:"total"`
+	Readings   []ReadingResponse `json:"readings"`
+	Total      int               `json:"total"`
+	NextCursor string            `json:"nextCursor,omitempty"`
 }
 
 func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
@@ -45,6 +55,14 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 	if len(iso3) != 3 || !isAlpha(iso3) {
 		return errorResponse(http.StatusBadRequest, "Invalid ISO3 code format"), nil
 	}
+	if !mapping.IsKnownISO(iso3) {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Unknown ISO3 code: %s", iso3)), nil
+	}
+
+	params, err := parseParams(request.QueryStringParameters)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error()), nil
+	}
 
 	// Get table name from environment
 	tableName := os.Getenv("SST_Resource_DataTable_name")
@@ -59,80 +77,111 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 	}
 	client := dynamodb.NewFromConfig(cfg)
 
+	// Conditional GET: the data version marker tells whether the client's copy
+	// is current, without reading the partitions
+	validator, cacheable, err := httpcache.Load(ctx, client, tableName, "/readings/"+iso3, httpcache.QueryKey(request.QueryStringParameters))
+	if err != nil {
+		log.Printf("WARN: Failed to load data version: %v", err)
+	}
+	if cacheable && validator.NotModified(request.Headers) {
+		log.Printf("Not modified: %s", validator.ETag)
+		return validator.NotModifiedResponse(), nil
+	}
+
 	// Query DynamoDB for all readings in this country
 	readings, err := fetchReadings(ctx, client, tableName, iso3)
 	if err != nil {
 		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Database query failed: %v", err)), nil
 	}
 
-	// Transform and sort readings
-	response := buildResponse(readings)
+	// Sort, page and transform readings
+	response := buildResponse(readings, params)
 
 	// Return JSON response
 	body, _ := json.Marshal(response)
+	headers := map[string]string{
+		"Content-Type":                "application/json",
+		"Access-Control-Allow-Origin": "*",
+	}
+	if cacheable {
+		validator.Apply(headers)
+	}
+
 	return events.APIGatewayV2HTTPResponse{
 		StatusCode: http.StatusOK,
-		Headers: map[string]string{
-			"Content-Type":                "application/json",
-			"Access-Control-Allow-Origin": "*",
-		},
-		Body: string(body),
+		Headers:    headers,
+		Body:       string(body),
 	}, nil
 }
 
 func fetchReadings(ctx context.Context, client *dynamodb.Client, tableName, iso3 string) ([]sharedTypes.LeituraItem, error) {
-	// Query: PK = "EVENT#LEITURA" with filter on iso3 and progresso >= 1
-	input := &dynamodb.QueryInput{
+	var readings []sharedTypes.LeituraItem
+	var lastKey map[string]types.AttributeValue
+
+	for {
+		result, err := client.Query(ctx, readingsQuery(tableName, iso3, lastKey))
+		if err != nil {
+			return nil, err
+		}
+
+		var items []sharedTypes.LeituraItem
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &items); err != nil {
+			return nil, err
+		}
+		readings = append(readings, items...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+
+	return readings, nil
+}
+
+// readingsQuery reads one page of the country's live readings with
+// progresso >= 1 from the CountryIndex (countryKey + progresso), so only that
+// country's items are read instead of the whole EVENT#LEITURA partition.
+func readingsQuery(tableName, iso3 string, lastKey map[string]types.AttributeValue) *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
 		TableName:              aws.String(tableName),
-		KeyConditionExpression: aws.String("PK = :pk"),
-		FilterExpression:       aws.String("iso3 = :iso3 AND progresso >= :minProgress"),
+		IndexName:              aws.String("CountryIndex"),
+		KeyConditionExpression: aws.String("countryKey = :iso3 AND progresso >= :minProgress"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":pk":          &types.AttributeValueMemberS{Value: "EVENT#LEITURA"},
 			":iso3":        &types.AttributeValueMemberS{Value: iso3},
 			":minProgress": &types.AttributeValueMemberN{Value: "1"},
 		},
+		ExclusiveStartKey: lastKey,
 	}
-
-	result, err := client.Query(ctx, input)
-	if err != nil {
-		return nil, err
-	}
-
-	var readings []sharedTypes.LeituraItem
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &readings)
-	if err != nil {
-		return nil, err
-	}
-
-	return readings, nil
 }
 
-func buildResponse(readings []sharedTypes.LeituraItem) Response {
+func buildResponse(readings []sharedTypes.LeituraItem, params readingsParams) Response {
+	selected, next := page(readings, params)
+
 	// Transform to response format
-	responses := make([]ReadingResponse, 0, len(readings))
-	for _, r := range readings {
+	responses := make([]ReadingResponse, 0, len(selected))
+	for _, r := range selected {
 		responses = append(responses, ReadingResponse{
 			User:      r.User,
 			AvatarURL: r.ImagemURL,
 			CapaURL:   r.CapaURL,
 			Livro:     r.Livro,
+			Autor:     r.Autor,
 			Progresso: r.Progresso,
 			Categoria: r.Categoria,
+			Mes:       r.Mes,
 			UpdatedAt: r.UpdatedAt,
+
+			Avaliacao:  r.Avaliacao,
+			Comentario: r.Comentario,
+			DiaMarcado: r.DiaMarcado,
 		})
 	}
 
-	// Sort by: 1) Progresso DESC (completed first), 2) UpdatedAt DESC (newest first)
-	sort.Slice(responses, func(i, j int) bool {
-		if responses[i].Progresso != responses[j].Progresso {
-			return responses[i].Progresso > responses[j].Progresso
-		}
-		return responses[i].UpdatedAt > responses[j].UpdatedAt
-	})
-
 	return Response{
-		Readings: responses,
-		Total:    len(responses),
+		Readings:   responses,
+		Total:      len(readings),
+		NextCursor: next,
 	}
 }
 
@@ -3,6 +3,9 @@ package main
 import (
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
 	sharedTypes "github.com/mundotalendo/functions/types"
 )
 
@@ -13,7 +16,7 @@ func TestBuildResponse(t *testing.T) {
 		{User: "Charlie", Livro: "Book C", Progresso: 100, UpdatedAt: "2025-12-19T10:00:00Z"},
 	}
 
-	response := buildResponse(readings)
+	response := buildResponse(readings, readingsParams{sort: SortProgress})
 
 	if response.Total != 3 {
 		t.Errorf("Expected total 3, got %d", response.Total)
@@ -31,6 +34,25 @@ func TestBuildResponse(t *testing.T) {
 	}
 }
 
+func TestBuildResponseKeepsEveryBookOfAUser(t *testing.T) {
+	readings := []sharedTypes.LeituraItem{
+		{User: "Alice", Livro: "Kafka à Beira-Mar", Autor: "Haruki Murakami", Progresso: 100, UpdatedAt: "2026-01-10T00:00:00Z"},
+		{User: "Alice", Livro: "Kokoro", Autor: "Natsume Soseki", Progresso: 30, UpdatedAt: "2026-01-12T00:00:00Z", Avaliacao: 5, Comentario: "Lindo"},
+	}
+
+	response := buildResponse(readings, readingsParams{sort: SortProgress})
+
+	if response.Total != 2 {
+		t.Fatalf("Expected both books of Alice, got %d", response.Total)
+	}
+	if response.Readings[1].Livro != "Kokoro" || response.Readings[1].Autor != "Natsume Soseki" {
+		t.Errorf("Expected Kokoro by Natsume Soseki second, got %+v", response.Readings[1])
+	}
+	if response.Readings[1].Avaliacao != 5 || response.Readings[1].Comentario != "Lindo" {
+		t.Errorf("Expected rating and comment to be returned, got %+v", response.Readings[1])
+	}
+}
+
 func TestIsAlpha(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -57,7 +79,7 @@ func TestIsAlpha(t *testing.T) {
 
 func TestBuildResponseEmptyInput(t *testing.T) {
 	readings := []sharedTypes.LeituraItem{}
-	response := buildResponse(readings)
+	response := buildResponse(readings, readingsParams{sort: SortProgress})
 
 	if response.Total != 0 {
 		t.Errorf("Expected total 0, got %d", response.Total)
@@ -75,7 +97,7 @@ func TestBuildResponseSortingByProgressOnly(t *testing.T) {
 		{User: "Charlie", Livro: "Book C", Progresso: 50, UpdatedAt: "2025-12-19T10:00:00Z"},
 	}
 
-	response := buildResponse(readings)
+	response := buildResponse(readings, readingsParams{sort: SortProgress})
 
 	// Should be sorted by progress DESC
 	if response.Readings[0].Progresso != 80 {
@@ -88,3 +110,17 @@ func TestBuildResponseSortingByProgressOnly(t *testing.T) {
 		t.Errorf("Expected third reading with 30%%, got %d%%", response.Readings[2].Progresso)
 	}
 }
+
+func TestReadingsQueryUsesCountryIndex(t *testing.T) {
+	input := readingsQuery("test-table", "BRA", nil)
+
+	if aws.ToString(input.IndexName) != "CountryIndex" {
+		t.Errorf("Expected CountryIndex, got %s", aws.ToString(input.IndexName))
+	}
+	if input.FilterExpression != nil {
+		t.Errorf("Expected no filter, got %s", aws.ToString(input.FilterExpression))
+	}
+	if iso3 := input.ExpressionAttributeValues[":iso3"].(*types.AttributeValueMemberS).Value; iso3 != "BRA" {
+		t.Errorf("Expected countryKey BRA, got %s", iso3)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	sharedTypes "github.com/mundotalendo/functions/types"
+)
+
+// Sort options for /readings/{iso3}
+const (
+	SortProgress = "progress" // Progresso DESC, then most recent (default)
+	SortRecent   = "recent"   // UpdatedAt DESC
+	SortRating   = "rating"   // Avaliacao DESC, then progress order
+	SortUser     = "user"     // User name ASC, then most recent
+
+	MaxLimit = 100
+)
+
+// readingsParams - Sort and page requested through the query string.
+// limit 0 returns every reading from the cursor on.
+type readingsParams struct {
+	sort   string
+	limit  int
+	cursor *readingCursor
+}
+
+// readingCursor - Position of the last reading returned, encoded opaquely in
+// nextCursor. It carries every sort field plus the SK as tie-breaker, so the
+// next page starts right after it even if readings were written in between.
+type readingCursor struct {
+	Sort      string `json:"s"`
+	SK        string `json:"k"`
+	User      string `json:"u,omitempty"`
+	Progresso int    `json:"p,omitempty"`
+	Avaliacao int    `json:"a,omitempty"`
+	UpdatedAt string `json:"t,omitempty"`
+}
+
+func parseParams(query map[string]string) (readingsParams, error) {
+	params := readingsParams{sort: SortProgress}
+
+	if s := strings.ToLower(strings.TrimSpace(query["sort"])); s != "" {
+		switch s {
+		case SortProgress, SortRecent, SortRating, SortUser:
+			params.sort = s
+		default:
+			return readingsParams{}, errors.New("Invalid sort, expected progress, recent, rating or user")
+		}
+	}
+	if limit := strings.TrimSpace(query["limit"]); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return readingsParams{}, errors.New("Invalid limit, expected a number from 1 to 100")
+		}
+		params.limit = n
+	}
+	if cursor := strings.TrimSpace(query["cursor"]); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return readingsParams{}, errors.New("Invalid cursor")
+		}
+		if c.Sort != params.sort {
+			return readingsParams{}, errors.New("Cursor does not match the requested sort")
+		}
+		params.cursor = &c
+	}
+
+	return params, nil
+}
+
+func encodeCursor(c readingCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (readingCursor, error) {
+	var c readingCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	if c.SK == "" {
+		return c, errors.New("cursor without key")
+	}
+	return c, nil
+}
+
+func cursorOf(r sharedTypes.LeituraItem, sortBy string) readingCursor {
+	return readingCursor{
+		Sort:      sortBy,
+		SK:        r.SK,
+		User:      r.User,
+		Progresso: r.Progresso,
+		Avaliacao: r.Avaliacao,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
+
+// before reports whether a comes before b in the given sort. Ties are broken
+// by SK, which is unique within the partition, so the order is total.
+func before(a, b readingCursor, sortBy string) bool {
+	switch sortBy {
+	case SortRecent:
+		if a.UpdatedAt != b.UpdatedAt {
+			return a.UpdatedAt > b.UpdatedAt
+		}
+	case SortRating:
+		if a.Avaliacao != b.Avaliacao {
+			return a.Avaliacao > b.Avaliacao
+		}
+		if a.Progresso != b.Progresso {
+			return a.Progresso > b.Progresso
+		}
+		if a.UpdatedAt != b.UpdatedAt {
+			return a.UpdatedAt > b.UpdatedAt
+		}
+	case SortUser:
+		if ua, ub := strings.ToLower(a.User), strings.ToLower(b.User); ua != ub {
+			return ua < ub
+		}
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		if a.UpdatedAt != b.UpdatedAt {
+			return a.UpdatedAt > b.UpdatedAt
+		}
+	default:
+		if a.Progresso != b.Progresso {
+			return a.Progresso > b.Progresso
+		}
+		if a.UpdatedAt != b.UpdatedAt {
+			return a.UpdatedAt > b.UpdatedAt
+		}
+	}
+	return a.SK < b.SK
+}
+
+// page sorts the readings and returns the slice after the cursor, up to the
+// limit, with the cursor of the next page ("" on the last one).
+func page(readings []sharedTypes.LeituraItem, params readingsParams) ([]sharedTypes.LeituraItem, string) {
+	sorted := make([]sharedTypes.LeituraItem, len(readings))
+	copy(sorted, readings)
+	sort.Slice(sorted, func(i, j int) bool {
+		return before(cursorOf(sorted[i], params.sort), cursorOf(sorted[j], params.sort), params.sort)
+	})
+
+	start := 0
+	if params.cursor != nil {
+		start = sort.Search(len(sorted), func(i int) bool {
+			return before(*params.cursor, cursorOf(sorted[i], params.sort), params.sort)
+		})
+	}
+	end := len(sorted)
+	if params.limit > 0 && start+params.limit < end {
+		end = start + params.limit
+	}
+
+	next := ""
+	if end < len(sorted) {
+		next = encodeCursor(cursorOf(sorted[end-1], params.sort))
+	}
+	return sorted[start:end], next
+}
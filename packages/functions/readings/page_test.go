@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	sharedTypes "github.com/mundotalendo/functions/types"
+)
+
+func TestParseParams(t *testing.T) {
+	params, err := parseParams(nil)
+	if err != nil || params.sort != SortProgress || params.limit != 0 || params.cursor != nil {
+		t.Fatalf("Expected default params, got %+v (err %v)", params, err)
+	}
+
+	invalid := []map[string]string{
+		{"sort": "random"},
+		{"limit": "0"},
+		{"limit": "101"},
+		{"limit": "ten"},
+		{"cursor": "!!!"},
+		{"cursor": encodeCursor(readingCursor{Sort: SortUser, SK: "Alice#1"})},
+	}
+	for _, query := range invalid {
+		if _, err := parseParams(query); err == nil {
+			t.Errorf("Expected %v to be rejected", query)
+		}
+	}
+
+	cursor := encodeCursor(readingCursor{Sort: SortRating, SK: "Alice#1", Avaliacao: 4})
+	params, err = parseParams(map[string]string{"sort": "Rating", "limit": "10", "cursor": cursor})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if params.sort != SortRating || params.limit != 10 || params.cursor == nil || params.cursor.Avaliacao != 4 {
+		t.Errorf("Unexpected params %+v", params)
+	}
+}
+
+func TestBuildResponseSortOptions(t *testing.T) {
+	readings := []sharedTypes.LeituraItem{
+		{SK: "bob#1", User: "bob", Progresso: 40, Avaliacao: 0, UpdatedAt: "2026-01-03T00:00:00Z"},
+		{SK: "Alice#1", User: "Alice", Progresso: 100, Avaliacao: 3, UpdatedAt: "2026-01-01T00:00:00Z"},
+		{SK: "Carol#1", User: "Carol", Progresso: 70, Avaliacao: 5, UpdatedAt: "2026-01-02T00:00:00Z"},
+	}
+
+	tests := []struct {
+		sort     string
+		expected []string
+	}{
+		{SortProgress, []string{"Alice", "Carol", "bob"}},
+		{SortRecent, []string{"bob", "Carol", "Alice"}},
+		{SortRating, []string{"Carol", "Alice", "bob"}},
+		{SortUser, []string{"Alice", "bob", "Carol"}},
+	}
+
+	for _, tt := range tests {
+		response := buildResponse(readings, readingsParams{sort: tt.sort})
+		for i, user := range tt.expected {
+			if response.Readings[i].User != user {
+				t.Errorf("sort=%s: expected %s at %d, got %s", tt.sort, user, i, response.Readings[i].User)
+			}
+		}
+		if response.NextCursor != "" {
+			t.Errorf("sort=%s: expected no next cursor without a limit", tt.sort)
+		}
+	}
+}
+
+func TestBuildResponseCursorWalksEveryReading(t *testing.T) {
+	// Ties on every sort field: only the SK keeps the pages apart
+	var readings []sharedTypes.LeituraItem
+	for i := 0; i < 7; i++ {
+		readings = append(readings, sharedTypes.LeituraItem{
+			SK:        fmt.Sprintf("user%d#1", i),
+			User:      fmt.Sprintf("user%d", i),
+			Progresso: 50,
+			UpdatedAt: "2026-01-01T00:00:00Z",
+		})
+	}
+
+	seen := map[string]bool{}
+	params := readingsParams{sort: SortProgress, limit: 3}
+	pages := 0
+	for {
+		response := buildResponse(readings, params)
+		pages++
+		if response.Total != 7 {
+			t.Fatalf("Expected total 7 on every page, got %d", response.Total)
+		}
+		for _, r := range response.Readings {
+			if seen[r.User] {
+				t.Fatalf("Reading of %s returned twice", r.User)
+			}
+			seen[r.User] = true
+		}
+		if response.NextCursor == "" {
+			break
+		}
+		next, err := parseParams(map[string]string{"limit": "3", "cursor": response.NextCursor})
+		if err != nil {
+			t.Fatalf("Next cursor rejected: %v", err)
+		}
+		params = next
+	}
+
+	if pages != 3 || len(seen) != 7 {
+		t.Errorf("Expected 7 readings over 3 pages, got %d over %d", len(seen), pages)
+	}
+}
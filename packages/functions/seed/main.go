@@ -16,6 +16,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/google/uuid"
 	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/calendar"
+	"github.com/mundotalendo/functions/httpcache"
 	"github.com/mundotalendo/functions/mapping"
 	"github.com/mundotalendo/functions/types"
 )
@@ -93,6 +95,7 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 
 		// Random category (month)
 		randomCategory := categories[rng.Intn(len(categories))]
+		month := calendar.ParseCategory(randomCategory)
 
 		// Random timestamp within the last 30 days
 		daysAgo := rng.Intn(30)
@@ -142,17 +145,24 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 			Item:      avWebhook,
 		})
 
-		// Create reading item with UUID-based keys
+		// Create reading item in the live partition, keyed as the consumer keys
+		// a desafio without ID; countryKey puts it in the CountryIndex read by
+		// GET /readings/{iso3}
 		item := types.LeituraItem{
-			PK:        fmt.Sprintf("EVENT#LEITURA#%s", seedUUID),
-			SK:        fmt.Sprintf("COUNTRY#%s", iso3),
-			ISO3:      iso3,
-			Pais:      randomCountry,
-			Categoria: randomCategory,
-			Progresso: randomProgress,
-			User:      userName,
-			ImagemURL: fmt.Sprintf("https://i.pravatar.cc/150?u=%s", userName),
-			Livro:     fmt.Sprintf("Livro sobre %s", randomCountry),
+			PK:            "EVENT#LEITURA",
+			SK:            fmt.Sprintf("%s#%s#0", userName, iso3),
+			ISO3:          iso3,
+			Pais:          randomCountry,
+			Categoria:     randomCategory,
+			Mes:           month,
+			MesDivergente: !calendar.BelongsTo(iso3, month),
+			Progresso:     randomProgress,
+			User:          userName,
+			ImagemURL:     fmt.Sprintf("https://i.pravatar.cc/150?u=%s", userName),
+			Livro:         fmt.Sprintf("Livro sobre %s", randomCountry),
+			CountryKey:    iso3,
+			WebhookUUID:   seedUUID,
+			UpdatedAt:     timestamp.Format(time.RFC3339),
 		}
 
 		av, err := attributevalue.MarshalMap(item)
@@ -174,6 +184,10 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 		inserted++
 	}
 
+	if err := httpcache.Bump(ctx, dynamoClient, tableName); err != nil {
+		log.Printf("WARN: Failed to bump data version: %v", err)
+	}
+
 	response := map[string]interface{}{
 		"success":  true,
 		"inserted": inserted,
@@ -3,8 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -14,6 +19,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/calendar"
+	"github.com/mundotalendo/functions/httpcache"
 	"github.com/mundotalendo/functions/types"
 )
 
@@ -51,7 +58,127 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 		}, nil
 	}
 
-	// Query DynamoDB for all readings with pagination
+	// Activities are not readings: they only count when explicitly requested
+	includeActivities := request.QueryStringParameters["includeActivities"] == "true"
+
+	filter, err := parseStatsFilter(request.QueryStringParameters)
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+	strategy, err := parseStrategy(request.QueryStringParameters["strategy"])
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+
+	// Conditional GET: the data version marker tells whether the client's copy
+	// is current, without reading the partitions
+	validator, cacheable, err := httpcache.Load(ctx, dynamoClient, tableName, "/stats", httpcache.QueryKey(request.QueryStringParameters))
+	if err != nil {
+		log.Printf("WARN: Failed to load data version: %v", err)
+	}
+	if cacheable && validator.NotModified(request.Headers) {
+		log.Printf("Not modified: %s", validator.ETag)
+		return validator.NotModifiedResponse(), nil
+	}
+
+	// Country aggregates are maintained by the consumer: a single small
+	// partition instead of every reading
+	allItems, err := queryPartition(ctx, types.CountryAggregatePartition)
+	if err != nil {
+		log.Printf("Error querying DynamoDB: %v", err)
+		return errorResponse(500, "Error fetching data"), nil
+	}
+
+	log.Printf("Fetched %d country aggregates from DynamoDB", len(allItems))
+
+	aggregates := make([]types.CountryAggregateItem, 0, len(allItems))
+	for _, item := range allItems {
+		var aggregate types.CountryAggregateItem
+		err := attributevalue.UnmarshalMap(item, &aggregate)
+		if err != nil || aggregate.ISO3 == "" {
+			log.Printf("Error unmarshaling item: %v", err)
+			continue
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+	aggregates = filterAggregates(aggregates, filter)
+
+	// Readers of each country, overall and per categoria
+	countryReaders := make(map[string]*countryStats) // ISO -> readers
+	for _, aggregate := range aggregates {
+		stats := newCountryStats()
+		for user, contribution := range aggregate.Users {
+			stats.add(user, contribution)
+		}
+		countryReaders[aggregate.ISO3] = stats
+	}
+
+	if includeActivities {
+		activityItems, err := queryPartition(ctx, types.ActivityPartition)
+		if err != nil {
+			log.Printf("Error querying DynamoDB: %v", err)
+			return errorResponse(500, "Error fetching data"), nil
+		}
+		var activities []types.AtividadeItem
+		if err := attributevalue.UnmarshalListOfMaps(activityItems, &activities); err != nil {
+			log.Printf("Error unmarshaling activities: %v", err)
+			return errorResponse(500, "Error fetching data"), nil
+		}
+		mergeActivityProgress(countryReaders, filterActivities(activities, filter))
+	}
+
+	// Convert map to list of CountryProgress
+	// FILTER: Only include countries with at least one reader (progress > 0); the others show as unexplored
+	countries := make([]types.CountryProgress, 0, len(countryReaders))
+	for iso, stats := range countryReaders {
+		if country := stats.summary(iso, strategy); country.Readers > 0 {
+			countries = append(countries, country)
+		}
+	}
+
+	// Average ratings per country and per book
+	countryRatings, books := aggregateRatings(ratedReadings(aggregates))
+	for i := range countries {
+		if r, exists := countryRatings[countries[i].ISO3]; exists {
+			countries[i].AvgRating = r.average()
+			countries[i].Ratings = r.count
+		}
+	}
+
+	// Build response
+	response := types.StatsResponse{
+		Countries: countries,
+		Books:     books,
+		Months:    monthSummaries(aggregates, filter.month),
+		Strategy:  strategy,
+		Total:     len(countries),
+	}
+
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return errorResponse(500, "Error building response"), nil
+	}
+
+	log.Printf("Returning %d unique countries", len(countries))
+
+	headers := map[string]string{
+		"Content-Type":                "application/json",
+		"Access-Control-Allow-Origin": "*",
+	}
+	if cacheable {
+		validator.Apply(headers)
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    headers,
+		Body:       string(responseBody),
+	}, nil
+}
+
+// queryPartition reads every item of a partition (all pages).
+func queryPartition(ctx context.Context, pk string) ([]map[string]ddbTypes.AttributeValue, error) {
 	var allItems []map[string]ddbTypes.AttributeValue
 	var lastKey map[string]ddbTypes.AttributeValue
 
@@ -60,13 +187,12 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 			TableName:              &tableName,
 			KeyConditionExpression: aws.String("PK = :pk"),
 			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
-				":pk": &ddbTypes.AttributeValueMemberS{Value: "EVENT#LEITURA"},
+				":pk": &ddbTypes.AttributeValueMemberS{Value: pk},
 			},
 			ExclusiveStartKey: lastKey,
 		})
 		if err != nil {
-			log.Printf("Error querying DynamoDB: %v", err)
-			return errorResponse(500, "Error fetching data"), nil
+			return nil, err
 		}
 
 		allItems = append(allItems, result.Items...)
@@ -78,59 +204,345 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 		lastKey = result.LastEvaluatedKey
 	}
 
-	log.Printf("Fetched %d total items from DynamoDB", len(allItems))
+	return allItems, nil
+}
 
-	// Aggregate max progress per country
-	countryProgress := make(map[string]int) // ISO -> max progress
-	for _, item := range allItems {
-		var reading types.LeituraItem
-		err := attributevalue.UnmarshalMap(item, &reading)
-		if err != nil {
-			log.Printf("Error unmarshaling item: %v", err)
+// statsFilter selects the readings counted by GET /stats.
+type statsFilter struct {
+	user  string // only this user's readings ("" for everyone)
+	month int    // only readings whose categoria is this month (0 for all)
+}
+
+// parseStatsFilter reads the user and mes (month number 1-12) query parameters.
+func parseStatsFilter(params map[string]string) (statsFilter, error) {
+	filter := statsFilter{user: strings.TrimSpace(params["user"])}
+	if mes := strings.TrimSpace(params["mes"]); mes != "" {
+		n, err := strconv.Atoi(mes)
+		if _, ok := calendar.ByNumber(n); err != nil || !ok {
+			return statsFilter{}, errors.New("Invalid mes, expected a month number from 1 to 12")
+		}
+		filter.month = n
+	}
+	return filter, nil
+}
+
+// filterAggregates keeps the contributions selected by the filter. With a
+// month, a contribution keeps only the categorias of that month and its
+// progress becomes the highest among them. Countries left without
+// contributions are dropped.
+func filterAggregates(aggregates []types.CountryAggregateItem, filter statsFilter) []types.CountryAggregateItem {
+	if filter.user == "" && filter.month == 0 {
+		return aggregates
+	}
+
+	filtered := make([]types.CountryAggregateItem, 0, len(aggregates))
+	for _, aggregate := range aggregates {
+		users := make(map[string]types.CountryContribution)
+		for user, contribution := range aggregate.Users {
+			if filter.user != "" && user != filter.user {
+				continue
+			}
+			if filter.month != 0 {
+				categorias := make(map[string]int)
+				contribution.Progresso = 0
+				for categoria, progress := range contribution.Categorias {
+					if calendar.ParseCategory(categoria) == filter.month {
+						categorias[categoria] = progress
+						contribution.Progresso = max(contribution.Progresso, progress)
+					}
+				}
+				if len(categorias) == 0 {
+					continue
+				}
+				contribution.Categorias = categorias
+			}
+			users[user] = contribution
+		}
+
+		if len(users) > 0 {
+			aggregate.Users = users
+			filtered = append(filtered, aggregate)
+		}
+	}
+	return filtered
+}
+
+// filterActivities keeps the activities selected by the filter.
+func filterActivities(activities []types.AtividadeItem, filter statsFilter) []types.AtividadeItem {
+	filtered := make([]types.AtividadeItem, 0, len(activities))
+	for _, activity := range activities {
+		if filter.user != "" && activity.User != filter.user {
 			continue
 		}
-		if reading.ISO3 != "" {
-			// Keep the maximum progress for each country
-			if currentProgress, exists := countryProgress[reading.ISO3]; !exists || reading.Progresso > currentProgress {
-				countryProgress[reading.ISO3] = reading.Progresso
+		if filter.month != 0 && activity.Mes != filter.month {
+			continue
+		}
+		filtered = append(filtered, activity)
+	}
+	return filtered
+}
+
+// monthSummaries counts, for each month of the calendar (or only month, when
+// set), the countries started and completed and the distinct readers, from
+// the progress per categoria. Categorias that are not a month are left out.
+func monthSummaries(aggregates []types.CountryAggregateItem, month int) []types.MonthSummary {
+	started := make(map[int]int)
+	completed := make(map[int]int)
+	readers := make(map[int]map[string]bool)
+
+	for _, aggregate := range aggregates {
+		progress := make(map[int]int) // month -> country progress in the month
+		for user, contribution := range aggregate.Users {
+			for categoria, p := range contribution.Categorias {
+				mes := calendar.ParseCategory(categoria)
+				if mes == 0 || p <= 0 {
+					continue
+				}
+				progress[mes] = max(progress[mes], p)
+				if readers[mes] == nil {
+					readers[mes] = make(map[string]bool)
+				}
+				readers[mes][user] = true
+			}
+		}
+		for mes, p := range progress {
+			started[mes]++
+			if p == 100 {
+				completed[mes]++
 			}
 		}
 	}
 
-	// Convert map to list of CountryProgress
-	// FILTER: Only include countries with progress >= 1% (exclude 0% to show as unexplored)
-	countries := make([]types.CountryProgress, 0, len(countryProgress))
-	for iso, progress := range countryProgress {
-		if progress >= 1 { // Changed from >= 0 to >= 1
-			countries = append(countries, types.CountryProgress{
-				ISO3:     iso,
-				Progress: progress,
-			})
+	summaries := make([]types.MonthSummary, 0, len(calendar.Months))
+	for _, m := range calendar.Months {
+		if month != 0 && m.Number != month {
+			continue
 		}
+		summaries = append(summaries, types.MonthSummary{
+			Mes:       m.Number,
+			Nome:      m.Name,
+			Started:   started[m.Number],
+			Completed: completed[m.Number],
+			Readers:   len(readers[m.Number]),
+		})
 	}
+	return summaries
+}
 
-	// Build response
-	response := types.StatsResponse{
-		Countries: countries,
-		Total:     len(countries),
+// Map color strategies (strategy query parameter): how the progress of a
+// country is derived from its readers.
+const (
+	StrategyMax        = "max"        // highest progress of any reader (default)
+	StrategyAverage    = "average"    // average progress of the readers
+	StrategyCompletion = "completion" // share of the readers who completed the country
+)
+
+// parseStrategy validates the strategy query parameter ("" is StrategyMax).
+func parseStrategy(strategy string) (string, error) {
+	switch strings.TrimSpace(strategy) {
+	case "", StrategyMax:
+		return StrategyMax, nil
+	case StrategyAverage:
+		return StrategyAverage, nil
+	case StrategyCompletion:
+		return StrategyCompletion, nil
 	}
+	return "", errors.New("Invalid strategy, expected max, average or completion")
+}
 
-	responseBody, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("Error marshaling response: %v", err)
-		return errorResponse(500, "Error building response"), nil
+// countryStats accumulates the readers of a country.
+type countryStats struct {
+	users        map[string]int  // user -> highest progress
+	categorias   map[string]int  // categoria -> highest progress
+	books        map[string]bool // distinct titles read
+	lastActivity string          // RFC3339 of the latest reading
+}
+
+func newCountryStats() *countryStats {
+	return &countryStats{
+		users:      make(map[string]int),
+		categorias: make(map[string]int),
+		books:      make(map[string]bool),
 	}
+}
 
-	log.Printf("Returning %d unique countries", len(countries))
+// add counts a user's contribution.
+func (c *countryStats) add(user string, contribution types.CountryContribution) {
+	c.users[user] = max(c.users[user], contribution.Progresso)
+	for categoria, progress := range contribution.Categorias {
+		c.categorias[categoria] = max(c.categorias[categoria], progress)
+	}
+	for _, livro := range contribution.Livros {
+		c.books[livro] = true
+	}
+	c.lastActivity = max(c.lastActivity, contribution.UpdatedAt)
+}
 
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type":                "application/json",
-			"Access-Control-Allow-Origin": "*",
-		},
-		Body: string(responseBody),
-	}, nil
+// summary returns the country statistics; Progress (the map color) is
+// derived from the readers according to strategy.
+func (c *countryStats) summary(iso3, strategy string) types.CountryProgress {
+	var progresses []int
+	completed, highest := 0, 0
+	for _, progress := range c.users {
+		if progress <= 0 {
+			continue
+		}
+		progresses = append(progresses, progress)
+		highest = max(highest, progress)
+		if progress == 100 {
+			completed++
+		}
+	}
+
+	country := types.CountryProgress{
+		ISO3:         iso3,
+		Progress:     highest,
+		Readers:      len(progresses),
+		Completed:    completed,
+		LastActivity: c.lastActivity,
+		Books:        len(c.books),
+	}
+	if len(c.categorias) > 0 {
+		country.Categorias = c.categorias
+	}
+	if len(progresses) == 0 {
+		return country
+	}
+
+	sort.Ints(progresses)
+	sum := 0
+	for _, progress := range progresses {
+		sum += progress
+	}
+	country.AvgProgress = round2(float64(sum) / float64(len(progresses)))
+	middle := len(progresses) / 2
+	if len(progresses)%2 == 1 {
+		country.MedianProgress = float64(progresses[middle])
+	} else {
+		country.MedianProgress = round2(float64(progresses[middle-1]+progresses[middle]) / 2)
+	}
+
+	switch strategy {
+	case StrategyAverage:
+		country.Progress = int(math.Round(country.AvgProgress))
+	case StrategyCompletion:
+		country.Progress = int(math.Round(float64(completed) * 100 / float64(len(progresses))))
+	}
+	return country
+}
+
+// round2 rounds to two decimals.
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// mergeActivityProgress adds the progress of activities named after a country
+// (includeActivities=true): an activity counts as its user's reading of the
+// country, keeping the user's highest progress.
+func mergeActivityProgress(countryReaders map[string]*countryStats, activities []types.AtividadeItem) {
+	for _, activity := range activities {
+		if activity.ISO3 == "" {
+			continue
+		}
+		stats, exists := countryReaders[activity.ISO3]
+		if !exists {
+			stats = newCountryStats()
+			countryReaders[activity.ISO3] = stats
+		}
+		stats.add(activity.User, types.CountryContribution{
+			Progresso: activity.Progresso,
+			UpdatedAt: activity.UpdatedAt,
+		})
+	}
+}
+
+// ratedReadings returns the rated books kept in the aggregates, one per user
+// rating, as readings for aggregateRatings.
+func ratedReadings(aggregates []types.CountryAggregateItem) []types.LeituraItem {
+	var readings []types.LeituraItem
+	for _, aggregate := range aggregates {
+		for _, contribution := range aggregate.Users {
+			for _, rating := range contribution.Avaliacoes {
+				readings = append(readings, types.LeituraItem{
+					ISO3:      aggregate.ISO3,
+					Livro:     rating.Livro,
+					Autor:     rating.Autor,
+					Avaliacao: rating.Avaliacao,
+				})
+			}
+		}
+	}
+	return readings
+}
+
+// ratingSum accumulates ratings to compute an average.
+type ratingSum struct {
+	sum   int
+	count int
+}
+
+// average returns the mean rating rounded to two decimals.
+func (r ratingSum) average() float64 {
+	if r.count == 0 {
+		return 0
+	}
+	return round2(float64(r.sum) / float64(r.count))
+}
+
+// bookKey identifies a book read for a country.
+type bookKey struct {
+	iso3  string
+	livro string
+	autor string
+}
+
+// aggregateRatings averages the ratings (Avaliacao > 0) per country and per
+// book. Books are returned best rated first, ties by number of ratings.
+func aggregateRatings(readings []types.LeituraItem) (map[string]ratingSum, []types.BookRating) {
+	countries := make(map[string]ratingSum)
+	bookRatings := make(map[bookKey]ratingSum)
+
+	for _, reading := range readings {
+		if reading.Avaliacao <= 0 || reading.ISO3 == "" {
+			continue
+		}
+
+		c := countries[reading.ISO3]
+		c.sum += reading.Avaliacao
+		c.count++
+		countries[reading.ISO3] = c
+
+		if reading.Livro == "" {
+			continue
+		}
+		key := bookKey{iso3: reading.ISO3, livro: reading.Livro, autor: reading.Autor}
+		b := bookRatings[key]
+		b.sum += reading.Avaliacao
+		b.count++
+		bookRatings[key] = b
+	}
+
+	books := make([]types.BookRating, 0, len(bookRatings))
+	for key, r := range bookRatings {
+		books = append(books, types.BookRating{
+			ISO3:      key.iso3,
+			Livro:     key.livro,
+			Autor:     key.autor,
+			AvgRating: r.average(),
+			Ratings:   r.count,
+		})
+	}
+	sort.Slice(books, func(i, j int) bool {
+		if books[i].AvgRating != books[j].AvgRating {
+			return books[i].AvgRating > books[j].AvgRating
+		}
+		if books[i].Ratings != books[j].Ratings {
+			return books[i].Ratings > books[j].Ratings
+		}
+		return books[i].Livro < books[j].Livro
+	})
+
+	return countries, books
 }
 
 func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
@@ -469,3 +469,166 @@ func BenchmarkStatsResponseMarshal(b *testing.B) {
 		}
 	}
 }
+
+func TestAggregateRatings(t *testing.T) {
+	readings := []types.LeituraItem{
+		{ISO3: "JPN", Livro: "Kokoro", Autor: "Natsume Soseki", Avaliacao: 5},
+		{ISO3: "JPN", Livro: "Kokoro", Autor: "Natsume Soseki", Avaliacao: 4},
+		{ISO3: "JPN", Livro: "Kafka à Beira-Mar", Autor: "Haruki Murakami", Avaliacao: 3},
+		{ISO3: "JPN", Livro: "Norwegian Wood", Autor: "Haruki Murakami"}, // not rated
+		{ISO3: "BRA", Livro: "Dom Casmurro", Autor: "Machado de Assis", Avaliacao: 5},
+		{ISO3: "BRA", Avaliacao: 2}, // rated without book: counts for the country only
+	}
+
+	countries, books := aggregateRatings(readings)
+
+	if jpn := countries["JPN"]; jpn.count != 3 || jpn.average() != 4 {
+		t.Errorf("Expected JPN 3 ratings averaging 4, got %d / %v", jpn.count, jpn.average())
+	}
+	if bra := countries["BRA"]; bra.count != 2 || bra.average() != 3.5 {
+		t.Errorf("Expected BRA 2 ratings averaging 3.5, got %d / %v", bra.count, bra.average())
+	}
+
+	if len(books) != 3 {
+		t.Fatalf("Expected 3 rated books, got %d", len(books))
+	}
+	if books[0].Livro != "Dom Casmurro" || books[1].Livro != "Kokoro" || books[2].Livro != "Kafka à Beira-Mar" {
+		t.Errorf("Unexpected book order: %+v", books)
+	}
+	if books[1].AvgRating != 4.5 || books[1].Ratings != 2 || books[1].Autor != "Natsume Soseki" {
+		t.Errorf("Unexpected Kokoro rating: %+v", books[1])
+	}
+
+	if _, empty := aggregateRatings(nil); empty == nil || len(empty) != 0 {
+		t.Errorf("Expected empty non-nil books, got %v", empty)
+	}
+}
+
+func TestMergeActivityProgress(t *testing.T) {
+	countryReaders := map[string]*countryStats{"PRT": newCountryStats(), "CHL": newCountryStats()}
+	countryReaders["PRT"].add("Maria", types.CountryContribution{Progresso: 20})
+	countryReaders["CHL"].add("Maria", types.CountryContribution{Progresso: 80})
+	activities := []types.AtividadeItem{
+		{User: "Maria", Descricao: "Portugal", ISO3: "PRT", Progresso: 100},
+		{User: "Maria", Descricao: "Chile", ISO3: "CHL", Progresso: 50},
+		{User: "Ana", Descricao: "Japão", ISO3: "JPN", Progresso: 10},
+		{User: "Ana", Descricao: "Ler um clássico", Progresso: 100}, // not a country
+	}
+
+	mergeActivityProgress(countryReaders, activities)
+
+	want := map[string]int{"PRT": 100, "CHL": 80, "JPN": 10}
+	if len(countryReaders) != len(want) {
+		t.Fatalf("expected %v, got %v", want, countryReaders)
+	}
+	for iso3, progress := range want {
+		if got := countryReaders[iso3].summary(iso3, StrategyMax).Progress; got != progress {
+			t.Errorf("%s: expected %d, got %d", iso3, progress, got)
+		}
+	}
+}
+
+func TestCountryStats_Summary(t *testing.T) {
+	stats := newCountryStats()
+	stats.add("Maria", types.CountryContribution{Progresso: 100, UpdatedAt: "2026-01-10T00:00:00Z", Livros: []string{"Kokoro"}})
+	stats.add("Ana", types.CountryContribution{Progresso: 30, UpdatedAt: "2026-01-12T00:00:00Z", Livros: []string{"Kokoro", "Neve"}})
+	stats.add("Rita", types.CountryContribution{Progresso: 20})
+	stats.add("Bia", types.CountryContribution{Progresso: 0}) // not a reader
+
+	country := stats.summary("JPN", StrategyMax)
+	if country.Progress != 100 || country.Readers != 3 || country.Completed != 1 || country.Books != 2 {
+		t.Errorf("unexpected summary: %+v", country)
+	}
+	if country.AvgProgress != 50 || country.MedianProgress != 30 || country.LastActivity != "2026-01-12T00:00:00Z" {
+		t.Errorf("unexpected average, median or last activity: %+v", country)
+	}
+
+	if got := stats.summary("JPN", StrategyAverage).Progress; got != 50 {
+		t.Errorf("average strategy: expected 50, got %d", got)
+	}
+	if got := stats.summary("JPN", StrategyCompletion).Progress; got != 33 {
+		t.Errorf("completion strategy: expected 33, got %d", got)
+	}
+
+	stats.add("Bia", types.CountryContribution{Progresso: 60})
+	if median := stats.summary("JPN", StrategyMax).MedianProgress; median != 45 {
+		t.Errorf("expected median 45 for an even number of readers, got %v", median)
+	}
+
+	if _, err := parseStrategy("median"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+	if strategy, err := parseStrategy(""); err != nil || strategy != StrategyMax {
+		t.Errorf("expected max by default, got %q (err %v)", strategy, err)
+	}
+}
+
+func TestRatedReadings(t *testing.T) {
+	aggregates := []types.CountryAggregateItem{
+		{ISO3: "JPN", Users: map[string]types.CountryContribution{
+			"Ana":   {Progresso: 100, Avaliacoes: []types.BookAvaliacao{{Livro: "Kokoro", Autor: "Natsume Soseki", Avaliacao: 5}}},
+			"Maria": {Progresso: 40, Avaliacoes: []types.BookAvaliacao{{Livro: "Kokoro", Autor: "Natsume Soseki", Avaliacao: 4}}},
+			"Bia":   {Progresso: 10}, // no ratings
+		}},
+	}
+
+	countries, books := aggregateRatings(ratedReadings(aggregates))
+
+	if jpn := countries["JPN"]; jpn.count != 2 || jpn.average() != 4.5 {
+		t.Errorf("Expected JPN 2 ratings averaging 4.5, got %d / %v", jpn.count, jpn.average())
+	}
+	if len(books) != 1 || books[0].Livro != "Kokoro" || books[0].Ratings != 2 {
+		t.Errorf("Unexpected books: %+v", books)
+	}
+}
+
+func TestFilterAggregatesAndMonthSummaries(t *testing.T) {
+	aggregates := []types.CountryAggregateItem{
+		{ISO3: "CHL", Users: map[string]types.CountryContribution{
+			"Maria": {Progresso: 100, Categorias: map[string]int{"Janeiro": 100}},
+			"Ana":   {Progresso: 60, Categorias: map[string]int{"Janeiro": 20, "Março": 60}},
+		}},
+		{ISO3: "JPN", Users: map[string]types.CountryContribution{
+			"Ana": {Progresso: 30, Categorias: map[string]int{"Março": 30, "Bônus": 10}},
+		}},
+	}
+
+	march := filterAggregates(aggregates, statsFilter{month: 3})
+	if len(march) != 2 {
+		t.Fatalf("expected 2 countries read in March, got %d", len(march))
+	}
+	if ana := march[0].Users["Ana"]; len(march[0].Users) != 1 || ana.Progresso != 60 || len(ana.Categorias) != 1 {
+		t.Errorf("expected only Ana's March reading of CHL, got %+v", march[0].Users)
+	}
+
+	if maria := filterAggregates(aggregates, statsFilter{user: "Maria"}); len(maria) != 1 || maria[0].ISO3 != "CHL" {
+		t.Errorf("expected only CHL for Maria, got %+v", maria)
+	}
+
+	summaries := monthSummaries(aggregates, 0)
+	if len(summaries) != 12 {
+		t.Fatalf("expected 12 months, got %d", len(summaries))
+	}
+	jan, mar := summaries[0], summaries[2]
+	if jan.Started != 1 || jan.Completed != 1 || jan.Readers != 2 {
+		t.Errorf("unexpected January summary: %+v", jan)
+	}
+	if mar.Nome != "Março" || mar.Started != 2 || mar.Completed != 0 || mar.Readers != 1 {
+		t.Errorf("unexpected March summary: %+v", mar)
+	}
+	if only := monthSummaries(aggregates, 3); len(only) != 1 || only[0].Mes != 3 {
+		t.Errorf("expected only March, got %+v", only)
+	}
+}
+
+func TestParseStatsFilter(t *testing.T) {
+	filter, err := parseStatsFilter(map[string]string{"user": " Maria ", "mes": "3"})
+	if err != nil || filter.user != "Maria" || filter.month != 3 {
+		t.Errorf("unexpected filter %+v (err %v)", filter, err)
+	}
+	for _, mes := range []string{"0", "13", "março"} {
+		if _, err := parseStatsFilter(map[string]string{"mes": mes}); err == nil {
+			t.Errorf("expected an error for mes=%s", mes)
+		}
+	}
+}
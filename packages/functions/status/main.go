@@ -0,0 +1,155 @@
+// Package main implements GET /webhook/{uuid}, returning the processing
+// status of a webhook accepted by POST /webhook.
+//
+// Status records are written by the webhook (QUEUED) and the consumer
+// (PROCESSING → PROCESSED/PARTIAL/FAILED) and include per-desafio outcomes,
+// so support can explain why a country is missing from the map.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/types"
+)
+
+var (
+	dynamoClient *dynamodb.Client
+	tableName    string
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("SST_Resource_DataTable_name")
+}
+
+func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	webhookUUID := strings.ToLower(strings.TrimSpace(request.PathParameters["uuid"]))
+	log.Printf("Fetching status for webhook UUID=%s", webhookUUID)
+
+	// Validate API key
+	apiKey := request.Headers["x-api-key"]
+	if apiKey == "" {
+		apiKey = request.Headers["X-API-Key"]
+	}
+	if !auth.ValidateAPIKey(ctx, dynamoClient, apiKey) {
+		log.Printf("Unauthorized: invalid API key")
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"UNAUTHORIZED","message":"Invalid or missing API key"}`,
+		}, nil
+	}
+
+	if !isValidUUID(webhookUUID) {
+		return errorResponse(400, "Invalid webhook UUID"), nil
+	}
+
+	pk, sk := types.WebhookStatusKey(webhookUUID)
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &tableName,
+		Key: map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: pk},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: sk},
+		},
+	})
+	if err != nil {
+		log.Printf("Error querying DynamoDB: %v", err)
+		return errorResponse(500, "Error fetching data"), nil
+	}
+
+	if result.Item == nil {
+		log.Printf("Status not found for UUID=%s", webhookUUID)
+		return errorResponse(404, "Webhook not found"), nil
+	}
+
+	var status types.WebhookStatusItem
+	if err := attributevalue.UnmarshalMap(result.Item, &status); err != nil {
+		log.Printf("Error unmarshaling item: %v", err)
+		return errorResponse(500, "Error reading status"), nil
+	}
+
+	responseBody, err := json.Marshal(status)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return errorResponse(500, "Error building response"), nil
+	}
+
+	log.Printf("Returning status %s for UUID=%s", status.Status, webhookUUID)
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(responseBody),
+	}, nil
+}
+
+// isValidUUID checks the canonical 8-4-4-4-12 hex format used by the webhook.
+func isValidUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, r := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+		default:
+			if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	body, err := json.Marshal(map[string]string{
+		"error": message,
+	})
+	if err != nil {
+		log.Printf("ERROR marshaling error response: %v", err)
+		// Fallback to hardcoded JSON if marshal fails
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: 500,
+			Headers: map[string]string{
+				"Content-Type":                "application/json",
+				"Access-Control-Allow-Origin": "*",
+			},
+			Body: `{"error":"INTERNAL_ERROR"}`,
+		}
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(body),
+	}
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mundotalendo/functions/types"
+)
+
+func TestIsValidUUID(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"3f1c2a9e-7b4d-4c1a-9e2f-1a2b3c4d5e6f", true},
+		{"00000000-0000-0000-0000-000000000000", true},
+		{"3F1C2A9E-7B4D-4C1A-9E2F-1A2B3C4D5E6F", false}, // handler lowercases before validating
+		{"3f1c2a9e7b4d4c1a9e2f1a2b3c4d5e6f", false},
+		{"3f1c2a9e-7b4d-4c1a-9e2f-1a2b3c4d5e6", false},
+		{"3f1c2a9e-7b4d-4c1a-9e2f-1a2b3c4d5e6g", false},
+		{"", false},
+		{"../../etc/passwd", false},
+	}
+
+	for _, tt := range tests {
+		if got := isValidUUID(tt.input); got != tt.expected {
+			t.Errorf("isValidUUID(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	response := errorResponse(404, "Webhook not found")
+
+	if response.StatusCode != 404 {
+		t.Errorf("Expected status code 404, got %d", response.StatusCode)
+	}
+
+	if response.Headers["Access-Control-Allow-Origin"] != "*" {
+		t.Error("Expected CORS header to be set")
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	if body["error"] != "Webhook not found" {
+		t.Errorf("Expected error message 'Webhook not found', got '%s'", body["error"])
+	}
+}
+
+func TestStatusJSON_HidesStorageKeys(t *testing.T) {
+	item := types.WebhookStatusItem{
+		PK:        "WEBHOOK#STATUS#test-uuid",
+		SK:        "STATUS",
+		UUID:      "test-uuid",
+		User:      "Test User",
+		Status:    types.StatusPartial,
+		Processed: 1,
+		Failed:    1,
+		Desafios: []types.DesafioOutcome{
+			{Country: "Brasil", ISO3: "BRA", Outcome: types.OutcomeProcessed},
+			{Country: "Atlântida", Outcome: types.OutcomeFailed, ErrorCode: "COUNTRY_NOT_FOUND"},
+		},
+		ExpiresAt: 1776000000,
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		t.Fatalf("Failed to marshal status: %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("Failed to unmarshal status: %v", err)
+	}
+
+	for _, hidden := range []string{"PK", "SK", "expiresAt"} {
+		if _, exists := body[hidden]; exists {
+			t.Errorf("Expected %s to be omitted from response", hidden)
+		}
+	}
+
+	if body["status"] != "PARTIAL" {
+		t.Errorf("Expected status PARTIAL, got %v", body["status"])
+	}
+
+	if body["user"] != "Test User" {
+		t.Errorf("Expected user 'Test User', got %v", body["user"])
+	}
+
+	desafios, ok := body["desafios"].([]interface{})
+	if !ok || len(desafios) != 2 {
+		t.Fatalf("Expected 2 desafio outcomes, got %v", body["desafios"])
+	}
+}
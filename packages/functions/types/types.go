@@ -46,12 +46,13 @@ type Vinculado struct {
 
 // DynamoDB item structures
 
-// LeituraItem - Item de leitura (país) com rastreamento UUID
+// LeituraItem - Item de leitura (livro vinculado a um país) com rastreamento UUID
 // PK: "EVENT#LEITURA" - agrupa todos os eventos de leitura
-// SK: "<uuid>#<iso3>#<index>" - identifica livro único (UUID + país + índice)
+// SK: "<user>#<desafioID>#<vinculadoID>" - chave estável entre webhooks, um item por livro vinculado
+// (sem sufixo quando o desafio não tem livros; "<user>#<iso3>#<index>" quando o desafio não tem ID)
 type LeituraItem struct {
 	PK        string `dynamodbav:"PK"`        // "EVENT#LEITURA"
-	SK        string `dynamodbav:"SK"`        // "<uuid>#<iso3>#<index>"
+	SK        string `dynamodbav:"SK"`        // "<user>#<desafioID>[#<vinculadoID>]"
 	ISO3      string `dynamodbav:"iso3"`      // Código ISO 3166-1 Alpha-3
 	Pais      string `dynamodbav:"pais"`      // Nome do país em português
 	Categoria string `dynamodbav:"categoria"` // Mês/categoria do desafio
@@ -61,11 +62,51 @@ type LeituraItem struct {
 	CapaURL   string `dynamodbav:"capaURL"`   // URL da capa do livro
 	Livro     string `dynamodbav:"livro"`     // Título do livro sendo lido
 
+	// Livro vinculado ao desafio (vazio para desafios sem livros e itens antigos)
+	VinculadoID string `dynamodbav:"vinculadoID,omitempty"` // ID do vinculado no Maratona.app
+	Autor       string `dynamodbav:"autor,omitempty"`       // Autor do livro
+	Avaliacao   int    `dynamodbav:"avaliacao,omitempty"`   // Avaliação do livro (0 = sem avaliação)
+	Comentario  string `dynamodbav:"comentario,omitempty"`  // Comentário do leitor
+	DiaMarcado  string `dynamodbav:"diaMarcado,omitempty"`  // Dia marcado no desafio
+
+	// Mês declarado na categoria, conferido com o calendário oficial (pacote calendar)
+	Mes           int  `dynamodbav:"mes,omitempty"`           // Mês 1-12 (0 = categoria não é um mês)
+	MesDivergente bool `dynamodbav:"mesDivergente,omitempty"` // País não pertence ao mês declarado
+
+	// Link do perfil no Maratona.app (perfil.link), para GET /users/{name}
+	PerfilURL string `dynamodbav:"perfilURL,omitempty"`
+
+	// Chave do CountryIndex (GSI countryKey + progresso): o ISO3 nas leituras da
+	// partição ao vivo, vazia nas demais (fora do índice)
+	CountryKey string `dynamodbav:"countryKey,omitempty"`
+
 	// v1.0.3: UUID separado para rastreamento + timestamp de update
-	WebhookUUID string `dynamodbav:"webhookUUID"` // UUID da execução do webhook
+	WebhookUUID string `dynamodbav:"webhookUUID"` // UUID do último webhook que alterou a leitura
 	UpdatedAt   string `dynamodbav:"updatedAt"`   // RFC3339 timestamp do último update
 }
 
+// AtividadeItem - Desafio do tipo "atividade" (não é um livro): fica fora do progresso dos países
+// PK: "EVENT#ATIVIDADE" - agrupa todas as atividades
+// SK: "<user>#<desafioID>" - mesma regra de LeituraItem ("<user>#ATIVIDADE#<index>" quando o desafio não tem ID)
+type AtividadeItem struct {
+	PK          string `dynamodbav:"PK" json:"-"`
+	SK          string `dynamodbav:"SK" json:"-"`
+	User        string `dynamodbav:"user" json:"user"`                     // Nome do usuário
+	ImagemURL   string `dynamodbav:"imagemURL" json:"avatarURL"`           // URL do avatar do usuário
+	Descricao   string `dynamodbav:"descricao" json:"descricao"`           // Descrição da atividade (sem emojis)
+	ISO3        string `dynamodbav:"iso3,omitempty" json:"iso3,omitempty"` // País da descrição, quando é um país conhecido
+	Categoria   string `dynamodbav:"categoria" json:"categoria"`           // Mês/categoria do desafio
+	Mes         int    `dynamodbav:"mes,omitempty" json:"mes,omitempty"`   // Mês 1-12 (0 = categoria não é um mês)
+	Concluido   bool   `dynamodbav:"concluido" json:"concluido"`           // Atividade marcada como concluída
+	Progresso   int    `dynamodbav:"progresso" json:"progresso"`           // Maior progresso entre os vinculados (100 se concluída)
+	Vinculados  int    `dynamodbav:"vinculados" json:"vinculados"`         // Número de livros vinculados
+	WebhookUUID string `dynamodbav:"webhookUUID" json:"webhookUUID"`       // UUID da execução do webhook
+	UpdatedAt   string `dynamodbav:"updatedAt" json:"updatedAt"`           // RFC3339 timestamp do último update
+}
+
+// ActivityPartition - partição das atividades
+const ActivityPartition = "EVENT#ATIVIDADE"
+
 // WebhookItem - Item de webhook payload (salvo UMA VEZ por execução)
 // PK: "WEBHOOK#PAYLOAD#<uuid>" - identifica o webhook único
 // SK: "TIMESTAMP#<RFC3339>" - timestamp da execução
@@ -76,28 +117,318 @@ type WebhookItem struct {
 	Payload string `dynamodbav:"payload"` // JSON completo do webhook
 }
 
-// FalhaItem - Item de erro/falha com UUID
-// PK: "ERROR#<uuid>" - identifica o erro único
-// SK: "TIMESTAMP#<RFC3339>" - timestamp do erro
+// FalhaItem - Item de erro/falha do processamento
+// PK: "ERROR#<errorType>" - uma partição por tipo de erro (ex: "ERROR#COUNTRY_NOT_FOUND")
+// SK: "USER#<user>#[<pais>]" - um item por usuário e país: o mesmo erro repetido sobrescreve o anterior
 type FalhaItem struct {
-	PK              string `dynamodbav:"PK"`              // "ERROR#<uuid>"
-	SK              string `dynamodbav:"SK"`              // "TIMESTAMP#<RFC3339>"
-	ErrorType       string `dynamodbav:"errorType"`       // Tipo do erro
-	ErrorMessage    string `dynamodbav:"errorMessage"`    // Mensagem do erro
-	OriginalPayload string `dynamodbav:"originalPayload"` // Payload que causou o erro
+	PK              string `dynamodbav:"PK" json:"-"`                                                // "ERROR#<errorType>"
+	SK              string `dynamodbav:"SK" json:"-"`                                                // "USER#<user>#[<pais>]"
+	ErrorType       string `dynamodbav:"errorType" json:"errorType"`                                 // Tipo do erro (ErrorType*)
+	ErrorMessage    string `dynamodbav:"errorMessage" json:"errorMessage"`                           // Mensagem do erro
+	OriginalPayload string `dynamodbav:"originalPayload,omitempty" json:"originalPayload,omitempty"` // Payload que causou o erro
+
+	WebhookUUID string `dynamodbav:"webhookUUID,omitempty" json:"webhookUUID,omitempty"` // UUID do webhook (vazio se a mensagem não pôde ser lida)
+	User        string `dynamodbav:"user,omitempty" json:"user,omitempty"`               // Nome do usuário (UserIndex permite filtrar por usuário)
+	Pais        string `dynamodbav:"pais,omitempty" json:"pais,omitempty"`               // País do desafio (COUNTRY_NOT_FOUND)
+	CreatedAt   string `dynamodbav:"createdAt" json:"createdAt"`                         // RFC3339 timestamp da última ocorrência do erro
+}
+
+// Tipos de erro gravados em FalhaItem (PK "ERROR#<tipo>")
+const (
+	ErrorTypeInvalidMessage  = "INVALID_MESSAGE"
+	ErrorTypePayloadNotFound = "PAYLOAD_NOT_FOUND"
+	ErrorTypeInvalidPayload  = "INVALID_PAYLOAD"
+	ErrorTypeCountryNotFound = "COUNTRY_NOT_FOUND"
+	ErrorTypeTooManyChanges  = "TOO_MANY_CHANGES"
+)
+
+// ErrorTypes - todas as partições ERROR# existentes, incluindo tipos gravados
+// pelo webhook síncrono (< v1.0.9)
+var ErrorTypes = []string{
+	ErrorTypeInvalidMessage,
+	ErrorTypePayloadNotFound,
+	ErrorTypeInvalidPayload,
+	ErrorTypeCountryNotFound,
+	ErrorTypeTooManyChanges,
+	"METADATA_MARSHAL_ERROR",
+	"DYNAMODB_MARSHAL_ERROR",
+	"DYNAMODB_PUT_ERROR",
+}
+
+// FalhaKey retorna a chave de um FalhaItem. O webhook não faz parte da chave,
+// então reenvios com o mesmo erro sobrescrevem o item em vez de duplicá-lo
+func FalhaKey(errorType, user, pais string) (pk, sk string) {
+	return "ERROR#" + errorType, FalhaUserPrefix(user) + pais
+}
+
+// FalhaUserPrefix retorna o prefixo do SK das falhas de um usuário
+func FalhaUserPrefix(user string) string {
+	return "USER#" + user + "#"
+}
+
+// UnmappedCountryItem - País sem código ISO (quarentena até ser cadastrado um alias)
+// PK: "UNMAPPED#COUNTRY" - todos os países não mapeados numa partição
+// SK: "NAME#<pais>" - nome sem emojis, como enviado pelo Maratona.app
+type UnmappedCountryItem struct {
+	PK          string   `dynamodbav:"PK" json:"-"`
+	SK          string   `dynamodbav:"SK" json:"-"`
+	Name        string   `dynamodbav:"name" json:"name"`               // Nome do país não mapeado
+	Occurrences int      `dynamodbav:"occurrences" json:"occurrences"` // Desafios recebidos com este nome
+	Users       []string `dynamodbav:"users,stringset" json:"users"`   // Usuários afetados (não usa "user" para ficar fora do UserIndex)
+	LastUUID    string   `dynamodbav:"lastUUID" json:"lastUUID"`       // Último webhook com este nome
+	FirstSeen   string   `dynamodbav:"firstSeen" json:"firstSeen"`     // RFC3339
+	LastSeen    string   `dynamodbav:"lastSeen" json:"lastSeen"`       // RFC3339
+}
+
+// CountryAliasItem - Alias cadastrado em runtime, mesclado com mapping.NameToIso pelo consumer
+// PK: "ALIAS#COUNTRY" - todos os aliases numa partição
+// SK: "NAME#<pais>"
+type CountryAliasItem struct {
+	PK        string `dynamodbav:"PK" json:"-"`
+	SK        string `dynamodbav:"SK" json:"-"`
+	Name      string `dynamodbav:"name" json:"name"`           // Nome do país como enviado pelo Maratona.app
+	ISO3      string `dynamodbav:"iso3" json:"iso3"`           // Código ISO3 de destino
+	CreatedAt string `dynamodbav:"createdAt" json:"createdAt"` // RFC3339
+}
+
+// Partições de países não mapeados e aliases
+const (
+	UnmappedCountryPartition = "UNMAPPED#COUNTRY"
+	CountryAliasPartition    = "ALIAS#COUNTRY"
+)
+
+// CountryNameKey retorna o SK de um UnmappedCountryItem ou CountryAliasItem
+func CountryNameKey(name string) string {
+	return "NAME#" + name
+}
+
+// HistoryItem - Registro append-only de mudança de progresso (usuário/país/livro)
+// PK: "HISTORY#COUNTRY#<iso3>" - histórico do país em ordem cronológica
+// SK: "<HistoryTimeLayout>#<user>#<iso3>#<vinculadoID ou livro>" - timestamp do webhook que trouxe a mudança
+// O atributo "user" coloca o item no UserIndex (histórico do usuário via begins_with(PK, "HISTORY#"))
+type HistoryItem struct {
+	PK                string `dynamodbav:"PK" json:"-"`
+	SK                string `dynamodbav:"SK" json:"-"`
+	User              string `dynamodbav:"user" json:"user"`                                     // Nome do usuário
+	ISO3              string `dynamodbav:"iso3" json:"iso3"`                                     // Código ISO3
+	Pais              string `dynamodbav:"pais" json:"pais"`                                     // Nome do país
+	Livro             string `dynamodbav:"livro" json:"livro"`                                   // Título do livro
+	VinculadoID       string `dynamodbav:"vinculadoID,omitempty" json:"vinculadoID,omitempty"`   // ID do vinculado no Maratona.app
+	Progresso         int    `dynamodbav:"progresso" json:"progresso"`                           // Novo progresso 0-100%
+	ProgressoAnterior *int   `dynamodbav:"progressoAnterior,omitempty" json:"progressoAnterior"` // nil na primeira leitura do livro
+	WebhookUUID       string `dynamodbav:"webhookUUID" json:"webhookUUID"`                       // Webhook que trouxe a mudança
+	Timestamp         string `dynamodbav:"timestamp" json:"timestamp"`                           // HistoryTimeLayout do recebimento do webhook
+}
+
+const (
+	// HistoryPartitionPrefix é o prefixo das partições de histórico (uma por país)
+	HistoryPartitionPrefix = "HISTORY#COUNTRY#"
+	// HistoryTimeLayout - RFC3339 UTC com nanossegundos de largura fixa, para que
+	// SK e timestamp ordenem como texto (RFC3339Nano remove zeros à direita)
+	HistoryTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+// HistoryPartition retorna o PK do histórico de um país
+func HistoryPartition(iso3 string) string {
+	return HistoryPartitionPrefix + iso3
+}
+
+// ActivitiesResponse - Resposta de GET /activities
+type ActivitiesResponse struct {
+	Activities []AtividadeItem `json:"activities"`
+	Total      int             `json:"total"`
+}
+
+// CommunityCountryItem - Marca o primeiro leitor da comunidade em um país
+// PK: "COMMUNITY#COUNTRY" - todos os países já lidos numa partição
+// SK: "ISO3#<iso3>"
+type CommunityCountryItem struct {
+	PK          string `dynamodbav:"PK" json:"-"`
+	SK          string `dynamodbav:"SK" json:"-"`
+	ISO3        string `dynamodbav:"iso3" json:"iso3"`               // Código ISO3
+	FirstUser   string `dynamodbav:"firstUser" json:"firstUser"`     // Não usa "user" para ficar fora do UserIndex
+	WebhookUUID string `dynamodbav:"webhookUUID" json:"webhookUUID"` // Webhook que trouxe a primeira leitura
+	ReadAt      string `dynamodbav:"readAt" json:"readAt"`           // RFC3339
+}
+
+// CommunityCountryPartition - partição dos países já lidos pela comunidade
+const CommunityCountryPartition = "COMMUNITY#COUNTRY"
+
+// CommunityCountryKey retorna o SK de um CommunityCountryItem
+func CommunityCountryKey(iso3 string) string {
+	return "ISO3#" + iso3
+}
+
+// CountryAggregateItem - Agregado das leituras de um país, mantido pelo consumer a cada troca de leituras
+// PK: "AGGREGATE#COUNTRY" - todos os países numa partição (GET /stats lê só esta partição)
+// SK: "ISO3#<iso3>"
+// Os totais são recalculados a partir de Users; Version garante escrita otimista entre consumers concorrentes
+type CountryAggregateItem struct {
+	PK        string                         `dynamodbav:"PK" json:"-"`
+	SK        string                         `dynamodbav:"SK" json:"-"`
+	ISO3      string                         `dynamodbav:"iso3" json:"iso3"`           // Código ISO3
+	Progress  int                            `dynamodbav:"progress" json:"progress"`   // Maior progresso entre os leitores
+	Readers   int                            `dynamodbav:"readers" json:"readers"`     // Leitores com progresso > 0
+	Completed int                            `dynamodbav:"completed" json:"completed"` // Leitores com 100%
+	UpdatedAt string                         `dynamodbav:"updatedAt" json:"updatedAt"` // RFC3339 da leitura mais recente
+	Users     map[string]CountryContribution `dynamodbav:"users" json:"-"`             // Contribuição de cada usuário (não usa "user" para ficar fora do UserIndex)
+	Version   int                            `dynamodbav:"version" json:"-"`           // Incrementado a cada escrita
+}
+
+// CountryContribution - Leituras de um usuário em um país, resumidas para o agregado
+type CountryContribution struct {
+	Progresso  int             `dynamodbav:"progresso"`            // Maior progresso do usuário no país
+	UpdatedAt  string          `dynamodbav:"updatedAt"`            // RFC3339 da leitura mais recente do usuário
+	Avaliacoes []BookAvaliacao `dynamodbav:"avaliacoes,omitempty"` // Livros avaliados (avaliacao > 0)
+	Categorias map[string]int  `dynamodbav:"categorias,omitempty"` // Maior progresso por categoria (nome do mês quando for um mês)
+	Livros     []string        `dynamodbav:"livros,omitempty"`     // Títulos distintos lidos, em ordem
+}
+
+// BookAvaliacao - Avaliação de um livro dentro de um CountryContribution
+type BookAvaliacao struct {
+	Livro     string `dynamodbav:"livro,omitempty"`
+	Autor     string `dynamodbav:"autor,omitempty"`
+	Avaliacao int    `dynamodbav:"avaliacao"`
+}
+
+// CountryAggregatePartition - partição dos agregados por país
+const CountryAggregatePartition = "AGGREGATE#COUNTRY"
+
+// CountryAggregateKey retorna o SK de um CountryAggregateItem
+func CountryAggregateKey(iso3 string) string {
+	return "ISO3#" + iso3
+}
+
+// DataVersionItem - Marcador de versão dos dados lidos pela API, incrementado a cada escrita do consumer
+// PK: "META#VERSION"
+// SK: "DATA"
+// GET /stats, /users/locations e /readings derivam dele o ETag, sem ler as partições quando nada mudou
+type DataVersionItem struct {
+	PK        string `dynamodbav:"PK"`
+	SK        string `dynamodbav:"SK"`
+	Version   int64  `dynamodbav:"version"`   // Incrementado a cada escrita
+	UpdatedAt string `dynamodbav:"updatedAt"` // RFC3339 da última escrita
+}
+
+// DataVersionKey returns the primary key values of the DataVersionItem.
+func DataVersionKey() (pk, sk string) {
+	return "META#VERSION", "DATA"
+}
+
+// Status de processamento de um webhook (ciclo: QUEUED → PROCESSING → PROCESSED/PARTIAL/FAILED)
+// RETRYING: erro temporário, o SQS vai reentregar a mensagem (attempts < MaxReceiveCount)
+// SUPERSEDED: um webhook mais recente do mesmo usuário já foi aplicado
+const (
+	StatusQueued     = "QUEUED"
+	StatusProcessing = "PROCESSING"
+	StatusRetrying   = "RETRYING"
+	StatusProcessed  = "PROCESSED"
+	StatusPartial    = "PARTIAL"
+	StatusFailed     = "FAILED"
+	StatusSuperseded = "SUPERSEDED"
+)
+
+// Resultado do processamento de um desafio
+const (
+	OutcomeProcessed = "PROCESSED"
+	OutcomeSkipped   = "SKIPPED"
+	OutcomeFailed    = "FAILED"
+)
+
+// StatusRetention - tempo de retenção dos registros de status (mesmo lifecycle dos payloads no S3)
+const StatusRetentionDays = 90
+
+// DesafioOutcome - Resultado do processamento de um desafio dentro de um webhook
+type DesafioOutcome struct {
+	Country   string `dynamodbav:"country" json:"country"`                         // Nome do país (sem emojis)
+	ISO3      string `dynamodbav:"iso3,omitempty" json:"iso3,omitempty"`           // Código ISO3 (vazio se não mapeado)
+	Outcome   string `dynamodbav:"outcome" json:"outcome"`                         // PROCESSED, SKIPPED ou FAILED
+	ErrorCode string `dynamodbav:"errorCode,omitempty" json:"errorCode,omitempty"` // Código do erro (ex: COUNTRY_NOT_FOUND)
+}
+
+// WebhookStatusItem - Status de processamento de um webhook
+// PK: "WEBHOOK#STATUS#<uuid>" - um item por webhook
+// SK: "STATUS"
+type WebhookStatusItem struct {
+	PK         string           `dynamodbav:"PK" json:"-"`
+	SK         string           `dynamodbav:"SK" json:"-"`
+	UUID       string           `dynamodbav:"uuid" json:"uuid"`
+	User       string           `dynamodbav:"webhookUser" json:"user"` // Não usa "user" para ficar fora do UserIndex
+	Status     string           `dynamodbav:"status" json:"status"`
+	ReceivedAt string           `dynamodbav:"receivedAt" json:"receivedAt"`                   // RFC3339 - recebimento no webhook
+	UpdatedAt  string           `dynamodbav:"updatedAt" json:"updatedAt"`                     // RFC3339 - última transição
+	Processed  int              `dynamodbav:"processed" json:"processed"`                     // Desafios salvos
+	Failed     int              `dynamodbav:"failed" json:"failed"`                           // Desafios com erro
+	ErrorCode  string           `dynamodbav:"errorCode,omitempty" json:"errorCode,omitempty"` // Erro da mensagem inteira (ex: PAYLOAD_NOT_FOUND)
+	Attempts   int              `dynamodbav:"attempts,omitempty" json:"attempts,omitempty"`   // Entregas da mensagem pelo SQS (ApproximateReceiveCount)
+	Desafios   []DesafioOutcome `dynamodbav:"desafios,omitempty" json:"desafios,omitempty"`
+	ExpiresAt  int64            `dynamodbav:"expiresAt" json:"-"` // TTL DynamoDB
+}
+
+// WebhookStatusKey returns the primary key values for a webhook status item.
+func WebhookStatusKey(uuid string) (pk, sk string) {
+	return "WEBHOOK#STATUS#" + uuid, "STATUS"
 }
 
 // Stats response structure
 type CountryProgress struct {
-	ISO3     string `json:"iso3"`
-	Progress int    `json:"progress"`
+	ISO3           string         `json:"iso3"`
+	Progress       int            `json:"progress"`               // Cor do mapa, conforme a estratégia (padrão: maior progresso)
+	Readers        int            `json:"readers"`                // Leitores com progresso > 0
+	Completed      int            `json:"completed"`              // Leitores com 100%
+	AvgProgress    float64        `json:"avgProgress"`            // Média do progresso dos leitores
+	MedianProgress float64        `json:"medianProgress"`         // Mediana do progresso dos leitores
+	LastActivity   string         `json:"lastActivity,omitempty"` // RFC3339 da leitura mais recente
+	Books          int            `json:"books"`                  // Livros distintos lidos para o país
+	Categorias     map[string]int `json:"categorias,omitempty"`   // Maior progresso por categoria (ex: "Março": 80)
+	AvgRating      float64        `json:"avgRating,omitempty"`    // Média das avaliações dos livros do país
+	Ratings        int            `json:"ratings,omitempty"`      // Número de avaliações
+}
+
+// MonthSummary - Resumo de um mês da maratona em GET /stats
+type MonthSummary struct {
+	Mes       int    `json:"mes"`       // Número do mês (1-12)
+	Nome      string `json:"nome"`      // Nome do mês (ex: "Março")
+	Started   int    `json:"started"`   // Países com progresso > 0 no mês
+	Completed int    `json:"completed"` // Países concluídos (100%) no mês
+	Readers   int    `json:"readers"`   // Leitores com progresso > 0 no mês
+}
+
+// BookRating - Média das avaliações de um livro lido para um país
+type BookRating struct {
+	ISO3      string  `json:"iso3"`
+	Livro     string  `json:"livro"`
+	Autor     string  `json:"autor,omitempty"`
+	AvgRating float64 `json:"avgRating"`
+	Ratings   int     `json:"ratings"`
 }
 
 type StatsResponse struct {
 	Countries []CountryProgress `json:"countries"`
+	Books     []BookRating      `json:"books,omitempty"` // Livros avaliados, mais bem avaliados primeiro
+	Months    []MonthSummary    `json:"months"`          // Resumo por mês, na ordem do calendário
+	Strategy  string            `json:"strategy"`        // Estratégia usada em Progress: max, average ou completion
 	Total     int               `json:"total"`
 }
 
+// LeaderboardEntry - Posição de um usuário em GET /leaderboard
+type LeaderboardEntry struct {
+	Rank            int    `json:"rank"` // Empates dividem a posição (1, 1, 3)
+	User            string `json:"user"`
+	Completed       int    `json:"completed"`       // Países concluídos (100%)
+	Started         int    `json:"started"`         // Países com progresso > 0
+	MonthsCompleted int    `json:"monthsCompleted"` // Meses com todos os países do usuário concluídos
+	Continents      int    `json:"continents"`      // Continentes distintos entre os países iniciados
+}
+
+type LeaderboardResponse struct {
+	Users      []LeaderboardEntry `json:"users"`
+	Total      int                `json:"total"` // Usuários no ranking (todas as páginas)
+	Offset     int                `json:"offset"`
+	Limit      int                `json:"limit"`
+	NextOffset int                `json:"nextOffset,omitempty"` // Offset da próxima página (ausente na última)
+}
+
 // User locations response structure
 type UserLocation struct {
 	User      string `json:"user"`
@@ -114,11 +445,78 @@ type UserLocationsResponse struct {
 	Total int            `json:"total"`
 }
 
+// UserProfileResponse - Perfil de um participante em GET /users/{name} (página "passaporte")
+type UserProfileResponse struct {
+	User       string           `json:"user"`
+	AvatarURL  string           `json:"avatarURL,omitempty"`
+	ProfileURL string           `json:"profileURL,omitempty"` // Link do perfil no Maratona.app
+	Countries  []ProfileCountry `json:"countries"`            // Por mês, depois por nome
+	Months     []ProfileMonth   `json:"months"`               // Meses com leituras, na ordem do calendário
+	Totals     ProfileTotals    `json:"totals"`
+}
+
+// ProfileCountry - Um país lido pelo participante, com os livros
+type ProfileCountry struct {
+	ISO3      string        `json:"iso3"`
+	Pais      string        `json:"pais"`
+	Continent string        `json:"continent,omitempty"`
+	Categoria string        `json:"categoria"`
+	Mes       int           `json:"mes,omitempty"` // 0 quando a categoria não é um mês
+	Progress  int           `json:"progress"`      // Maior progresso entre os livros
+	UpdatedAt string        `json:"updatedAt"`
+	Books     []ProfileBook `json:"books"`
+}
+
+// ProfileBook - Um livro lido para um país
+type ProfileBook struct {
+	Livro      string `json:"livro,omitempty"`
+	Autor      string `json:"autor,omitempty"`
+	CapaURL    string `json:"capaURL,omitempty"`
+	Progresso  int    `json:"progresso"`
+	Avaliacao  int    `json:"avaliacao,omitempty"`
+	Comentario string `json:"comentario,omitempty"`
+	UpdatedAt  string `json:"updatedAt"`
+}
+
+// ProfileMonth - Conclusão de um mês pelo participante
+type ProfileMonth struct {
+	Mes       int    `json:"mes"`
+	Nome      string `json:"nome"`
+	Countries int    `json:"countries"` // Países lidos no mês
+	Completed int    `json:"completed"` // Países concluídos (100%)
+	Complete  bool   `json:"complete"`  // Todas as leituras do mês concluídas
+}
+
+// ProfileTotals - Totais do participante
+type ProfileTotals struct {
+	Countries       int `json:"countries"`       // Países com progresso > 0
+	Completed       int `json:"completed"`       // Países concluídos (100%)
+	Books           int `json:"books"`           // Livros vinculados
+	MonthsCompleted int `json:"monthsCompleted"` // Meses com todos os países concluídos
+	Continents      int `json:"continents"`      // Continentes distintos entre os países iniciados
+}
+
+// HistoryResponse - Histórico de progresso de um usuário ou país, em ordem cronológica
+type HistoryResponse struct {
+	User    string        `json:"user,omitempty"`
+	ISO3    string        `json:"iso3,omitempty"`
+	History []HistoryItem `json:"history"`
+	Total   int           `json:"total"`
+}
+
+// Object metadata of archived payloads (payloads/{uuid}.json), so a rebuild
+// can find each user's newest payload without downloading them all. S3
+// metadata values must be ASCII, so the user is URL-escaped (url.QueryEscape).
+const (
+	PayloadMetadataUser      = "user"
+	PayloadMetadataTimestamp = "timestamp" // Same value as SQSMessage.Timestamp
+)
+
 // SQSMessage represents the message sent to SQS queue for async webhook processing.
 // Contains only metadata; the full payload is stored in S3 for cost efficiency.
 // The consumer Lambda fetches the payload from S3 using the UUID as the key.
 type SQSMessage struct {
 	UUID      string `json:"uuid"`      // Webhook UUID - used as S3 key (payloads/{uuid}.json)
 	User      string `json:"user"`      // User name from perfil.nome
-	Timestamp string `json:"timestamp"` // RFC3339 timestamp of webhook reception
+	Timestamp string `json:"timestamp"` // RFC3339 (nanosecond) timestamp of webhook reception, orders messages per user
 }
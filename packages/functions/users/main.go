@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/mundotalendo/functions/auth"
+	"github.com/mundotalendo/functions/httpcache"
 	"github.com/mundotalendo/functions/types"
 )
 
@@ -51,6 +52,21 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 		}, nil
 	}
 
+	if request.RouteKey == ProfileRoute {
+		return profileHandler(ctx, request), nil
+	}
+
+	// Conditional GET: the data version marker tells whether the client's copy
+	// is current, without reading the partitions
+	validator, cacheable, err := httpcache.Load(ctx, dynamoClient, tableName, "/users/locations")
+	if err != nil {
+		log.Printf("WARN: Failed to load data version: %v", err)
+	}
+	if cacheable && validator.NotModified(request.Headers) {
+		log.Printf("Not modified: %s", validator.ETag)
+		return validator.NotModifiedResponse(), nil
+	}
+
 	// Query DynamoDB for all readings with pagination
 	var allItems []map[string]ddbTypes.AttributeValue
 	var lastKey map[string]ddbTypes.AttributeValue
@@ -102,7 +118,7 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 		}
 
 		// Keep latest reading per user (v1.0.3: use UpdatedAt timestamp, not SK)
-		// SK now is <uuid>#<iso3>#<index> - doesn't reflect temporal order
+		// SK is <user>#<desafioID>[#<vinculadoID>] - doesn't reflect temporal order
 		// UpdatedAt has actual timestamp from book's last update
 		if existing, exists := userLatest[reading.User]; !exists || reading.UpdatedAt > existing.UpdatedAt {
 			userLatest[reading.User] = reading
@@ -137,13 +153,18 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 
 	log.Printf("Returning %d unique user locations", len(users))
 
+	headers := map[string]string{
+		"Content-Type":                "application/json",
+		"Access-Control-Allow-Origin": "*",
+	}
+	if cacheable {
+		validator.Apply(headers)
+	}
+
 	return events.APIGatewayV2HTTPResponse{
 		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type":                "application/json",
-			"Access-Control-Allow-Origin": "*",
-		},
-		Body: string(responseBody),
+		Headers:    headers,
+		Body:       string(responseBody),
 	}, nil
 }
 
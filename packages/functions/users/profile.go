@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/calendar"
+	"github.com/mundotalendo/functions/httpcache"
+	"github.com/mundotalendo/functions/mapping"
+	"github.com/mundotalendo/functions/types"
+)
+
+// ProfileRoute is the route of the user profile ("passport") endpoint.
+const ProfileRoute = "GET /users/{name}"
+
+// profileHandler returns everything about a single participant: avatar,
+// profile link, countries with their books, month completion and totals.
+// The readings are queried through the GSI UserIndex.
+func profileHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	log.Printf("Profile request: %v", request.PathParameters)
+
+	// Names have spaces and accents; keep the raw value if it is not escaped
+	name := request.PathParameters["name"]
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errorResponse(400, "Invalid user name")
+	}
+
+	// Conditional GET: the data version marker tells whether the client's copy
+	// is current, without reading the partitions
+	validator, cacheable, err := httpcache.Load(ctx, dynamoClient, tableName, "/users/"+name)
+	if err != nil {
+		log.Printf("WARN: Failed to load data version: %v", err)
+	}
+	if cacheable && validator.NotModified(request.Headers) {
+		log.Printf("Not modified: %s", validator.ETag)
+		return validator.NotModifiedResponse()
+	}
+
+	readings, err := queryUserReadings(ctx, name)
+	if err != nil {
+		log.Printf("Error querying DynamoDB: %v", err)
+		return errorResponse(500, "Error fetching data")
+	}
+	if len(readings) == 0 {
+		return errorResponse(404, "User not found")
+	}
+
+	responseBody, err := json.Marshal(buildProfile(name, readings))
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return errorResponse(500, "Error building response")
+	}
+
+	log.Printf("Returning profile of %s (%d readings)", name, len(readings))
+
+	headers := map[string]string{
+		"Content-Type":                "application/json",
+		"Access-Control-Allow-Origin": "*",
+	}
+	if cacheable {
+		validator.Apply(headers)
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    headers,
+		Body:       string(responseBody),
+	}
+}
+
+// queryUserReadings returns the live readings of a user (all pages).
+func queryUserReadings(ctx context.Context, user string) ([]types.LeituraItem, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              &tableName,
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("#user = :user AND PK = :pk"),
+		ExpressionAttributeNames: map[string]string{
+			"#user": "user",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":user": &ddbTypes.AttributeValueMemberS{Value: user},
+			":pk":   &ddbTypes.AttributeValueMemberS{Value: "EVENT#LEITURA"},
+		},
+	}
+
+	var readings []types.LeituraItem
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []types.LeituraItem
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, err
+		}
+		readings = append(readings, page...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return readings, nil
+}
+
+// buildProfile groups a user's readings by country. A country counts as
+// completed when its best reading is at 100%, and a month when every country
+// categorized in it is completed (calendar.MonthComplete, as in GET /leaderboard).
+func buildProfile(user string, readings []types.LeituraItem) types.UserProfileResponse {
+	profile := types.UserProfileResponse{User: user}
+
+	latest := ""
+	countries := make(map[string]*types.ProfileCountry)
+	for _, reading := range readings {
+		if reading.UpdatedAt >= latest {
+			latest = reading.UpdatedAt
+			profile.AvatarURL = reading.ImagemURL
+			profile.ProfileURL = reading.PerfilURL
+		}
+		if reading.ISO3 == "" {
+			continue
+		}
+
+		country, exists := countries[reading.ISO3]
+		if !exists {
+			country = &types.ProfileCountry{
+				ISO3:      reading.ISO3,
+				Continent: mapping.Continent(reading.ISO3),
+				Books:     []types.ProfileBook{},
+			}
+			countries[reading.ISO3] = country
+		}
+		if reading.UpdatedAt >= country.UpdatedAt {
+			country.Pais = reading.Pais
+			country.Categoria = reading.Categoria
+			country.Mes = readingMonth(reading)
+			country.UpdatedAt = reading.UpdatedAt
+		}
+		country.Progress = max(country.Progress, reading.Progresso)
+
+		if reading.Livro != "" {
+			country.Books = append(country.Books, types.ProfileBook{
+				Livro:      reading.Livro,
+				Autor:      reading.Autor,
+				CapaURL:    reading.CapaURL,
+				Progresso:  reading.Progresso,
+				Avaliacao:  reading.Avaliacao,
+				Comentario: reading.Comentario,
+				UpdatedAt:  reading.UpdatedAt,
+			})
+			profile.Totals.Books++
+		}
+	}
+
+	profile.Countries = make([]types.ProfileCountry, 0, len(countries))
+	continents := make(map[string]bool)
+	for _, country := range countries {
+		sort.Slice(country.Books, func(i, j int) bool {
+			return country.Books[i].UpdatedAt > country.Books[j].UpdatedAt
+		})
+		profile.Countries = append(profile.Countries, *country)
+
+		if country.Progress > 0 {
+			profile.Totals.Countries++
+			if country.Continent != "" {
+				continents[country.Continent] = true
+			}
+		}
+		if country.Progress == 100 {
+			profile.Totals.Completed++
+		}
+	}
+	profile.Totals.Continents = len(continents)
+
+	// By month (categorias that are not a month last), then by name
+	sort.Slice(profile.Countries, func(i, j int) bool {
+		a, b := profile.Countries[i], profile.Countries[j]
+		if a.Mes != b.Mes {
+			return b.Mes == 0 || (a.Mes != 0 && a.Mes < b.Mes)
+		}
+		return a.Pais < b.Pais
+	})
+
+	profile.Months = profileMonths(readings)
+	for _, month := range profile.Months {
+		if month.Complete {
+			profile.Totals.MonthsCompleted++
+		}
+	}
+
+	return profile
+}
+
+// profileMonths summarizes the months the user has readings in, in calendar order.
+func profileMonths(readings []types.LeituraItem) []types.ProfileMonth {
+	progress := make(map[int]map[string]int) // month -> ISO3 -> max progress
+	for _, reading := range readings {
+		mes := readingMonth(reading)
+		if mes == 0 || reading.ISO3 == "" {
+			continue
+		}
+		if progress[mes] == nil {
+			progress[mes] = make(map[string]int)
+		}
+		progress[mes][reading.ISO3] = max(progress[mes][reading.ISO3], reading.Progresso)
+	}
+
+	months := []types.ProfileMonth{}
+	for _, m := range calendar.Months {
+		countries, exists := progress[m.Number]
+		if !exists {
+			continue
+		}
+		completed := 0
+		for _, p := range countries {
+			if p == 100 {
+				completed++
+			}
+		}
+		months = append(months, types.ProfileMonth{
+			Mes:       m.Number,
+			Nome:      m.Name,
+			Countries: len(countries),
+			Completed: completed,
+			Complete:  calendar.MonthComplete(countries),
+		})
+	}
+	return months
+}
+
+// readingMonth returns the month of a reading's categoria (0 if not a month).
+// Readings saved before the month was recorded are parsed from the categoria.
+func readingMonth(reading types.LeituraItem) int {
+	if reading.Mes != 0 {
+		return reading.Mes
+	}
+	return calendar.ParseCategory(reading.Categoria)
+}
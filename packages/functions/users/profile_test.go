@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mundotalendo/functions/types"
+)
+
+func TestBuildProfile(t *testing.T) {
+	readings := []types.LeituraItem{
+		{ISO3: "CHL", Pais: "Chile", Categoria: "Janeiro", Mes: 1, Progresso: 100, Livro: "Poemas", UpdatedAt: "2026-01-10T00:00:00Z", ImagemURL: "old.jpg"},
+		{ISO3: "CHL", Pais: "Chile", Categoria: "Janeiro", Mes: 1, Progresso: 100, Livro: "Casa dos Espíritos", Avaliacao: 5, UpdatedAt: "2026-01-20T00:00:00Z", ImagemURL: "old.jpg"},
+		{ISO3: "PRT", Pais: "Portugal", Categoria: "Março", Progresso: 40, Livro: "Ensaio sobre a Cegueira", UpdatedAt: "2026-03-05T00:00:00Z", ImagemURL: "new.jpg", PerfilURL: "https://maratona.app/u/ana"},
+		{ISO3: "JPN", Pais: "Japão", Categoria: "Março", Mes: 3, Progresso: 0, UpdatedAt: "2026-02-28T00:00:00Z"},
+		{ISO3: "MEX", Pais: "México", Categoria: "Bônus", Progresso: 100, Livro: "Pedro Páramo", UpdatedAt: "2026-02-01T00:00:00Z"},
+	}
+
+	profile := buildProfile("Ana", readings)
+
+	if profile.AvatarURL != "new.jpg" || profile.ProfileURL != "https://maratona.app/u/ana" {
+		t.Errorf("expected avatar and link of the latest reading, got %q %q", profile.AvatarURL, profile.ProfileURL)
+	}
+
+	order := []string{"CHL", "JPN", "PRT", "MEX"}
+	if len(profile.Countries) != len(order) {
+		t.Fatalf("expected %d countries, got %+v", len(order), profile.Countries)
+	}
+	for i, iso3 := range order {
+		if profile.Countries[i].ISO3 != iso3 {
+			t.Errorf("position %d: expected %s, got %s", i, iso3, profile.Countries[i].ISO3)
+		}
+	}
+	chl := profile.Countries[0]
+	if chl.Progress != 100 || len(chl.Books) != 2 || chl.Books[0].Livro != "Casa dos Espíritos" || chl.Continent != "América do Sul" {
+		t.Errorf("unexpected Chile: %+v", chl)
+	}
+
+	if len(profile.Months) != 2 {
+		t.Fatalf("expected January and March, got %+v", profile.Months)
+	}
+	if jan := profile.Months[0]; jan.Nome != "Janeiro" || !jan.Complete || jan.Completed != 1 {
+		t.Errorf("unexpected January: %+v", jan)
+	}
+	if mar := profile.Months[1]; mar.Countries != 2 || mar.Completed != 0 || mar.Complete {
+		t.Errorf("unexpected March: %+v", mar)
+	}
+
+	want := types.ProfileTotals{Countries: 3, Completed: 2, Books: 4, MonthsCompleted: 1, Continents: 3}
+	if profile.Totals != want {
+		t.Errorf("expected totals %+v, got %+v", want, profile.Totals)
+	}
+}
+
+func TestBuildProfile_MonthUsesBestBookPerCountry(t *testing.T) {
+	// One finished book completes Chile, so it must not block January, just as
+	// in the leaderboard (aggregates keep the best progress per country)
+	readings := []types.LeituraItem{
+		{ISO3: "CHL", Pais: "Chile", Categoria: "Janeiro", Mes: 1, Progresso: 100, Livro: "Poemas"},
+		{ISO3: "CHL", Pais: "Chile", Categoria: "Janeiro", Mes: 1, Progresso: 40, Livro: "Casa dos Espíritos"},
+	}
+
+	profile := buildProfile("Ana", readings)
+
+	if len(profile.Months) != 1 {
+		t.Fatalf("expected January only, got %+v", profile.Months)
+	}
+	if jan := profile.Months[0]; !jan.Complete || jan.Completed != 1 {
+		t.Errorf("expected January complete, got %+v", jan)
+	}
+	if profile.Totals.Completed != 1 || profile.Totals.MonthsCompleted != 1 {
+		t.Errorf("unexpected totals: %+v", profile.Totals)
+	}
+}
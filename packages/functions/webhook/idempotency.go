@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/types"
+)
+
+// IdempotencyKeyHeader lets clients supply their own deduplication key.
+// When absent, the canonical payload hash is used instead.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyTTL is how long a payload hash is remembered per user.
+// It only needs to cover client retries; a later resend of the same
+// payload (a revert, or a resync after /clear) must be queued again.
+const IdempotencyTTL = 5 * time.Minute
+
+// IdempotencySK is the sort key of the single per-user idempotency item.
+const IdempotencySK = "LATEST"
+
+// ErrDuplicatePayload indicates the payload was already accepted for the user.
+var ErrDuplicatePayload = errors.New("duplicate webhook payload")
+
+// IdempotencyItem maps the last accepted payload hash to its webhook UUID.
+// Only the latest hash is kept, so accepting a different payload overwrites it.
+// PK: "IDEMPOTENCY#<user>" - one partition per perfil.nome
+// SK: "LATEST"
+type IdempotencyItem struct {
+	PK        string `dynamodbav:"PK"`
+	SK        string `dynamodbav:"SK"`
+	Hash      string `dynamodbav:"hash"` // canonical payload hash or hashed Idempotency-Key
+	UUID      string `dynamodbav:"uuid"`
+	CreatedAt string `dynamodbav:"createdAt"`
+	ExpiresAt int64  `dynamodbav:"expiresAt"`
+}
+
+// payloadHash returns the deduplication hash for a request.
+// The payload is re-marshaled from the parsed struct so whitespace,
+// key order and unknown fields in the raw body do not affect the hash.
+func payloadHash(payload types.WebhookPayload, idempotencyKey string) (string, error) {
+	var data []byte
+	if idempotencyKey != "" {
+		data = []byte("key:" + idempotencyKey)
+	} else {
+		canonical, err := json.Marshal(payload)
+		if err != nil {
+			return "", fmt.Errorf("marshal canonical payload failed: %w", err)
+		}
+		data = append([]byte("payload:"), canonical...)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// claimIdempotencyKey records hash -> webhookUUID for the user with a conditional write.
+// If the hash matches the user's latest accepted payload (and has not expired), it
+// returns the original UUID together with ErrDuplicatePayload. A different hash
+// replaces the previous one.
+func (w *Webhook) claimIdempotencyKey(ctx context.Context, user, hash, webhookUUID string) (string, error) {
+	now := time.Now()
+	item := IdempotencyItem{
+		PK:        "IDEMPOTENCY#" + user,
+		SK:        IdempotencySK,
+		Hash:      hash,
+		UUID:      webhookUUID,
+		CreatedAt: now.UTC().Format(time.RFC3339),
+		ExpiresAt: now.Add(IdempotencyTTL).Unix(),
+	}
+
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return "", fmt.Errorf("marshal idempotency item failed: %w", err)
+	}
+
+	// TTL deletion is lazy, so expired items must be treated as absent
+	_, err = w.dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(w.config.TableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(PK) OR #hash <> :hash OR expiresAt < :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#hash": "hash",
+		},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":hash": &ddbtypes.AttributeValueMemberS{Value: hash},
+			":now":  &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+		ReturnValuesOnConditionCheckFailure: ddbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var conditionFailed *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			var existing IdempotencyItem
+			if err := attributevalue.UnmarshalMap(conditionFailed.Item, &existing); err != nil {
+				return "", fmt.Errorf("unmarshal idempotency item failed: %w", err)
+			}
+			return existing.UUID, ErrDuplicatePayload
+		}
+		return "", fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+
+	return webhookUUID, nil
+}
+
+// releaseIdempotencyKey removes a claim so a retry of a failed request is not
+// mistaken for a duplicate. An empty hash means no claim was made. The delete is
+// conditional so a newer payload claimed in the meantime is kept.
+func (w *Webhook) releaseIdempotencyKey(ctx context.Context, user, hash string) {
+	if hash == "" {
+		return
+	}
+
+	_, err := w.dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(w.config.TableName),
+		Key: map[string]ddbtypes.AttributeValue{
+			"PK": &ddbtypes.AttributeValueMemberS{Value: "IDEMPOTENCY#" + user},
+			"SK": &ddbtypes.AttributeValueMemberS{Value: IdempotencySK},
+		},
+		ConditionExpression: aws.String("#hash = :hash"),
+		ExpressionAttributeNames: map[string]string{
+			"#hash": "hash",
+		},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":hash": &ddbtypes.AttributeValueMemberS{Value: hash},
+		},
+	})
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return
+	}
+	if err != nil {
+		log.Printf("WARN: Failed to release idempotency key for user=%s: %v", user, err)
+	}
+}
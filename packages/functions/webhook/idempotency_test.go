@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mundotalendo/functions/types"
+)
+
+func TestPayloadHash_IgnoresFormatting(t *testing.T) {
+	compact := `{"perfil":{"nome":"Test User"},"maratona":{"identificador":"mundotalendo-2026"},"desafios":[{"descricao":"Brasil","tipo":"leitura"}]}`
+	reordered := `{
+		"desafios": [{"tipo": "leitura", "descricao": "Brasil"}],
+		"maratona": {"identificador": "mundotalendo-2026"},
+		"perfil": {"nome": "Test User"},
+		"extra": "ignored"
+	}`
+
+	var a, b types.WebhookPayload
+	if err := json.Unmarshal([]byte(compact), &a); err != nil {
+		t.Fatalf("Failed to parse payload: %v", err)
+	}
+	if err := json.Unmarshal([]byte(reordered), &b); err != nil {
+		t.Fatalf("Failed to parse payload: %v", err)
+	}
+
+	hashA, err := payloadHash(a, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	hashB, _ := payloadHash(b, "")
+
+	if hashA != hashB {
+		t.Errorf("Expected equal hashes for equivalent payloads, got %s and %s", hashA, hashB)
+	}
+
+	b.Desafios[0].Descricao = "Portugal"
+	if hashC, _ := payloadHash(b, ""); hashC == hashA {
+		t.Error("Expected different hash for a different payload")
+	}
+}
+
+func TestPayloadHash_IdempotencyKeyOverridesPayload(t *testing.T) {
+	a := types.WebhookPayload{Perfil: types.Perfil{Nome: "Test User"}}
+	b := types.WebhookPayload{Perfil: types.Perfil{Nome: "Other User"}}
+
+	hashA, _ := payloadHash(a, "retry-123")
+	hashB, _ := payloadHash(b, "retry-123")
+	if hashA != hashB {
+		t.Error("Expected Idempotency-Key to determine the hash")
+	}
+
+	if hashPayload, _ := payloadHash(a, ""); hashPayload == hashA {
+		t.Error("Expected key-based and payload-based hashes to differ")
+	}
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	w := newTestWebhook(client)
+	ctx := context.Background()
+
+	uuid, err := w.claimIdempotencyKey(ctx, "Test User", "abc", "uuid-1")
+	if err != nil {
+		t.Fatalf("Expected first claim to succeed, got %v", err)
+	}
+	if uuid != "uuid-1" {
+		t.Errorf("Expected uuid-1, got %s", uuid)
+	}
+
+	uuid, err = w.claimIdempotencyKey(ctx, "Test User", "abc", "uuid-2")
+	if !errors.Is(err, ErrDuplicatePayload) {
+		t.Fatalf("Expected ErrDuplicatePayload, got %v", err)
+	}
+	if uuid != "uuid-1" {
+		t.Errorf("Expected original uuid-1, got %s", uuid)
+	}
+
+	// Same hash for a different user is not a duplicate
+	if _, err := w.claimIdempotencyKey(ctx, "Other User", "abc", "uuid-3"); err != nil {
+		t.Errorf("Expected claim for other user to succeed, got %v", err)
+	}
+}
+
+func TestClaimIdempotencyKey_RevertIsNotDuplicate(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	w := newTestWebhook(client)
+	ctx := context.Background()
+
+	// A, B, A: the second A reverts the user's data and must be queued
+	for i, hash := range []string{"A", "B", "A"} {
+		if _, err := w.claimIdempotencyKey(ctx, "Test User", hash, "uuid"); err != nil {
+			t.Fatalf("Expected claim %d (%s) to succeed, got %v", i, hash, err)
+		}
+	}
+}
+
+func TestReleaseIdempotencyKey(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	w := newTestWebhook(client)
+	ctx := context.Background()
+
+	if _, err := w.claimIdempotencyKey(ctx, "Test User", "abc", "uuid-1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	w.releaseIdempotencyKey(ctx, "Test User", "abc")
+
+	if _, err := w.claimIdempotencyKey(ctx, "Test User", "abc", "uuid-2"); err != nil {
+		t.Errorf("Expected claim after release to succeed, got %v", err)
+	}
+
+	// Releasing an older hash keeps the newer claim
+	if _, err := w.claimIdempotencyKey(ctx, "Test User", "def", "uuid-3"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.releaseIdempotencyKey(ctx, "Test User", "abc")
+	if _, err := w.claimIdempotencyKey(ctx, "Test User", "def", "uuid-4"); !errors.Is(err, ErrDuplicatePayload) {
+		t.Errorf("Expected newer claim to survive release of an older hash, got %v", err)
+	}
+
+	// Empty hash means no claim was made - nothing to delete
+	deletes := len(client.deletes)
+	w.releaseIdempotencyKey(ctx, "Test User", "")
+	if len(client.deletes) != deletes {
+		t.Error("Expected no DeleteItem call for empty hash")
+	}
+}
+
+func TestDuplicateResponse(t *testing.T) {
+	response := duplicateResponse("original-uuid")
+
+	if response.StatusCode != 200 {
+		t.Errorf("Expected status code 200, got %d", response.StatusCode)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	if body["uuid"] != "original-uuid" {
+		t.Errorf("Expected uuid 'original-uuid', got '%v'", body["uuid"])
+	}
+
+	if body["status"] != "DUPLICATE" {
+		t.Errorf("Expected status 'DUPLICATE', got '%v'", body["status"])
+	}
+}
@@ -6,11 +6,14 @@
 //
 // Processing flow:
 //  1. Validate API key
-//  2. Validate basic payload structure
-//  3. Generate unique UUID
-//  4. Save full payload to S3
-//  5. Send message to SQS queue
-//  6. Return 202 Accepted
+//  2. Validate HMAC signature (keys with a signing secret only)
+//  3. Validate basic payload structure
+//  4. Deduplicate retries (payload hash or Idempotency-Key header)
+//  5. Generate unique UUID
+//  6. Save full payload to S3
+//  7. Record QUEUED status (queryable via GET /webhook/{uuid})
+//  8. Send message to SQS queue
+//  9. Return 202 Accepted (or 200 DUPLICATE with the original UUID)
 //
 // Benefits of async processing:
 //   - Fast response time (~100ms vs ~2s)
@@ -23,15 +26,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
@@ -53,14 +61,23 @@ var ValidIdentifiers = map[string]bool{
 
 // Config holds the Lambda configuration from environment variables.
 type Config struct {
-	TableName  string
-	BucketName string
-	QueueURL   string
+	TableName          string
+	BucketName         string
+	QueueURL           string
+	SignatureTolerance time.Duration
+}
+
+// DynamoDBClient defines the DynamoDB operations used by the webhook.
+// This interface enables mocking in unit tests.
+type DynamoDBClient interface {
+	auth.DynamoDBScanAPI
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
 }
 
 // Webhook handles incoming webhook requests.
 type Webhook struct {
-	dynamoClient *dynamodb.Client
+	dynamoClient DynamoDBClient
 	s3Client     *s3.Client
 	sqsClient    *sqs.Client
 	config       Config
@@ -99,9 +116,10 @@ func initWebhook() {
 	}
 
 	webhookConfig := Config{
-		TableName:  os.Getenv("SST_Resource_DataTable_name"),
-		BucketName: os.Getenv("SST_Resource_PayloadBucket_name"),
-		QueueURL:   os.Getenv("SST_Resource_WebhookQueue_url"),
+		TableName:          os.Getenv("SST_Resource_DataTable_name"),
+		BucketName:         os.Getenv("SST_Resource_PayloadBucket_name"),
+		QueueURL:           os.Getenv("SST_Resource_WebhookQueue_url"),
+		SignatureTolerance: parseSignatureTolerance(os.Getenv("WEBHOOK_SIGNATURE_TOLERANCE_SECONDS")),
 	}
 
 	if webhookConfig.TableName == "" || webhookConfig.BucketName == "" || webhookConfig.QueueURL == "" {
@@ -116,8 +134,22 @@ func initWebhook() {
 		config:       webhookConfig,
 	}
 
-	log.Printf("Webhook initialized: table=%s, bucket=%s, queue=%s",
-		webhookConfig.TableName, webhookConfig.BucketName, webhookConfig.QueueURL)
+	log.Printf("Webhook initialized: table=%s, bucket=%s, queue=%s, signatureTolerance=%s",
+		webhookConfig.TableName, webhookConfig.BucketName, webhookConfig.QueueURL, webhookConfig.SignatureTolerance)
+}
+
+// parseSignatureTolerance parses the tolerance window in seconds,
+// falling back to auth.DefaultSignatureTolerance when unset or invalid.
+func parseSignatureTolerance(value string) time.Duration {
+	if value == "" {
+		return auth.DefaultSignatureTolerance
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		log.Printf("WARN: Invalid WEBHOOK_SIGNATURE_TOLERANCE_SECONDS=%q, using default", value)
+		return auth.DefaultSignatureTolerance
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 // handler processes incoming webhook HTTP requests.
@@ -132,25 +164,33 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 
 	// 2. Validate API key
 	apiKey := getAPIKey(request.Headers)
-	if !auth.ValidateAPIKey(ctx, webhook.dynamoClient, apiKey) {
+	keyItem, ok := auth.LookupAPIKey(ctx, webhook.dynamoClient, apiKey)
+	if !ok {
 		log.Printf("Unauthorized: invalid API key")
 		return errorResponse(401, "UNAUTHORIZED", "Invalid or missing API key"), nil
 	}
 
-	// 3. Parse and validate payload
+	// 3. Validate HMAC signature (keys without a signing secret skip this step)
+	if keyItem.SigningSecret != "" {
+		if err := webhook.verifySignature(ctx, keyItem, request.Headers, request.Body); err != nil {
+			return signatureErrorResponse(err), nil
+		}
+	}
+
+	// 4. Parse and validate payload
 	var payload types.WebhookPayload
 	if err := json.Unmarshal([]byte(request.Body), &payload); err != nil {
 		log.Printf("Error parsing payload: %v", err)
 		return errorResponse(400, "INVALID_JSON", "Failed to parse JSON payload"), nil
 	}
 
-	// 4. Validate identificador
+	// 5. Validate identificador
 	if !ValidIdentifiers[payload.Maratona.Identificador] {
 		log.Printf("Ignoring event with identificador: %s", payload.Maratona.Identificador)
 		return successResponse("Event ignored - invalid identificador"), nil
 	}
 
-	// 5. Validate required fields
+	// 6. Validate required fields
 	if payload.Perfil.Nome == "" {
 		log.Printf("Validation error: missing perfil.nome")
 		return errorResponse(400, "VALIDATION_ERROR", "Missing required field: perfil.nome"), nil
@@ -161,34 +201,61 @@ func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (event
 		return errorResponse(400, "VALIDATION_ERROR", "No desafios provided"), nil
 	}
 
-	// 6. Generate UUID and timestamp
+	// 7. Generate UUID and timestamp
 	webhookUUID := uuid.New().String()
-	timestamp := time.Now().Format(time.RFC3339)
+	// Nanosecond precision lets the consumer order several syncs within the same second
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+
+	// 8. Deduplicate retries: same payload (or Idempotency-Key) for the same user
+	// returns the UUID that was originally queued instead of queueing again.
+	// Deduplication failures are not fatal - the consumer tolerates reprocessing.
+	hash, err := payloadHash(payload, getHeader(request.Headers, IdempotencyKeyHeader))
+	if err != nil {
+		log.Printf("WARN: Failed to hash payload, skipping deduplication: %v", err)
+	} else {
+		originalUUID, err := webhook.claimIdempotencyKey(ctx, payload.Perfil.Nome, hash, webhookUUID)
+		if errors.Is(err, ErrDuplicatePayload) {
+			log.Printf("Duplicate webhook for user=%s, original UUID=%s", payload.Perfil.Nome, originalUUID)
+			return duplicateResponse(originalUUID), nil
+		}
+		if err != nil {
+			log.Printf("WARN: Failed to record idempotency key, skipping deduplication: %v", err)
+			hash = ""
+		}
+	}
 
 	log.Printf("Processing webhook UUID=%s for user=%s", webhookUUID, payload.Perfil.Nome)
 
-	// 7. Save payload to S3
-	if err := webhook.savePayloadToS3(ctx, webhookUUID, request.Body); err != nil {
+	// 9. Save payload to S3
+	if err := webhook.savePayloadToS3(ctx, webhookUUID, payload.Perfil.Nome, timestamp, request.Body); err != nil {
 		log.Printf("Error saving to S3: %v", err)
+		webhook.releaseIdempotencyKey(ctx, payload.Perfil.Nome, hash)
 		return errorResponse(500, "STORAGE_ERROR", "Failed to store payload"), nil
 	}
 
-	// 8. Send message to SQS
+	// 10. Record QUEUED status (before SQS so the consumer's PROCESSING is never overwritten)
+	if err := webhook.saveQueuedStatus(ctx, webhookUUID, payload.Perfil.Nome, timestamp); err != nil {
+		log.Printf("WARN: Failed to save QUEUED status: %v", err)
+	}
+
+	// 11. Send message to SQS
 	if err := webhook.sendToSQS(ctx, webhookUUID, payload.Perfil.Nome, timestamp); err != nil {
 		log.Printf("Error sending to SQS: %v", err)
-		// Cleanup S3 on failure
+		// Cleanup S3 and the idempotency claim on failure so the client can retry
 		webhook.deletePayloadFromS3(ctx, webhookUUID)
+		webhook.releaseIdempotencyKey(ctx, payload.Perfil.Nome, hash)
 		return errorResponse(500, "QUEUE_ERROR", "Failed to queue message"), nil
 	}
 
 	log.Printf("Webhook queued successfully: UUID=%s, User=%s", webhookUUID, payload.Perfil.Nome)
 
-	// 9. Return 202 Accepted
+	// 12. Return 202 Accepted
 	return acceptedResponse(webhookUUID), nil
 }
 
-// savePayloadToS3 stores the webhook payload in S3.
-func (w *Webhook) savePayloadToS3(ctx context.Context, webhookUUID, body string) error {
+// savePayloadToS3 stores the webhook payload in S3, with the user and the
+// reception timestamp as object metadata (read by the consumer's rebuild).
+func (w *Webhook) savePayloadToS3(ctx context.Context, webhookUUID, user, timestamp, body string) error {
 	key := fmt.Sprintf("payloads/%s.json", webhookUUID)
 
 	_, err := w.s3Client.PutObject(ctx, &s3.PutObjectInput{
@@ -196,6 +263,10 @@ func (w *Webhook) savePayloadToS3(ctx context.Context, webhookUUID, body string)
 		Key:         aws.String(key),
 		Body:        bytes.NewReader([]byte(body)),
 		ContentType: aws.String("application/json"),
+		Metadata: map[string]string{
+			types.PayloadMetadataUser:      url.QueryEscape(user),
+			types.PayloadMetadataTimestamp: timestamp,
+		},
 	})
 	if err != nil {
 		return fmt.Errorf("S3 PutObject failed: %w", err)
@@ -218,6 +289,37 @@ func (w *Webhook) deletePayloadFromS3(ctx context.Context, webhookUUID string) {
 	}
 }
 
+// saveQueuedStatus creates the initial status record for a webhook.
+// The consumer updates it as processing progresses.
+func (w *Webhook) saveQueuedStatus(ctx context.Context, webhookUUID, user, timestamp string) error {
+	pk, sk := types.WebhookStatusKey(webhookUUID)
+	now := time.Now()
+
+	av, err := attributevalue.MarshalMap(types.WebhookStatusItem{
+		PK:         pk,
+		SK:         sk,
+		UUID:       webhookUUID,
+		User:       user,
+		Status:     types.StatusQueued,
+		ReceivedAt: timestamp,
+		UpdatedAt:  now.UTC().Format(time.RFC3339),
+		ExpiresAt:  now.AddDate(0, 0, types.StatusRetentionDays).Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal status item failed: %w", err)
+	}
+
+	_, err = w.dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(w.config.TableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+
+	return nil
+}
+
 // sendToSQS sends a message to the webhook processing queue.
 func (w *Webhook) sendToSQS(ctx context.Context, webhookUUID, user, timestamp string) error {
 	msg := types.SQSMessage{
@@ -251,6 +353,20 @@ func getAPIKey(headers map[string]string) string {
 	return headers["X-API-Key"]
 }
 
+// getHeader returns a header value using a case-insensitive name lookup.
+// API Gateway v2 lowercases header names, but tests and local tools may not.
+func getHeader(headers map[string]string, name string) string {
+	if value := headers[strings.ToLower(name)]; value != "" {
+		return value
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
 // Response helpers
 
 func errorResponse(statusCode int, code, message string) events.APIGatewayV2HTTPResponse {
@@ -291,6 +407,20 @@ func acceptedResponse(uuid string) events.APIGatewayV2HTTPResponse {
 	}
 }
 
+func duplicateResponse(uuid string) events.APIGatewayV2HTTPResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"success": true,
+		"uuid":    uuid,
+		"status":  "DUPLICATE",
+		"message": "Webhook already received - returning original UUID",
+	})
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
+}
+
 func main() {
 	lambda.Start(handler)
 }
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/mundotalendo/functions/auth"
 	"github.com/mundotalendo/functions/types"
 )
 
@@ -428,3 +432,96 @@ func TestDesafioTypeFiltering(t *testing.T) {
 		t.Errorf("Expected %d valid desafios, got %d", expectedValid, validCount)
 	}
 }
+
+func TestGetHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		lookup   string
+		expected string
+	}{
+		{
+			name:     "Lowercase header",
+			headers:  map[string]string{"x-signature": "abc"},
+			lookup:   "X-Signature",
+			expected: "abc",
+		},
+		{
+			name:     "Canonical header",
+			headers:  map[string]string{"X-Signature-Timestamp": "1768384800"},
+			lookup:   "X-Signature-Timestamp",
+			expected: "1768384800",
+		},
+		{
+			name:     "Mixed case header",
+			headers:  map[string]string{"X-SIGNATURE": "def"},
+			lookup:   "X-Signature",
+			expected: "def",
+		},
+		{
+			name:     "Missing header",
+			headers:  map[string]string{},
+			lookup:   "X-Signature",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getHeader(tt.headers, tt.lookup); got != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseSignatureTolerance(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", auth.DefaultSignatureTolerance},
+		{"120", 2 * time.Minute},
+		{"0", auth.DefaultSignatureTolerance},
+		{"-5", auth.DefaultSignatureTolerance},
+		{"abc", auth.DefaultSignatureTolerance},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseSignatureTolerance(tt.value); got != tt.expected {
+				t.Errorf("parseSignatureTolerance(%q) = %v, want %v", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSaveQueuedStatus(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	w := newTestWebhook(client)
+
+	if err := w.saveQueuedStatus(context.Background(), "test-uuid", "Test User", "2026-01-14T10:00:00Z"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(client.puts) != 1 {
+		t.Fatalf("Expected 1 PutItem call, got %d", len(client.puts))
+	}
+
+	var item types.WebhookStatusItem
+	if err := attributevalue.UnmarshalMap(client.puts[0].Item, &item); err != nil {
+		t.Fatalf("Failed to unmarshal status item: %v", err)
+	}
+
+	if item.PK != "WEBHOOK#STATUS#test-uuid" {
+		t.Errorf("Expected PK 'WEBHOOK#STATUS#test-uuid', got '%s'", item.PK)
+	}
+
+	if item.Status != types.StatusQueued {
+		t.Errorf("Expected status QUEUED, got '%s'", item.Status)
+	}
+
+	if item.ReceivedAt != "2026-01-14T10:00:00Z" {
+		t.Errorf("Expected receivedAt to match webhook timestamp, got '%s'", item.ReceivedAt)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/auth"
+)
+
+// ErrSignatureReused indicates the signature was already accepted once.
+var ErrSignatureReused = errors.New("signature already used")
+
+// SignatureItem records an accepted signature to block replays.
+// PK: "SIGNATURE#<hex>" - one item per accepted signature
+// SK: "KEY#<name>" - API key that signed the request
+// The item expires (DynamoDB TTL) once the timestamp leaves the tolerance window,
+// after which the timestamp check alone rejects the request.
+type SignatureItem struct {
+	PK        string `dynamodbav:"PK"`
+	SK        string `dynamodbav:"SK"`
+	CreatedAt string `dynamodbav:"createdAt"`
+	ExpiresAt int64  `dynamodbav:"expiresAt"`
+}
+
+// verifySignature validates the HMAC signature headers for a signed API key
+// and records the signature so it cannot be replayed.
+func (w *Webhook) verifySignature(ctx context.Context, key *auth.APIKeyItem, headers map[string]string, body string) error {
+	signature := getHeader(headers, auth.SignatureHeader)
+	timestamp := getHeader(headers, auth.SignatureTimestampHeader)
+
+	signedAt, err := auth.VerifySignature(key.SigningSecret, timestamp, body, signature, time.Now(), w.config.SignatureTolerance)
+	if err != nil {
+		log.Printf("Unauthorized: invalid signature for key %s: %v", key.Name, err)
+		return err
+	}
+
+	return w.claimSignature(ctx, key.Name, signature, signedAt.Add(w.config.SignatureTolerance))
+}
+
+// claimSignature stores the signature with a conditional write.
+// Returns ErrSignatureReused if the same signature was already stored.
+func (w *Webhook) claimSignature(ctx context.Context, keyName, signature string, expiresAt time.Time) error {
+	normalized := strings.TrimPrefix(strings.ToLower(signature), "sha256=")
+
+	item := SignatureItem{
+		PK:        "SIGNATURE#" + normalized,
+		SK:        "KEY#" + keyName,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		ExpiresAt: expiresAt.Unix(),
+	}
+
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("marshal signature item failed: %w", err)
+	}
+
+	_, err = w.dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(w.config.TableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+	if err != nil {
+		var conditionFailed *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			log.Printf("Unauthorized: signature reused for key %s", keyName)
+			return ErrSignatureReused
+		}
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+
+	return nil
+}
+
+// signatureErrorResponse maps signature verification errors to HTTP responses.
+func signatureErrorResponse(err error) events.APIGatewayV2HTTPResponse {
+	switch {
+	case errors.Is(err, ErrSignatureReused):
+		return errorResponse(401, "SIGNATURE_REUSED", "Signature has already been used")
+	case errors.Is(err, auth.ErrMissingSignature):
+		return errorResponse(401, "MISSING_SIGNATURE", "Missing X-Signature or X-Signature-Timestamp header")
+	case errors.Is(err, auth.ErrInvalidSignatureTimestamp),
+		errors.Is(err, auth.ErrSignatureExpired):
+		return errorResponse(401, "INVALID_SIGNATURE_TIMESTAMP", "Signature timestamp is invalid or outside the tolerance window")
+	case errors.Is(err, auth.ErrInvalidSignature):
+		return errorResponse(401, "INVALID_SIGNATURE", "Signature does not match payload")
+	default:
+		log.Printf("Error storing signature: %v", err)
+		return errorResponse(500, "STORAGE_ERROR", "Failed to verify signature")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mundotalendo/functions/auth"
+)
+
+// Mock DynamoDB client for testing.
+// Conditional puts fail when an item with the same PK/SK was already stored
+// (for idempotency items, only when the stored hash matches).
+type mockDynamoDBClient struct {
+	putErr  error
+	items   map[string]map[string]ddbtypes.AttributeValue
+	puts    []*dynamodb.PutItemInput
+	deletes []*dynamodb.DeleteItemInput
+}
+
+func itemKey(item map[string]ddbtypes.AttributeValue) string {
+	return item["PK"].(*ddbtypes.AttributeValueMemberS).Value + "|" + item["SK"].(*ddbtypes.AttributeValueMemberS).Value
+}
+
+func (m *mockDynamoDBClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if m.putErr != nil {
+		return nil, m.putErr
+	}
+	m.puts = append(m.puts, params)
+
+	if m.items == nil {
+		m.items = make(map[string]map[string]ddbtypes.AttributeValue)
+	}
+	key := itemKey(params.Item)
+	if existing, ok := m.items[key]; ok && params.ConditionExpression != nil {
+		if !strings.Contains(*params.ConditionExpression, "#hash <> :hash") || sameHash(existing, params.ExpressionAttributeValues) {
+			return nil, &ddbtypes.ConditionalCheckFailedException{Item: existing}
+		}
+	}
+	m.items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.deletes = append(m.deletes, params)
+	if existing, ok := m.items[itemKey(params.Key)]; ok && params.ConditionExpression != nil && !sameHash(existing, params.ExpressionAttributeValues) {
+		return nil, &ddbtypes.ConditionalCheckFailedException{}
+	}
+	delete(m.items, itemKey(params.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func sameHash(item, values map[string]ddbtypes.AttributeValue) bool {
+	stored, ok := item["hash"].(*ddbtypes.AttributeValueMemberS)
+	if !ok {
+		return false
+	}
+	hash, ok := values[":hash"].(*ddbtypes.AttributeValueMemberS)
+	return ok && stored.Value == hash.Value
+}
+
+func newTestWebhook(client *mockDynamoDBClient) *Webhook {
+	return &Webhook{
+		dynamoClient: client,
+		config: Config{
+			TableName:          "test-table",
+			SignatureTolerance: auth.DefaultSignatureTolerance,
+		},
+	}
+}
+
+func TestVerifySignature_AcceptsOnceAndRejectsReplay(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	w := newTestWebhook(client)
+	key := &auth.APIKeyItem{Name: "maratona", SigningSecret: "s3cr3t"}
+
+	body := `{"perfil":{"nome":"Test User"}}`
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		"x-signature":           auth.ComputeSignature("s3cr3t", ts, body),
+		"x-signature-timestamp": ts,
+	}
+
+	if err := w.verifySignature(context.Background(), key, headers, body); err != nil {
+		t.Fatalf("Expected first request to be accepted, got %v", err)
+	}
+
+	if err := w.verifySignature(context.Background(), key, headers, body); !errors.Is(err, ErrSignatureReused) {
+		t.Errorf("Expected ErrSignatureReused on replay, got %v", err)
+	}
+
+	// Prefixed variant of the same signature must also be treated as a replay
+	headers["x-signature"] = "sha256=" + headers["x-signature"]
+	if err := w.verifySignature(context.Background(), key, headers, body); !errors.Is(err, ErrSignatureReused) {
+		t.Errorf("Expected ErrSignatureReused for prefixed replay, got %v", err)
+	}
+}
+
+func TestVerifySignature_InvalidSignatureNotStored(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	w := newTestWebhook(client)
+	key := &auth.APIKeyItem{Name: "maratona", SigningSecret: "s3cr3t"}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		"x-signature":           auth.ComputeSignature("wrong-secret", ts, "{}"),
+		"x-signature-timestamp": ts,
+	}
+
+	if err := w.verifySignature(context.Background(), key, headers, "{}"); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	if len(client.puts) != 0 {
+		t.Errorf("Expected no signature to be stored, got %d puts", len(client.puts))
+	}
+}
+
+func TestSignatureErrorResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectedCode int
+		expectedBody string
+	}{
+		{"Reused", ErrSignatureReused, 401, "SIGNATURE_REUSED"},
+		{"Missing", auth.ErrMissingSignature, 401, "MISSING_SIGNATURE"},
+		{"Expired", auth.ErrSignatureExpired, 401, "INVALID_SIGNATURE_TIMESTAMP"},
+		{"Bad timestamp", auth.ErrInvalidSignatureTimestamp, 401, "INVALID_SIGNATURE_TIMESTAMP"},
+		{"Invalid", auth.ErrInvalidSignature, 401, "INVALID_SIGNATURE"},
+		{"Storage", errors.New("throttled"), 500, "STORAGE_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := signatureErrorResponse(tt.err)
+			if response.StatusCode != tt.expectedCode {
+				t.Errorf("Expected status %d, got %d", tt.expectedCode, response.StatusCode)
+			}
+			if !strings.Contains(response.Body, tt.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", tt.expectedBody, response.Body)
+			}
+		})
+	}
+}
@@ -124,6 +124,21 @@ export default function CountryPopup({ readers = [], countryName, position, load
                     <p className="text-xs text-gray-600 line-clamp-2 leading-tight mt-1">
                       {reader.livro}
                     </p>
+                    {reader.autor && (
+                      <p className="text-xs text-gray-500 truncate">
+                        {reader.autor}
+                      </p>
+                    )}
+                    {reader.avaliacao > 0 && (
+                      <p className="text-xs text-yellow-500" title={`${reader.avaliacao}/5`}>
+                        {'★'.repeat(Math.min(reader.avaliacao, 5))}
+                      </p>
+                    )}
+                    {reader.comentario && (
+                      <p className="text-xs text-gray-500 italic line-clamp-2 leading-tight mt-1">
+                        “{reader.comentario}”
+                      </p>
+                    )}
 
                     {/* Progress Bar */}
                     <div className="mt-2">
@@ -17,6 +17,7 @@
 
 /**
  * Month configurations for the reading challenge
+ * Mirrors packages/functions/calendar, the source of truth (kept in sync by its tests)
  * Each month has 5 color tiers based on reading progress
  * @type {MonthConfig[]}
  */
@@ -20,14 +20,22 @@ export default $config({
         PK: "string",   // Partition key: EVENT#LEITURA#<uuid>, ERROR#<uuid>, APIKEY#*, WEBHOOK#PAYLOAD#<uuid>
         SK: "string",   // Sort key: COUNTRY#<iso3>, TIMESTAMP#*, KEY#*
         user: "string", // User name for GSI queries
+        countryKey: "string", // ISO3 of live readings (EVENT#LEITURA) for CountryIndex
+        progresso: "number", // Reading progress 0-100, CountryIndex sort key
       },
       primaryIndex: { hashKey: "PK", rangeKey: "SK" },
+      ttl: "expiresAt", // Short-lived items (e.g. SIGNATURE#* replay guards)
       globalIndexes: {
         UserIndex: {
           hashKey: "user",
           rangeKey: "PK", // Helps with efficient queries
           projection: "all",
         },
+        CountryIndex: {
+          hashKey: "countryKey", // Only live readings carry it (sparse index)
+          rangeKey: "progresso",
+          projection: "all",
+        },
       },
       transform: {
         table: {
@@ -74,12 +82,16 @@ export default $config({
       },
     });
 
+    // Reading milestones (started, progressed, completed, abandoned, first in community)
+    // published by the consumer; subscribers filter on the "type" message attribute
+    const readingEvents = new sst.aws.SnsTopic("ReadingEvents");
+
     // Consumer Lambda - processes messages from SQS
     webhookQueue.subscribe({
       handler: "packages/functions/consumer",
       runtime: "go",
       architecture: "arm64",
-      link: [dataTable, payloadBucket],
+      link: [dataTable, payloadBucket, readingEvents],
       timeout: "60 seconds",
       memory: "512 MB",
       transform: {
@@ -88,7 +100,23 @@ export default $config({
         },
       },
     }, {
-      batch: { size: 1 },
+      // Partial batch responses: only failed records are retried
+      batch: { size: 10, partialResponses: true },
+    });
+
+    // Rebuild job - recomputes readings from the S3 payload archive (invoked manually, see `make rebuild`)
+    const rebuild = new sst.aws.Function("Rebuild", {
+      handler: "packages/functions/consumer",
+      runtime: "go",
+      architecture: "arm64",
+      link: [dataTable, payloadBucket],
+      timeout: "15 minutes", // Lists and re-processes the whole archive
+      memory: "1024 MB",
+      transform: {
+        function: (args) => {
+          args.reservedConcurrentExecutions = 1; // Only one rebuild at a time
+        },
+      },
     });
 
     // API Gateway with inline route definitions
@@ -123,6 +151,9 @@ export default $config({
       link: [dataTable, payloadBucket, webhookQueue],
       timeout: "10 seconds", // Reduced - only validation and queueing
       memory: "128 MB",      // Reduced - less processing
+      environment: {
+        WEBHOOK_SIGNATURE_TOLERANCE_SECONDS: "300", // Max clock skew for X-Signature-Timestamp
+      },
       transform: {
         function: (args) => {
           args.reservedConcurrentExecutions = 10;
@@ -130,6 +161,55 @@ export default $config({
       },
     });
 
+    api.route("GET /webhook/{uuid}", {
+      handler: "packages/functions/status",
+      runtime: "go",
+      architecture: "arm64",
+      link: [dataTable],
+      timeout: "10 seconds",
+      memory: "128 MB",
+      transform: {
+        function: (args) => {
+          args.reservedConcurrentExecutions = 5; // Support lookups only
+        },
+      },
+    });
+
+    // Read-only admin listings (errors, unmapped countries, aliases)
+    for (const route of ["GET /admin/errors", "GET /admin/unmapped", "GET /admin/aliases", "GET /admin/month-mismatches"]) {
+      api.route(route, {
+        handler: "packages/functions/admin",
+        runtime: "go",
+        architecture: "arm64",
+        link: [dataTable],
+        timeout: "10 seconds",
+        memory: "128 MB",
+        transform: {
+          function: (args) => {
+            args.reservedConcurrentExecutions = 2; // Admin use only
+          },
+        },
+      });
+    }
+
+    // DLQ inspection/redrive and alias registration - served by the consumer so
+    // redrive and reprocessing reuse its processing path
+    for (const route of ["GET /admin/dlq", "POST /admin/dlq/redrive", "POST /admin/aliases"]) {
+      api.route(route, {
+        handler: "packages/functions/consumer",
+        runtime: "go",
+        architecture: "arm64",
+        link: [dataTable, payloadBucket, webhookDLQ, readingEvents],
+        timeout: "29 seconds", // API Gateway limit; redrive stops early near the deadline
+        memory: "512 MB",
+        transform: {
+          function: (args) => {
+            args.reservedConcurrentExecutions = 1; // One admin operation at a time
+          },
+        },
+      });
+    }
+
     api.route("POST /test/seed", {
       handler: "packages/functions/seed",
       runtime: "go",
@@ -200,6 +280,21 @@ export default $config({
       },
     });
 
+    // User profile ("passport"): same function code as /users/locations
+    api.route("GET /users/{name}", {
+      handler: "packages/functions/users",
+      runtime: "go",
+      architecture: "arm64",
+      link: [dataTable],
+      timeout: "30 seconds",
+      memory: "256 MB",
+      transform: {
+        function: (args) => {
+          args.reservedConcurrentExecutions = 10;
+        },
+      },
+    });
+
     api.route("GET /readings/{iso3}", {
       handler: "packages/functions/readings",
       runtime: "go",
@@ -214,6 +309,53 @@ export default $config({
       },
     });
 
+    // Activities (atividade desafios, kept apart from readings)
+    api.route("GET /activities", {
+      handler: "packages/functions/activities",
+      runtime: "go",
+      architecture: "arm64",
+      link: [dataTable],
+      timeout: "30 seconds",
+      memory: "256 MB",
+      transform: {
+        function: (args) => {
+          args.reservedConcurrentExecutions = 10;
+        },
+      },
+    });
+
+    // Leaderboard (users ranked from the country aggregates)
+    api.route("GET /leaderboard", {
+      handler: "packages/functions/leaderboard",
+      runtime: "go",
+      architecture: "arm64",
+      link: [dataTable],
+      timeout: "30 seconds",
+      memory: "256 MB",
+      transform: {
+        function: (args) => {
+          args.reservedConcurrentExecutions = 10;
+        },
+      },
+    });
+
+    // Reading history (progress changes per user or per country)
+    for (const route of ["GET /history/users/{user}", "GET /history/countries/{iso3}"]) {
+      api.route(route, {
+        handler: "packages/functions/history",
+        runtime: "go",
+        architecture: "arm64",
+        link: [dataTable],
+        timeout: "30 seconds",
+        memory: "256 MB",
+        transform: {
+          function: (args) => {
+            args.reservedConcurrentExecutions = 10;
+          },
+        },
+      });
+    }
+
     // Next.js Frontend
     const web = new sst.aws.Nextjs("Web", {
       path: "./",
@@ -725,6 +867,7 @@ export default $config({
       payloadBucket: payloadBucket.name,
       webhookQueue: webhookQueue.url,
       webhookDLQ: webhookDLQ.url,
+      rebuild: rebuild.name,
     };
   },
 });